@@ -0,0 +1,120 @@
+package pdf50tawi
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseAmount parses a baht amount such as "1,234.50", "1234.5" or "1234"
+// into satang. Negative amounts and more than two decimal places are
+// rejected.
+func ParseAmount(s string) (int64, error) {
+	t := strings.ReplaceAll(strings.TrimSpace(s), ",", "")
+	if t == "" {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	whole, frac, hasFrac := strings.Cut(t, ".")
+	if whole == "" || !isDigits(whole) || (hasFrac && (len(frac) > 2 || !isDigits(frac))) {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	for len(frac) < 2 {
+		frac += "0"
+	}
+	satang, err := strconv.ParseInt(whole+frac, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q: %w", s, err)
+	}
+	return satang, nil
+}
+
+// FormatAmount formats satang as baht with thousands separators and two
+// decimals, e.g. 123450 → "1,234.50".
+func FormatAmount(satang int64) string {
+	sign := ""
+	if satang < 0 {
+		sign, satang = "-", -satang
+	}
+	whole := strconv.FormatInt(satang/100, 10)
+	var b strings.Builder
+	for i, r := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(r)
+	}
+	return fmt.Sprintf("%s%s.%02d", sign, b.String(), satang%100)
+}
+
+var (
+	thaiDigits = [...]string{"ศูนย์", "หนึ่ง", "สอง", "สาม", "สี่", "ห้า", "หก", "เจ็ด", "แปด", "เก้า"}
+	thaiPlaces = [...]string{"", "สิบ", "ร้อย", "พัน", "หมื่น", "แสน"}
+)
+
+// BahtText spells out satang in Thai as written on the certificate's
+// ตัวอักษร line, e.g. 45000 → "สี่ร้อยห้าสิบบาทถ้วน" and
+// 12150 → "หนึ่งร้อยยี่สิบเอ็ดบาทห้าสิบสตางค์".
+func BahtText(satang int64) string {
+	if satang < 0 {
+		return "ลบ" + BahtText(-satang)
+	}
+	baht, st := satang/100, satang%100
+	switch {
+	case baht == 0 && st == 0:
+		return "ศูนย์บาทถ้วน"
+	case st == 0:
+		return thaiNumber(baht) + "บาทถ้วน"
+	case baht == 0:
+		return thaiNumber(st) + "สตางค์"
+	}
+	return thaiNumber(baht) + "บาท" + thaiNumber(st) + "สตางค์"
+}
+
+// thaiNumber spells out n > 0, grouping by ล้าน.
+func thaiNumber(n int64) string {
+	if n >= 1_000_000 {
+		rest := n % 1_000_000
+		s := thaiNumber(n/1_000_000) + "ล้าน"
+		if rest > 0 {
+			s += thaiBelowMillion(rest, true)
+		}
+		return s
+	}
+	return thaiBelowMillion(n, false)
+}
+
+// thaiBelowMillion spells out 0 < n < 1,000,000. A trailing one is read
+// เอ็ด whenever more digits precede it, including a preceding ล้าน.
+func thaiBelowMillion(n int64, afterMillion bool) string {
+	digits := strconv.FormatInt(n, 10)
+	var b strings.Builder
+	for i, r := range digits {
+		d := int(r - '0')
+		place := len(digits) - 1 - i
+		switch {
+		case d == 0:
+			continue
+		case place == 1 && d == 1:
+			b.WriteString("สิบ")
+			continue
+		case place == 1 && d == 2:
+			b.WriteString("ยี่สิบ")
+			continue
+		case place == 0 && d == 1 && (len(digits) > 1 || afterMillion):
+			b.WriteString("เอ็ด")
+			continue
+		}
+		b.WriteString(thaiDigits[d])
+		b.WriteString(thaiPlaces[place])
+	}
+	return b.String()
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -0,0 +1,62 @@
+package pdf50tawi
+
+import "testing"
+
+func TestParseAmount(t *testing.T) {
+	for in, want := range map[string]int64{
+		"1,234.50":   123450,
+		"1234.5":     123450,
+		"1234":       123400,
+		" 0.07 ":     7,
+		"401,010.01": 40101001,
+	} {
+		got, err := ParseAmount(in)
+		if err != nil {
+			t.Fatalf("ParseAmount(%q) error: %v", in, err)
+		}
+		if got != want {
+			t.Fatalf("ParseAmount(%q) = %d, want %d", in, got, want)
+		}
+	}
+	for _, in := range []string{"", "-1", "1.234", "abc", "1.2.3", ".5"} {
+		if _, err := ParseAmount(in); err == nil {
+			t.Fatalf("ParseAmount(%q): expected an error", in)
+		}
+	}
+}
+
+func TestFormatAmount(t *testing.T) {
+	for in, want := range map[int64]string{
+		0:         "0.00",
+		7:         "0.07",
+		123450:    "1,234.50",
+		40101001:  "401,010.01",
+		100000000: "1,000,000.00",
+		-123450:   "-1,234.50",
+	} {
+		if got := FormatAmount(in); got != want {
+			t.Fatalf("FormatAmount(%d) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestBahtText(t *testing.T) {
+	for in, want := range map[int64]string{
+		0:           "ศูนย์บาทถ้วน",
+		100:         "หนึ่งบาทถ้วน",
+		1100:        "สิบเอ็ดบาทถ้วน",
+		2100:        "ยี่สิบเอ็ดบาทถ้วน",
+		45000:       "สี่ร้อยห้าสิบบาทถ้วน",
+		10100:       "หนึ่งร้อยเอ็ดบาทถ้วน",
+		12150:       "หนึ่งร้อยยี่สิบเอ็ดบาทห้าสิบสตางค์",
+		25:          "ยี่สิบห้าสตางค์",
+		1203030:     "หนึ่งหมื่นสองพันสามสิบบาทสามสิบสตางค์",
+		100000100:   "หนึ่งล้านเอ็ดบาทถ้วน",
+		1100000000:  "สิบเอ็ดล้านบาทถ้วน",
+		12345678900: "หนึ่งร้อยยี่สิบสามล้านสี่แสนห้าหมื่นหกพันเจ็ดร้อยแปดสิบเก้าบาทถ้วน",
+	} {
+		if got := BahtText(in); got != want {
+			t.Fatalf("BahtText(%d) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -2,15 +2,60 @@ package pdf50tawi
 
 import (
 	"bytes"
+	"errors"
 	"io"
 	"strings"
 )
 
 // IssueWHTCertificatePDF generates a filled WHT certificate PDF.
-func IssueWHTCertificatePDF(outputPDF io.Writer, taxInfo TaxInfo, sign io.Reader, logo io.Reader) error {
+// Options such as WithMetadata and WithEncryption are applied after the form
+// is filled.
+func IssueWHTCertificatePDF(outputPDF io.Writer, taxInfo TaxInfo, sign io.Reader, logo io.Reader, opts ...Option) error {
+	o := newIssueOptions(opts)
+	overlays, err := o.overlays(taxInfo)
+	if err != nil {
+		return err
+	}
 	images := CertificateImageFields(sign, logo)
 	texts := TextFieldsFromTaxInfo(taxInfo)
-	return fillCertificate(texts, images, outputPDF)
+	if o.encryption == nil && !o.reproducible && !o.metadata {
+		return fillCertificate(texts, images, outputPDF, overlays...)
+	}
+	if o.encryption != nil && o.reproducible {
+		return errors.New("reproducible output cannot be encrypted")
+	}
+
+	var props map[string]string
+	if o.metadata {
+		if props, err = metadataProperties(taxInfo, o.replaces); err != nil {
+			return err
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := fillCertificate(texts, images, &buf, overlays...); err != nil {
+		return err
+	}
+	if o.reproducible {
+		return writeReproducible(buf.Bytes(), outputPDF, reproducibleDate(taxInfo), props)
+	}
+	if o.encryption == nil {
+		return addProperties(buf.Bytes(), outputPDF, props)
+	}
+
+	pdf := buf.Bytes()
+	if props != nil {
+		var withProps bytes.Buffer
+		if err := addProperties(pdf, &withProps, props); err != nil {
+			return err
+		}
+		pdf = withProps.Bytes()
+	}
+	user, owner, err := o.encryption.passwords(taxInfo)
+	if err != nil {
+		return err
+	}
+	return encryptPDF(pdf, outputPDF, user, owner)
 }
 
 // CertificateImageFields returns the positioned image fields for the signature and company seal.
@@ -0,0 +1,493 @@
+package main
+
+// batch — issue one certificate per payee from a CSV or XLSX payroll export.
+//
+//	go run ./cmd/cli batch \
+//	  --input   payroll.xlsx \
+//	  --mapping mapping.json \
+//	  --out-dir certificates
+//
+// Each row holds one payee's payment of one income type. Rows are grouped by
+// payee tax ID; amounts of the same income type are summed and the totals and
+// ตัวอักษร line are computed. See examples/batch-mapping.json for a mapping file.
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/AnuchitO/pdf50tawi"
+)
+
+// batchMapping describes how spreadsheet columns become TaxInfo fields.
+type batchMapping struct {
+	// Template is applied to every certificate: payer, ภ.ง.ด. ticks,
+	// withholding type, issue date, book number and so on.
+	Template pdf50tawi.TaxInfo `json:"template"`
+
+	// Columns maps TaxInfo fields to spreadsheet header names.
+	Columns batchColumns `json:"columns"`
+
+	// IncomeTypes maps values of the income type column to TaxInfo income
+	// keys such as "income40_1". Without it the cell must hold the key.
+	IncomeTypes map[string]string `json:"incomeTypes"`
+
+	// DefaultIncomeType is used when there is no income type column or the
+	// cell is empty.
+	DefaultIncomeType string `json:"defaultIncomeType"`
+
+	// Numbering fills in the empty book and document numbers of each
+	// certificate issued with pdf50tawi.Numbering formats, e.g.
+	// "WHT-{seq:04}". DocumentFormat defaults to "{seq:03}".
+	Numbering struct {
+		BookFormat     string `json:"bookFormat"`
+		DocumentFormat string `json:"documentFormat"`
+	} `json:"numbering"`
+}
+
+type batchColumns struct {
+	PayeeTaxID          string `json:"payee.taxId"`
+	PayeeTaxID10Digit   string `json:"payee.taxId10Digit"`
+	PayeeName           string `json:"payee.name"`
+	PayeeAddress        string `json:"payee.address"`
+	PayeeSequenceNumber string `json:"payee.sequenceNumber"`
+	IncomeType          string `json:"incomeType"`
+	DatePaid            string `json:"datePaid"`
+	AmountPaid          string `json:"amountPaid"`
+	TaxWithheld         string `json:"taxWithheld"`
+}
+
+// batchResult reports the outcome for one payee.
+type batchResult struct {
+	PayeeTaxID     string                      `json:"payeeTaxId"`
+	PayeeName      string                      `json:"payeeName,omitempty"`
+	Rows           []int                       `json:"rows"`
+	DocumentNumber string                      `json:"documentNumber,omitempty"`
+	File           string                      `json:"file,omitempty"`
+	Error          string                      `json:"error,omitempty"`
+	Issues         []pdf50tawi.ValidationIssue `json:"issues,omitempty"`
+}
+
+type batchReport struct {
+	Issued  int           `json:"issued"`
+	Failed  int           `json:"failed"`
+	Merged  string        `json:"merged,omitempty"`
+	Results []batchResult `json:"results"`
+}
+
+// payeeGroup collects the rows of one payee.
+type payeeGroup struct {
+	taxID  string
+	row    map[string]string // first row, for the payee details
+	rows   []int
+	income map[string]*incomeSum
+	err    error
+}
+
+type incomeSum struct {
+	datePaid    string
+	amountPaid  int64
+	taxWithheld int64
+}
+
+func runBatch(args []string, _ io.Reader, _, stderr io.Writer) int {
+	fs := newFlagSet("batch", stderr)
+	inputPath := fs.String("input", "", "ไฟล์ CSV หรือ XLSX หนึ่งแถวต่อเงินได้หนึ่งประเภทของผู้ถูกหักภาษี (จำเป็น) / CSV or XLSX file, one row per payee per income type (required)")
+	sheet := fs.String("sheet", "", "ชื่อ sheet ใน XLSX (ค่าเริ่มต้น: sheet แรก) / XLSX worksheet name (default: first sheet)")
+	mappingPath := fs.String("mapping", "", "ไฟล์ mapping JSON (จำเป็น) / JSON mapping file (required)")
+	outDir := fs.String("out-dir", "certificates", "โฟลเดอร์สำหรับ PDF หนึ่งไฟล์ต่อผู้ถูกหักภาษี / Directory for one PDF per payee")
+	mergePath := fs.String("merge", "", "รวมทุกฉบับเป็น PDF ไฟล์เดียวแทน --out-dir / Write all certificates into this single PDF instead of --out-dir")
+	reportPath := fs.String("report", "", "เขียนสรุปผลเป็น JSON / Write a JSON summary report to this file")
+	signPath := fs.String("signature", "", "ไฟล์รูปลายเซ็น (PNG) / Signature image file (PNG)")
+	sealPath := fs.String("seal", "", "ไฟล์รูปตราประทับ (PNG) / Company seal image file (PNG)")
+	sequencesPath := fs.String("sequences", "", "ไฟล์ JSON เก็บลำดับเลขที่ให้ชุดถัดไปนับต่อ (ค่าเริ่มต้น: เริ่มที่ 1 ทุกครั้ง) / JSON file keeping the number sequences for the next batch (default: start at 1 every run)")
+	if code, stop := parseFlags(fs, args); stop {
+		return code
+	}
+	if *inputPath == "" || *mappingPath == "" {
+		fmt.Fprintln(stderr, "batch: --input and --mapping are required")
+		fs.Usage()
+		return exitInvalid
+	}
+
+	mapping, err := readMapping(*mappingPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "read mapping: %v\n", err)
+		return exitInvalid
+	}
+	numbering := &pdf50tawi.Numbering{
+		BookFormat:     mapping.Numbering.BookFormat,
+		DocumentFormat: mapping.Numbering.DocumentFormat,
+		Store:          pdf50tawi.NewMemorySequenceStore(),
+	}
+	if *sequencesPath != "" {
+		if numbering.Store, err = openFileSequenceStore(*sequencesPath); err != nil {
+			fmt.Fprintf(stderr, "read sequences: %v\n", err)
+			return exitInvalid
+		}
+	}
+	records, err := readRecords(*inputPath, *sheet)
+	if err != nil {
+		fmt.Fprintf(stderr, "read input: %v\n", err)
+		return exitInvalid
+	}
+	groups, err := groupRows(records, mapping)
+	if err != nil {
+		fmt.Fprintf(stderr, "read input: %v\n", err)
+		return exitInvalid
+	}
+
+	// Images are read once and handed to every certificate.
+	signData, err := readOptionalFile(*signPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "load signature: %v\n", err)
+		return exitInvalid
+	}
+	sealData, err := readOptionalFile(*sealPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "load seal: %v\n", err)
+		return exitInvalid
+	}
+
+	if *mergePath == "" {
+		if err := os.MkdirAll(*outDir, 0o755); err != nil {
+			fmt.Fprintf(stderr, "create output directory: %v\n", err)
+			return exitFailure
+		}
+	}
+
+	var report batchReport
+	var merged [][]byte
+	for _, g := range groups {
+		res := batchResult{PayeeTaxID: g.taxID, PayeeName: g.row[mapping.Columns.PayeeName], Rows: g.rows}
+		pdf, err := issueGroup(context.Background(), g, mapping, numbering, signData, sealData, &res)
+		if err != nil {
+			res.Error = err.Error()
+			var ve *pdf50tawi.ValidationError
+			if errors.As(err, &ve) {
+				res.Issues = ve.Issues
+			}
+			report.Failed++
+			report.Results = append(report.Results, res)
+			continue
+		}
+
+		if *mergePath != "" {
+			merged = append(merged, pdf)
+		} else {
+			res.File = filepath.Join(*outDir, certificateFileName(res.DocumentNumber, g.taxID))
+			if err := os.WriteFile(res.File, pdf, 0o644); err != nil {
+				res.Error, res.File = err.Error(), ""
+				report.Failed++
+				report.Results = append(report.Results, res)
+				continue
+			}
+		}
+		report.Issued++
+		report.Results = append(report.Results, res)
+	}
+
+	if *mergePath != "" && len(merged) > 0 {
+		var buf bytes.Buffer
+		if err := pdf50tawi.MergePDFs(&buf, merged...); err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitFailure
+		}
+		if err := os.WriteFile(*mergePath, buf.Bytes(), 0o644); err != nil {
+			fmt.Fprintf(stderr, "write merged PDF: %v\n", err)
+			return exitFailure
+		}
+		report.Merged = *mergePath
+	}
+
+	printBatchReport(stderr, report)
+	if *reportPath != "" {
+		data, _ := json.MarshalIndent(report, "", "  ")
+		if err := os.WriteFile(*reportPath, append(data, '\n'), 0o644); err != nil {
+			fmt.Fprintf(stderr, "write report: %v\n", err)
+			return exitFailure
+		}
+	}
+	if report.Failed > 0 {
+		return exitFailure
+	}
+	return exitOK
+}
+
+func readMapping(path string) (batchMapping, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return batchMapping{}, err
+	}
+	var m batchMapping
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&m); err != nil {
+		return batchMapping{}, err
+	}
+	if m.Columns.PayeeTaxID == "" {
+		return batchMapping{}, errors.New(`columns["payee.taxId"] is required`)
+	}
+	if m.Columns.AmountPaid == "" || m.Columns.TaxWithheld == "" {
+		return batchMapping{}, errors.New(`columns["amountPaid"] and columns["taxWithheld"] are required`)
+	}
+	if m.Columns.IncomeType == "" && m.DefaultIncomeType == "" {
+		return batchMapping{}, errors.New(`either columns["incomeType"] or defaultIncomeType is required`)
+	}
+	n := &m.Numbering
+	if n.DocumentFormat == "" {
+		n.DocumentFormat = "{seq:03}"
+	}
+	numbering := pdf50tawi.Numbering{BookFormat: n.BookFormat, DocumentFormat: n.DocumentFormat}
+	if err := numbering.Check(); err != nil {
+		return batchMapping{}, fmt.Errorf("numbering: %w", err)
+	}
+	return m, nil
+}
+
+// readRecords returns the rows of a CSV or XLSX file, header first.
+func readRecords(path, sheet string) ([][]string, error) {
+	if strings.EqualFold(filepath.Ext(path), ".xlsx") {
+		return readXLSX(path, sheet)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	r := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\ufeff"))))
+	r.FieldsPerRecord = -1
+	return r.ReadAll()
+}
+
+// groupRows groups data rows by payee tax ID in order of first appearance.
+// A row that cannot be read marks its payee as failed rather than stopping
+// the batch.
+func groupRows(records [][]string, m batchMapping) ([]*payeeGroup, error) {
+	if len(records) == 0 {
+		return nil, errors.New("no header row")
+	}
+	header := make(map[string]int)
+	for i, h := range records[0] {
+		header[strings.TrimSpace(h)] = i
+	}
+	for _, col := range []string{m.Columns.PayeeTaxID, m.Columns.PayeeTaxID10Digit, m.Columns.PayeeName,
+		m.Columns.PayeeAddress, m.Columns.PayeeSequenceNumber, m.Columns.IncomeType,
+		m.Columns.DatePaid, m.Columns.AmountPaid, m.Columns.TaxWithheld} {
+		if _, ok := header[col]; col != "" && !ok {
+			return nil, fmt.Errorf("column %q not found in header", col)
+		}
+	}
+
+	var groups []*payeeGroup
+	byTaxID := make(map[string]*payeeGroup)
+	for i, rec := range records[1:] {
+		rowNum := i + 2 // spreadsheet row, header is row 1
+		row := make(map[string]string, len(header))
+		blank := true
+		for name, idx := range header {
+			if idx < len(rec) {
+				row[name] = strings.TrimSpace(rec[idx])
+				blank = blank && row[name] == ""
+			}
+		}
+		if blank {
+			continue
+		}
+
+		taxID := strings.ReplaceAll(row[m.Columns.PayeeTaxID], " ", "")
+		g, ok := byTaxID[taxID]
+		if !ok {
+			g = &payeeGroup{taxID: taxID, row: row, income: make(map[string]*incomeSum)}
+			byTaxID[taxID] = g
+			groups = append(groups, g)
+		}
+		g.rows = append(g.rows, rowNum)
+		if g.err != nil {
+			continue
+		}
+		if taxID == "" {
+			g.err = fmt.Errorf("row %d: missing payee tax ID", rowNum)
+			continue
+		}
+		if err := g.add(row, m); err != nil {
+			g.err = fmt.Errorf("row %d: %w", rowNum, err)
+		}
+	}
+	return groups, nil
+}
+
+func (g *payeeGroup) add(row map[string]string, m batchMapping) error {
+	key := row[m.Columns.IncomeType]
+	if mapped, ok := m.IncomeTypes[key]; ok {
+		key = mapped
+	}
+	if key == "" {
+		key = m.DefaultIncomeType
+	}
+	if incomeField(&pdf50tawi.TaxInfo{}, key) == nil {
+		return fmt.Errorf("unknown income type %q", key)
+	}
+
+	amount, err := pdf50tawi.ParseAmount(row[m.Columns.AmountPaid])
+	if err != nil {
+		return fmt.Errorf("%s: %w", m.Columns.AmountPaid, err)
+	}
+	tax, err := pdf50tawi.ParseAmount(row[m.Columns.TaxWithheld])
+	if err != nil {
+		return fmt.Errorf("%s: %w", m.Columns.TaxWithheld, err)
+	}
+
+	sum, ok := g.income[key]
+	if !ok {
+		sum = &incomeSum{}
+		g.income[key] = sum
+	}
+	sum.amountPaid += amount
+	sum.taxWithheld += tax
+	if d := row[m.Columns.DatePaid]; d != "" {
+		sum.datePaid = d // the latest row wins
+	}
+	return nil
+}
+
+// issueGroup builds, validates, numbers and renders the certificate for g.
+// A number is taken only once the certificate is valid. res receives the
+// document number.
+func issueGroup(ctx context.Context, g *payeeGroup, m batchMapping, numbering *pdf50tawi.Numbering, signData, sealData []byte, res *batchResult) ([]byte, error) {
+	if g.err != nil {
+		return nil, g.err
+	}
+
+	taxInfo := m.Template
+	taxInfo.Payee.TaxID = g.taxID
+	setIfPresent(&taxInfo.Payee.TaxID10Digit, g.row, m.Columns.PayeeTaxID10Digit)
+	setIfPresent(&taxInfo.Payee.Name, g.row, m.Columns.PayeeName)
+	setIfPresent(&taxInfo.Payee.Address, g.row, m.Columns.PayeeAddress)
+	setIfPresent(&taxInfo.Payee.SequenceNumber, g.row, m.Columns.PayeeSequenceNumber)
+
+	var totalPaid, totalTax int64
+	for key, sum := range g.income {
+		*incomeField(&taxInfo, key) = pdf50tawi.IncomeDetail{
+			DatePaid:    sum.datePaid,
+			AmountPaid:  pdf50tawi.FormatAmount(sum.amountPaid),
+			TaxWithheld: pdf50tawi.FormatAmount(sum.taxWithheld),
+		}
+		totalPaid += sum.amountPaid
+		totalTax += sum.taxWithheld
+	}
+	taxInfo.Totals = pdf50tawi.Totals{
+		TotalAmountPaid:         pdf50tawi.FormatAmount(totalPaid),
+		TotalTaxWithheld:        pdf50tawi.FormatAmount(totalTax),
+		TotalTaxWithheldInWords: pdf50tawi.BahtText(totalTax),
+	}
+
+	if err := pdf50tawi.ValidateTaxInfo(taxInfo); err != nil {
+		return nil, err
+	}
+	if _, err := numbering.Assign(ctx, &taxInfo); err != nil {
+		return nil, err
+	}
+	res.DocumentNumber = taxInfo.DocumentDetails.DocumentNumber
+
+	var buf bytes.Buffer
+	if err := pdf50tawi.IssueWHTCertificatePDF(&buf, taxInfo, optionalReader(signData), optionalReader(sealData)); err != nil {
+		return nil, fmt.Errorf("generate certificate: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// incomeField returns the income line of t named by its JSON key, or nil.
+func incomeField(t *pdf50tawi.TaxInfo, key string) *pdf50tawi.IncomeDetail {
+	switch key {
+	case "income40_1":
+		return &t.Income40_1
+	case "income40_2":
+		return &t.Income40_2
+	case "income40_3":
+		return &t.Income40_3
+	case "income40_4A":
+		return &t.Income40_4A
+	case "income40_4B_1_1":
+		return &t.Income40_4B_1_1
+	case "income40_4B_1_2":
+		return &t.Income40_4B_1_2
+	case "income40_4B_1_3":
+		return &t.Income40_4B_1_3
+	case "income40_4B_1_4":
+		return &t.Income40_4B_1_4
+	case "income40_4B_2_1":
+		return &t.Income40_4B_2_1
+	case "income40_4B_2_2":
+		return &t.Income40_4B_2_2
+	case "income40_4B_2_3":
+		return &t.Income40_4B_2_3
+	case "income40_4B_2_4":
+		return &t.Income40_4B_2_4
+	case "income40_4B_2_5":
+		return &t.Income40_4B_2_5
+	case "income5":
+		return &t.Income5
+	case "income6":
+		return &t.Income6
+	}
+	return nil
+}
+
+func setIfPresent(dst *string, row map[string]string, column string) {
+	if column != "" && row[column] != "" {
+		*dst = row[column]
+	}
+}
+
+// certificateFileName builds a file name safe on every platform.
+func certificateFileName(documentNumber, taxID string) string {
+	clean := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) || r < ' ' {
+			return '-'
+		}
+		return r
+	}, documentNumber)
+	return clean + "_" + taxID + ".pdf"
+}
+
+func readOptionalFile(path string) ([]byte, error) {
+	if path == "" {
+		return nil, nil
+	}
+	return os.ReadFile(path)
+}
+
+func optionalReader(data []byte) io.Reader {
+	if data == nil {
+		return nil
+	}
+	return bytes.NewReader(data)
+}
+
+func printBatchReport(w io.Writer, r batchReport) {
+	fmt.Fprintf(w, "issued %d certificate(s), %d failed\n", r.Issued, r.Failed)
+	if r.Merged != "" {
+		fmt.Fprintf(w, "merged PDF written to %s\n", r.Merged)
+	}
+	for _, res := range r.Results {
+		if res.Error == "" {
+			continue
+		}
+		fmt.Fprintf(w, "  payee %s (rows %s): %s\n", res.PayeeTaxID, joinInts(res.Rows), res.Error)
+	}
+}
+
+func joinInts(ns []int) string {
+	s := make([]string, len(ns))
+	for i, n := range ns {
+		s[i] = fmt.Sprint(n)
+	}
+	return strings.Join(s, ", ")
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/AnuchitO/pdf50tawi"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func testMapping() batchMapping {
+	var m batchMapping
+	m.Columns = batchColumns{
+		PayeeTaxID:  "taxId",
+		PayeeName:   "name",
+		IncomeType:  "type",
+		DatePaid:    "date",
+		AmountPaid:  "amount",
+		TaxWithheld: "tax",
+	}
+	m.IncomeTypes = map[string]string{"เงินเดือน": "income40_1", "โบนัส": "income40_1"}
+	m.DefaultIncomeType = "income40_2"
+	m.Numbering.DocumentFormat = "{seq:03}"
+	return m
+}
+
+func TestReadMapping(t *testing.T) {
+	const columns = `"columns": {"payee.taxId": "a", "amountPaid": "b", "taxWithheld": "c"}, "defaultIncomeType": "income40_1"`
+	testCases := []struct {
+		name, json string
+		wantErr    string // empty for success
+		wantFormat string
+	}{
+		{"Defaults", `{` + columns + `}`, "", "{seq:03}"},
+		{"DocumentFormat", `{` + columns + `, "numbering": {"bookFormat": "{yyyy}", "documentFormat": "WHT-{seq:04}"}}`, "", "WHT-{seq:04}"},
+		{"UnknownPlaceholder", `{` + columns + `, "numbering": {"documentFormat": "WHT-{n}"}}`, "unknown placeholder {n}", ""},
+		{"BookFormat", `{` + columns + `, "numbering": {"bookFormat": "{seq"}}`, "book number format", ""},
+		{"FmtVerb", `{` + columns + `, "numbering": {"format": "WHT-%04d"}}`, "unknown field", ""},
+		{"NoTaxID", `{"columns": {"amountPaid": "b", "taxWithheld": "c"}, "defaultIncomeType": "income40_1"}`, "payee.taxId", ""},
+		{"NoIncomeType", `{"columns": {"payee.taxId": "a", "amountPaid": "b", "taxWithheld": "c"}}`, "incomeType", ""},
+		{"UnknownField", `{` + columns + `, "colums": {}}`, "unknown field", ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := readMapping(writeFile(t, "mapping.json", tc.json))
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("error %v, want %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.Numbering.DocumentFormat != tc.wantFormat {
+				t.Fatalf("numbering %+v", m.Numbering)
+			}
+		})
+	}
+}
+
+func TestReadRecordsCSV(t *testing.T) {
+	path := writeFile(t, "payroll.csv", "\ufeffชื่อ,จำนวนเงิน\n\"นาย ก\",\"1,000.00\"\nนาย ข\n")
+	got, err := readRecords(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{"ชื่อ", "จำนวนเงิน"}, {"นาย ก", "1,000.00"}, {"นาย ข"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestGroupRows(t *testing.T) {
+	records := [][]string{
+		{"taxId", " name ", "type", "date", "amount", "tax"},
+		{"3 2109 87654 32 1", "นาง ก", "เงินเดือน", "2568", "360,000.00", "12,000.00"},
+		{"1103700012345", "นาย ข", "", "", "1000", "30"},
+		{"", "", "", "", "", ""},
+		{"3210987654321", "นาง ก", "โบนัส", "2569", "60,000.00", "3,000.00"},
+		{"5555555555555", "นาย ค", "เงินเดือน", "", "หนึ่งพัน", "0"},
+		{"5555555555555", "นาย ค", "เงินเดือน", "", "1000", "0"},
+		{"6666666666666", "นาย ง", "ค่าเช่า", "", "1000", "50"},
+		{"", "นาย จ", "", "", "1000", "30"},
+		{"7777777777777", "นาย ฉ"}, // short row: no amount
+	}
+	groups, err := groupRows(records, testMapping())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type income struct {
+		date        string
+		amount, tax int64
+	}
+	testCases := []struct {
+		taxID   string
+		rows    []int
+		income  map[string]income
+		wantErr string
+	}{
+		{"3210987654321", []int{2, 5}, map[string]income{"income40_1": {"2569", 42000000, 1500000}}, ""},
+		{"1103700012345", []int{3}, map[string]income{"income40_2": {"", 100000, 3000}}, ""},
+		{"5555555555555", []int{6, 7}, nil, "row 6: amount"},
+		{"6666666666666", []int{8}, nil, `row 8: unknown income type "ค่าเช่า"`},
+		{"", []int{9}, nil, "row 9: missing payee tax ID"},
+		{"7777777777777", []int{10}, nil, "row 10: amount"},
+	}
+	if len(groups) != len(testCases) {
+		t.Fatalf("%d groups, want %d", len(groups), len(testCases))
+	}
+	for i, tc := range testCases {
+		g := groups[i]
+		if g.taxID != tc.taxID || !reflect.DeepEqual(g.rows, tc.rows) {
+			t.Errorf("group %d: payee %q rows %v, want %q rows %v", i, g.taxID, g.rows, tc.taxID, tc.rows)
+			continue
+		}
+		if tc.wantErr != "" {
+			if g.err == nil || !strings.Contains(g.err.Error(), tc.wantErr) {
+				t.Errorf("payee %q: error %v, want %q", tc.taxID, g.err, tc.wantErr)
+			}
+			continue
+		}
+		if g.err != nil {
+			t.Errorf("payee %q: %v", tc.taxID, g.err)
+			continue
+		}
+		got := make(map[string]income)
+		for key, sum := range g.income {
+			got[key] = income{sum.datePaid, sum.amountPaid, sum.taxWithheld}
+		}
+		if !reflect.DeepEqual(got, tc.income) {
+			t.Errorf("payee %q: income %v, want %v", tc.taxID, got, tc.income)
+		}
+	}
+
+	if g := groups[0]; g.row["name"] != "นาง ก" {
+		t.Errorf("payee details from %v, want the first row", g.row)
+	}
+	if _, err := groupRows(records[:1], batchMapping{Columns: batchColumns{PayeeTaxID: "เลขประจำตัว"}}); err == nil {
+		t.Error("missing column: expected an error")
+	}
+	if _, err := groupRows(nil, testMapping()); err == nil {
+		t.Error("no header row: expected an error")
+	}
+}
+
+func TestIssueGroup(t *testing.T) {
+	m := testMapping()
+	m.Template = demoTaxInfo()
+	m.Template.Income40_1, m.Template.Income40_2 = pdf50tawi.IncomeDetail{}, pdf50tawi.IncomeDetail{}
+	m.Template.DocumentDetails = pdf50tawi.DocumentDetails{}
+	m.Numbering.BookFormat, m.Numbering.DocumentFormat = "{yyyy}", "WHT-{seq:04}"
+	numbering := &pdf50tawi.Numbering{
+		BookFormat:     m.Numbering.BookFormat,
+		DocumentFormat: m.Numbering.DocumentFormat,
+		Store:          pdf50tawi.NewMemorySequenceStore(),
+	}
+	groups, err := groupRows([][]string{
+		{"taxId", "name", "type", "date", "amount", "tax"},
+		{"3210987654321", "นาง ก", "เงินเดือน", "2568", "1,000.50", "30.25"},
+		{"3210987654321", "นาง ก", "", "2568", "200", "6"},
+	}, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	var res batchResult
+	pdf, err := issueGroup(ctx, groups[0], m, numbering, nil, nil, &res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(pdf, []byte("%PDF")) || res.DocumentNumber != "WHT-0001" {
+		t.Fatalf("document number %q, %d bytes", res.DocumentNumber, len(pdf))
+	}
+
+	// Neither a failed group nor an invalid certificate takes a number.
+	failed := *groups[0]
+	failed.err = os.ErrInvalid
+	if _, err := issueGroup(ctx, &failed, m, numbering, nil, nil, &res); err != os.ErrInvalid {
+		t.Fatalf("failed group: %v", err)
+	}
+	invalid := m
+	invalid.Template.Payer.Name = ""
+	var ve *pdf50tawi.ValidationError
+	if _, err := issueGroup(ctx, groups[0], invalid, numbering, nil, nil, &res); !errors.As(err, &ve) {
+		t.Fatalf("invalid certificate: %v", err)
+	}
+	if _, err := issueGroup(ctx, groups[0], m, numbering, nil, nil, &res); err != nil || res.DocumentNumber != "WHT-0002" {
+		t.Fatalf("next document number %q, %v", res.DocumentNumber, err)
+	}
+}
+
+func TestRunBatch(t *testing.T) {
+	dir := t.TempDir()
+	sequences := filepath.Join(dir, "sequences.json")
+	batch := func(wantNumbers ...string) {
+		t.Helper()
+		report := filepath.Join(dir, "report.json")
+		var stdout, stderr bytes.Buffer
+		code := run([]string{"batch",
+			"--input", "examples/batch-payroll.csv",
+			"--mapping", "examples/batch-mapping.json",
+			"--out-dir", dir,
+			"--report", report,
+			"--sequences", sequences,
+		}, nil, &stdout, &stderr)
+		if code != exitOK {
+			t.Fatalf("exit %d: %s", code, stderr.String())
+		}
+
+		data, err := os.ReadFile(report)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var r batchReport
+		if err := json.Unmarshal(data, &r); err != nil {
+			t.Fatal(err)
+		}
+		if r.Issued != 2 || r.Failed != 0 || r.Results[0].DocumentNumber != wantNumbers[0] || r.Results[1].DocumentNumber != wantNumbers[1] {
+			t.Fatalf("report %+v, want %v", r, wantNumbers)
+		}
+		for _, res := range r.Results {
+			if pdf, err := os.ReadFile(res.File); err != nil || !bytes.HasPrefix(pdf, []byte("%PDF")) {
+				t.Fatalf("%s: %v", res.File, err)
+			}
+		}
+	}
+	// The second batch continues the numbers in the sequences file.
+	batch("WHT-0001", "WHT-0002")
+	batch("WHT-0003", "WHT-0004")
+}
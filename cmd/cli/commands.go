@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/AnuchitO/pdf50tawi"
+)
+
+// version is set at build time with
+//
+//	go build -ldflags "-X main.version=v1.2.3" ./cmd/cli
+//
+// and otherwise taken from the module version in the build info.
+var version = ""
+
+// validateResult is the --json output of validate for one file.
+type validateResult struct {
+	File   string                      `json:"file"`
+	Valid  bool                        `json:"valid"`
+	Error  string                      `json:"error,omitempty"` // unreadable file
+	Issues []pdf50tawi.ValidationIssue `json:"issues,omitempty"`
+}
+
+func runValidate(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := newFlagSet("validate", stderr)
+	asJSON := fs.Bool("json", false, "แสดงผลเป็น JSON / Print the results as JSON")
+	if code, stop := parseFlags(fs, args); stop {
+		return code
+	}
+	if fs.NArg() == 0 {
+		fmt.Fprintln(stderr, `validate: no files given (use "-" for stdin)`)
+		fs.Usage()
+		return exitInvalid
+	}
+	// stdin can be read only once.
+	stdinArgs := 0
+	for _, path := range fs.Args() {
+		if path == "-" {
+			stdinArgs++
+		}
+	}
+	if stdinArgs > 1 {
+		fmt.Fprintln(stderr, `validate: "-" (stdin) may be given only once`)
+		return exitInvalid
+	}
+
+	code := exitOK
+	results := make([]validateResult, 0, fs.NArg())
+	for _, path := range fs.Args() {
+		res := validateResult{File: path, Valid: true}
+		taxInfo, err := readTaxInfo(path, stdin)
+		if err == nil {
+			err = pdf50tawi.ValidateTaxInfo(taxInfo)
+		}
+		if err != nil {
+			res.Valid = false
+			var ve *pdf50tawi.ValidationError
+			if errors.As(err, &ve) {
+				res.Issues = ve.Issues
+			} else {
+				res.Error = err.Error()
+			}
+			code = exitInvalid
+		}
+		results = append(results, res)
+	}
+
+	if *asJSON {
+		if failed := writeJSON(stdout, stderr, results); failed != exitOK {
+			return failed
+		}
+		return code
+	}
+	for _, res := range results {
+		switch {
+		case res.Valid:
+			fmt.Fprintf(stdout, "%s: OK\n", res.File)
+		case len(res.Issues) > 0:
+			fmt.Fprintf(stdout, "%s: validation failed (%d):\n", res.File, len(res.Issues))
+			for _, issue := range res.Issues {
+				fmt.Fprintf(stdout, "  %s: %s\n", issue.Field, issue.Message)
+			}
+		default:
+			fmt.Fprintf(stdout, "%s: %s\n", res.File, res.Error)
+		}
+	}
+	return code
+}
+
+func runInspect(args []string, _ io.Reader, stdout, stderr io.Writer) int {
+	fs := newFlagSet("inspect", stderr)
+	password := fs.String("password", "", "รหัสผ่านของ PDF ที่เข้ารหัส / Password of an encrypted PDF")
+	asJSON := fs.Bool("json", false, "แสดงผลเป็น JSON / Print the metadata as JSON")
+	if code, stop := parseFlags(fs, args); stop {
+		return code
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitInvalid
+	}
+
+	path := fs.Arg(0)
+	f, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitFailure
+	}
+	defer f.Close()
+	m, err := pdf50tawi.ReadMetadata(f, *password)
+	if err != nil {
+		if errors.Is(err, pdf50tawi.ErrNoMetadata) {
+			fmt.Fprintf(stderr, "%s: %v (render with --metadata to embed it)\n", path, err)
+		} else {
+			fmt.Fprintf(stderr, "%s: %v\n", path, err)
+		}
+		return exitFailure
+	}
+
+	if *asJSON {
+		return writeJSON(stdout, stderr, m)
+	}
+	template := m.Template
+	if template != pdf50tawi.TemplateVersion() {
+		template += fmt.Sprintf(" (this build uses %s)", pdf50tawi.TemplateVersion())
+	}
+	fmt.Fprintf(stdout, "file:     %s\n", path)
+	fmt.Fprintf(stdout, "version:  %s\n", m.Version)
+	fmt.Fprintf(stdout, "template: %s\n", template)
+	fmt.Fprintln(stdout, "taxInfo:")
+	return writeJSON(stdout, stderr, m.TaxInfo)
+}
+
+// templateLayout is the layout.json written by template export.
+type templateLayout struct {
+	TemplateVersion string                  `json:"templateVersion"`
+	Fields          []pdf50tawi.LayoutField `json:"fields"`
+}
+
+func runTemplate(args []string, _ io.Reader, stdout, stderr io.Writer) int {
+	fs := newFlagSet("template export", stderr)
+	outDir := fs.String("out-dir", ".", "โฟลเดอร์ปลายทาง / Output directory")
+	if len(args) == 0 || args[0] != "export" {
+		fs.Usage()
+		return exitInvalid
+	}
+	if code, stop := parseFlags(fs, args[1:]); stop {
+		return code
+	}
+
+	pdf, err := pdf50tawi.TemplatePDF()
+	if err != nil {
+		fmt.Fprintf(stderr, "read template: %v\n", err)
+		return exitFailure
+	}
+	layout, err := json.MarshalIndent(templateLayout{
+		TemplateVersion: pdf50tawi.TemplateVersion(),
+		Fields:          pdf50tawi.Layout(),
+	}, "", "  ")
+	if err != nil {
+		fmt.Fprintf(stderr, "encode layout: %v\n", err)
+		return exitFailure
+	}
+
+	if err := os.MkdirAll(*outDir, 0o755); err != nil {
+		fmt.Fprintf(stderr, "create output directory: %v\n", err)
+		return exitFailure
+	}
+	for _, f := range []struct {
+		name string
+		data []byte
+	}{
+		{"tax50tawiTemplate.pdf", pdf},
+		{"layout.json", append(layout, '\n')},
+	} {
+		path := filepath.Join(*outDir, f.name)
+		if err := os.WriteFile(path, f.data, 0o644); err != nil {
+			fmt.Fprintf(stderr, "write output: %v\n", err)
+			return exitFailure
+		}
+		fmt.Fprintln(stdout, path)
+	}
+	return exitOK
+}
+
+func runVersion(args []string, _ io.Reader, stdout, stderr io.Writer) int {
+	fs := newFlagSet("version", stderr)
+	if code, stop := parseFlags(fs, args); stop {
+		return code
+	}
+	v := version
+	if info, ok := debug.ReadBuildInfo(); ok && v == "" {
+		v = info.Main.Version
+	}
+	if v == "" || v == "(devel)" {
+		v = "dev"
+	}
+	fmt.Fprintf(stdout, "pdf50tawi %s\n", v)
+	fmt.Fprintf(stdout, "template  %s\n", pdf50tawi.TemplateVersion())
+	fmt.Fprintf(stdout, "go        %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	return exitOK
+}
+
+func writeJSON(stdout, stderr io.Writer, v any) int {
+	enc := json.NewEncoder(stdout)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		fmt.Fprintf(stderr, "write output: %v\n", err)
+		return exitFailure
+	}
+	return exitOK
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/AnuchitO/pdf50tawi"
+)
+
+func runSchema(args []string, _ io.Reader, stdout, stderr io.Writer) int {
+	fs := newFlagSet("schema", stderr)
+	outputPath := fs.String("output", "-", `ไฟล์ผลลัพธ์ หรือ "-" สำหรับ stdout / Output file, or "-" for stdout`)
+	if code, stop := parseFlags(fs, args); stop {
+		return code
+	}
+	return writeOutput(*outputPath, pdf50tawi.TaxInfoSchema(), stdout, stderr)
+}
+
+func runExample(args []string, _ io.Reader, stdout, stderr io.Writer) int {
+	fs := newFlagSet("example", stderr)
+	outputPath := fs.String("output", "-", `ไฟล์ผลลัพธ์ หรือ "-" สำหรับ stdout / Output file, or "-" for stdout`)
+	minimal := fs.Bool("minimal", false, "แสดงเฉพาะ key ที่มีค่า / Only the keys that have a value")
+	request := fs.Bool("request", false, `ห่อด้วย {"taxInfo": ...} สำหรับ REST API / Wrap in {"taxInfo": ...} for the REST API`)
+	if code, stop := parseFlags(fs, args); stop {
+		return code
+	}
+
+	var v any = exampleTaxInfo()
+	if *minimal {
+		data, _ := json.Marshal(v)
+		var m any
+		_ = json.Unmarshal(data, &m)
+		v = prune(m)
+	}
+	if *request {
+		v = map[string]any{"taxInfo": v}
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		fmt.Fprintf(stderr, "encode example: %v\n", err)
+		return exitFailure
+	}
+	return writeOutput(*outputPath, append(data, '\n'), stdout, stderr)
+}
+
+// exampleTaxInfo is a valid single-payment certificate: a salary paid to one
+// employee, filed with ภ.ง.ด. 1ก. Every other key is present but empty.
+func exampleTaxInfo() pdf50tawi.TaxInfo {
+	const paid, withheld = 36000000, 1200000 // satang
+	return pdf50tawi.TaxInfo{
+		DocumentDetails: pdf50tawi.DocumentDetails{BookNumber: "001", DocumentNumber: "2568-001"},
+		Payer: pdf50tawi.Payer{
+			TaxID:   "1234567890123",
+			Name:    "บริษัท ตัวอย่าง จำกัด",
+			Address: "123 ถนนสุขุมวิท แขวงคลองตัน เขตวัฒนา กรุงเทพฯ 10110",
+		},
+		Payee: pdf50tawi.Payee{
+			TaxID:          "3210987654321",
+			Name:           "นางสาวสมหญิง ใจดี",
+			Address:        "55 ถนนพหลโยธิน แขวงสามเสนใน เขตพญาไท กรุงเทพฯ 10400",
+			SequenceNumber: "1",
+			Pnd_1a:         true,
+		},
+		Income40_1: pdf50tawi.IncomeDetail{
+			DatePaid:    "2568",
+			AmountPaid:  pdf50tawi.FormatAmount(paid),
+			TaxWithheld: pdf50tawi.FormatAmount(withheld),
+		},
+		Totals: pdf50tawi.Totals{
+			TotalAmountPaid:         pdf50tawi.FormatAmount(paid),
+			TotalTaxWithheld:        pdf50tawi.FormatAmount(withheld),
+			TotalTaxWithheldInWords: pdf50tawi.BahtText(withheld),
+		},
+		OtherPayments:   pdf50tawi.OtherPayments{SocialSecurityFund: "9,000.00"},
+		WithholdingType: pdf50tawi.WithholdingType{WithholdingTax: true},
+		Certification: pdf50tawi.Certification{
+			DateOfIssuance: pdf50tawi.DateOfIssuance{Day: "15", Month: "มกราคม", Year: "2569"},
+		},
+	}
+}
+
+// prune drops empty strings, false and objects left empty from decoded JSON.
+func prune(v any) any {
+	m, ok := v.(map[string]any)
+	if !ok {
+		return v
+	}
+	out := make(map[string]any, len(m))
+	for k, child := range m {
+		child = prune(child)
+		switch c := child.(type) {
+		case string:
+			if c == "" {
+				continue
+			}
+		case bool:
+			if !c {
+				continue
+			}
+		case map[string]any:
+			if len(c) == 0 {
+				continue
+			}
+		}
+		out[k] = child
+	}
+	return out
+}
+
+// writeOutput writes data to path, or to stdout when path is "-".
+func writeOutput(path string, data []byte, stdout, stderr io.Writer) int {
+	var err error
+	if path == "-" {
+		_, err = stdout.Write(data)
+	} else {
+		err = os.WriteFile(path, data, 0o644)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "write output: %v\n", err)
+		return exitFailure
+	}
+	return exitOK
+}
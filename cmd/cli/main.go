@@ -1,60 +1,292 @@
 package main
 
+// pdf50tawi — command-line tool for หนังสือรับรองการหักภาษี ณ ที่จ่าย (50 ทวิ).
+//
 // Strategy: CLI — images supplied as local file paths via flags.
 //
 // Usage:
 //
-//	go run ./cmd/cli \
+//	go run ./cmd/cli render \
+//	  --input     taxinfo.json \
 //	  --signature path/to/signature.png \
 //	  --seal      path/to/seal.png \
 //	  --output    certificate.pdf
+//
+//	go run ./cmd/cli render --demo --output sample.pdf
+//	go run ./cmd/cli validate taxinfo.json more.json
+//	go run ./cmd/cli inspect certificate.pdf
+//	go run ./cmd/cli batch --input payroll.csv --mapping mapping.json
+//	go run ./cmd/cli schema > taxinfo.schema.json
+//	go run ./cmd/cli example --minimal > taxinfo.json
+//	go run ./cmd/cli template export --out-dir form
+//	go run ./cmd/cli version
+//
+// Without a command the flags are those of render, so existing scripts that
+// call `go run ./cmd/cli --input ...` keep working. --input and --output
+// accept "-" for stdin and stdout.
+//
+// Exit codes: 0 success, 1 generation or I/O failure, 2 invalid usage or
+// invalid tax info.
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
-	"log"
 	"os"
+	"strings"
 
 	"github.com/AnuchitO/pdf50tawi"
 )
 
+const (
+	exitOK      = 0
+	exitFailure = 1
+	exitInvalid = 2
+)
+
+// command is one subcommand of the CLI.
+type command struct {
+	name string
+	args string // positional arguments shown in the usage line
+	th   string // one-line description in Thai
+	en   string // and in English
+	run  func(args []string, stdin io.Reader, stdout, stderr io.Writer) int
+}
+
+// commands is filled in init because the usage text of each command refers
+// back to the table.
+var commands []command
+
+func init() {
+	commands = []command{
+		{"render", "", "สร้าง PDF หนังสือรับรองจาก TaxInfo JSON", "Generate a certificate PDF from TaxInfo JSON", runRender},
+		{"validate", "<file.json>...", "ตรวจสอบไฟล์ TaxInfo JSON และแสดงรายการที่ผิด", "Validate TaxInfo JSON files and list the issues", runValidate},
+		{"inspect", "<certificate.pdf>", "แสดงข้อมูลที่ฝังไว้ในหนังสือรับรอง", "Print the metadata and TaxInfo embedded in a certificate", runInspect},
+		{"batch", "", "ออกหนังสือรับรองหลายฉบับจาก CSV/XLSX", "Issue certificates in bulk from a CSV/XLSX payroll export", runBatch},
+		{"schema", "", "แสดง JSON Schema ของ TaxInfo", "Print the JSON Schema of TaxInfo", runSchema},
+		{"example", "", "สร้างตัวอย่าง TaxInfo JSON", "Scaffold an example TaxInfo JSON payload", runExample},
+		{"template export", "", "ส่งออกแบบฟอร์มเปล่าและตำแหน่ง field", "Export the blank form and the field layout", runTemplate},
+		{"version", "", "แสดงเวอร์ชัน", "Print version information", runVersion},
+	}
+}
+
 func main() {
-	outputPath := flag.String("output", "certificate.pdf", "Output PDF file path")
-	signPath := flag.String("signature", "", "Signature image file path (PNG)")
-	sealPath := flag.String("seal", "", "Company seal image file path (PNG)")
-	flag.Parse()
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		return runRender(args, stdin, stdout, stderr)
+	}
+	switch name := args[0]; {
+	case name == "help" || name == "-h" || name == "-help" || name == "--help":
+		printUsage(stdout)
+		return exitOK
+	case strings.HasPrefix(name, "-"):
+		return runRender(args, stdin, stdout, stderr)
+	}
+	for _, c := range commands {
+		// Multi-word commands such as "template export" receive their
+		// remaining words as arguments.
+		if name, _, _ := strings.Cut(c.name, " "); name == args[0] {
+			return c.run(args[1:], stdin, stdout, stderr)
+		}
+	}
+	fmt.Fprintf(stderr, "unknown command %q\n\n", args[0])
+	printUsage(stderr)
+	return exitInvalid
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "pdf50tawi — ออกหนังสือรับรองการหักภาษี ณ ที่จ่าย (50 ทวิ) / Issue withholding tax certificates")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Usage: pdf50tawi <command> [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-17s %s\n  %-17s %s\n", c.name, c.th, "", c.en)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `ดู flag ของแต่ละคำสั่งด้วย "pdf50tawi <command> --help"`)
+	fmt.Fprintln(w, `Run "pdf50tawi <command> --help" for the flags of a command.`)
+}
+
+// newFlagSet returns the flag set of the named command with bilingual usage
+// text.
+func newFlagSet(name string, stderr io.Writer) *flag.FlagSet {
+	var c command
+	for _, cmd := range commands {
+		if cmd.name == name {
+			c = cmd
+		}
+	}
+	fs := flag.NewFlagSet("pdf50tawi "+name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		synopsis := "pdf50tawi " + c.name
+		if hasFlags(fs) {
+			synopsis += " [flags]"
+		}
+		if c.args != "" {
+			synopsis += " " + c.args
+		}
+		fmt.Fprintf(stderr, "Usage: %s\n\n  %s\n  %s\n", synopsis, c.th, c.en)
+		if hasFlags(fs) {
+			fmt.Fprintln(stderr, "\nFlags:")
+			fs.PrintDefaults()
+		}
+	}
+	return fs
+}
+
+func hasFlags(fs *flag.FlagSet) bool {
+	n := 0
+	fs.VisitAll(func(*flag.Flag) { n++ })
+	return n > 0
+}
 
+// parseFlags parses args and reports the exit code to return when the
+// command should stop: after --help or a bad flag.
+func parseFlags(fs *flag.FlagSet, args []string) (code int, stop bool) {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK, true
+		}
+		return exitInvalid, true
+	}
+	return exitOK, false
+}
+
+func runRender(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := newFlagSet("render", stderr)
+	inputPath := fs.String("input", "", `ไฟล์ TaxInfo JSON หรือ "-" สำหรับ stdin / TaxInfo JSON file, or "-" for stdin`)
+	demo := fs.Bool("demo", false, "ใช้ข้อมูลตัวอย่างแทน --input / Use the demo data instead of --input")
+	outputPath := fs.String("output", "certificate.pdf", `ไฟล์ PDF ผลลัพธ์ หรือ "-" สำหรับ stdout / Output PDF file, or "-" for stdout`)
+	signPath := fs.String("signature", "", "ไฟล์รูปลายเซ็น (PNG) / Signature image file (PNG)")
+	sealPath := fs.String("seal", "", "ไฟล์รูปตราประทับ (PNG) / Company seal image file (PNG)")
+	metadata := fs.Bool("metadata", false, "ฝัง TaxInfo ไว้ใน PDF สำหรับ inspect / Embed the TaxInfo in the PDF for inspect")
+	if code, stop := parseFlags(fs, args); stop {
+		return code
+	}
+
+	// A forgotten --input must not issue the sample payer's certificate.
+	switch {
+	case *inputPath == "" && !*demo:
+		fmt.Fprintln(stderr, "render: --input is required (or --demo for the sample data)")
+		fs.Usage()
+		return exitInvalid
+	case *inputPath != "" && *demo:
+		fmt.Fprintln(stderr, "render: --input and --demo cannot be used together")
+		return exitInvalid
+	}
 	taxInfo := demoTaxInfo()
+	if !*demo {
+		var err error
+		if taxInfo, err = readTaxInfo(*inputPath, stdin); err != nil {
+			fmt.Fprintf(stderr, "read input: %v\n", err)
+			return exitInvalid
+		}
+	}
 	if err := pdf50tawi.ValidateTaxInfo(taxInfo); err != nil {
-		log.Fatalf("validation error: %v", err)
+		printValidationError(stderr, err)
+		return exitInvalid
+	}
+
+	sign, err := loadOptional(*signPath, "signature")
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitInvalid
+	}
+	seal, err := loadOptional(*sealPath, "seal")
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitInvalid
+	}
+
+	var opts []pdf50tawi.Option
+	if *metadata {
+		opts = append(opts, pdf50tawi.WithMetadata())
 	}
 
-	sign := loadOptional(*signPath, "signature")
-	seal := loadOptional(*sealPath, "seal")
+	// Generate into memory first so a failure never leaves a partial file.
+	var buf bytes.Buffer
+	if err := pdf50tawi.IssueWHTCertificatePDF(&buf, taxInfo, sign, seal, opts...); err != nil {
+		fmt.Fprintf(stderr, "generate certificate: %v\n", err)
+		return exitFailure
+	}
 
-	out, err := os.Create(*outputPath)
+	if *outputPath == "-" {
+		if _, err := buf.WriteTo(stdout); err != nil {
+			fmt.Fprintf(stderr, "write output: %v\n", err)
+			return exitFailure
+		}
+		return exitOK
+	}
+	if err := os.WriteFile(*outputPath, buf.Bytes(), 0o644); err != nil {
+		fmt.Fprintf(stderr, "write output: %v\n", err)
+		return exitFailure
+	}
+	fmt.Fprintf(stderr, "Certificate written to %s\n", *outputPath)
+	return exitOK
+}
+
+// readTaxInfo decodes TaxInfo JSON from path, or from stdin when path is "-".
+// Both a bare TaxInfo and the REST request body {"taxInfo": {...}} are
+// accepted.
+func readTaxInfo(path string, stdin io.Reader) (pdf50tawi.TaxInfo, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
 	if err != nil {
-		log.Fatalf("create output: %v", err)
+		return pdf50tawi.TaxInfo{}, err
 	}
-	defer out.Close()
 
-	if err := pdf50tawi.IssueWHTCertificatePDF(out, taxInfo, sign, seal); err != nil {
-		log.Fatalf("generate certificate: %v", err)
+	var body struct {
+		TaxInfo *pdf50tawi.TaxInfo `json:"taxInfo"`
 	}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return pdf50tawi.TaxInfo{}, fmt.Errorf("invalid taxInfo JSON: %w", err)
+	}
+	if body.TaxInfo != nil {
+		return *body.TaxInfo, nil
+	}
+	var taxInfo pdf50tawi.TaxInfo
+	if err := json.Unmarshal(data, &taxInfo); err != nil {
+		return pdf50tawi.TaxInfo{}, fmt.Errorf("invalid taxInfo JSON: %w", err)
+	}
+	return taxInfo, nil
+}
 
-	fmt.Printf("Certificate written to %s\n", *outputPath)
+// printValidationError lists each problem on its own line, prefixed with the
+// field it belongs to.
+func printValidationError(w io.Writer, err error) {
+	var ve *pdf50tawi.ValidationError
+	if !errors.As(err, &ve) {
+		fmt.Fprintf(w, "validation error: %v\n", err)
+		return
+	}
+	fmt.Fprintf(w, "validation failed (%d):\n", len(ve.Issues))
+	for _, issue := range ve.Issues {
+		fmt.Fprintf(w, "  %s: %s\n", issue.Field, issue.Message)
+	}
 }
 
 // loadOptional opens a file and returns its reader, or nil if the path is empty.
 // Nil is safe — IssueWHTCertificatePDF renders the certificate without the image.
-func loadOptional(path, label string) io.Reader {
+func loadOptional(path, label string) (io.Reader, error) {
 	if path == "" {
-		return nil
+		return nil, nil
 	}
 	r, err := pdf50tawi.LoadImageFromFile(path)
 	if err != nil {
-		log.Fatalf("load %s (%s): %v", label, path, err)
+		return nil, fmt.Errorf("load %s (%s): %w", label, path, err)
 	}
-	return r
+	return r, nil
 }
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AnuchitO/pdf50tawi"
+)
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	data, err := json.Marshal(demoTaxInfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid := filepath.Join(dir, "taxinfo.json")
+	invalid := filepath.Join(dir, "invalid.json")
+	if err := os.WriteFile(valid, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(invalid, []byte(`{"taxInfo": {"payer": {"taxId": "123"}}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	plain := filepath.Join(dir, "plain.pdf")
+	withMetadata := filepath.Join(dir, "metadata.pdf")
+
+	testCases := []struct {
+		name       string
+		args       []string
+		stdin      string
+		want       int
+		wantStdout string // substring of stdout
+		wantStderr string // substring of stderr
+	}{
+		{"Help", []string{"--help"}, "", exitOK, "Commands:", ""},
+		{"UnknownCommand", []string{"sign"}, "", exitInvalid, "", `unknown command "sign"`},
+		{"Version", []string{"version"}, "", exitOK, "template  " + pdf50tawi.TemplateVersion(), ""},
+
+		{"Render", []string{"render", "--input", valid, "--output", plain}, "", exitOK, "", "Certificate written to " + plain},
+		{"RenderMetadata", []string{"render", "--input", valid, "--output", withMetadata, "--metadata"}, "", exitOK, "", ""},
+		{"RenderWithoutCommand", []string{"--input", "-", "--output", "-"}, string(data), exitOK, "%PDF", ""},
+		{"RenderDemo", []string{"render", "--demo", "--output", "-"}, "", exitOK, "%PDF", ""},
+		{"RenderWithoutInput", []string{"render", "--output", "-"}, "", exitInvalid, "", "--input is required"},
+		{"RenderInputAndDemo", []string{"render", "--input", valid, "--demo"}, "", exitInvalid, "", "cannot be used together"},
+		{"RenderInvalid", []string{"render", "--input", invalid}, "", exitInvalid, "", "payer.taxId"},
+		{"RenderBadJSON", []string{"render", "--input", "-"}, "{", exitInvalid, "", "invalid taxInfo JSON"},
+		{"RenderBadFlag", []string{"render", "--colour"}, "", exitInvalid, "", "flag provided but not defined"},
+
+		{"Validate", []string{"validate", valid, "-"}, string(data), exitOK, "-: OK", ""},
+		{"ValidateInvalid", []string{"validate", valid, invalid}, "", exitInvalid, invalid + ": validation failed", ""},
+		{"ValidateMissingFile", []string{"validate", filepath.Join(dir, "missing.json")}, "", exitInvalid, "no such file", ""},
+		{"ValidateJSON", []string{"validate", "--json", invalid}, "", exitInvalid, `"field": "payer.taxId"`, ""},
+		{"ValidateNoFiles", []string{"validate"}, "", exitInvalid, "", "no files given"},
+		{"ValidateStdinTwice", []string{"validate", "-", "-"}, string(data), exitInvalid, "", `"-" (stdin) may be given only once`},
+
+		{"Inspect", []string{"inspect", withMetadata}, "", exitOK, demoTaxInfo().Payee.Name, ""},
+		{"InspectJSON", []string{"inspect", "--json", withMetadata}, "", exitOK, `"template": "` + pdf50tawi.TemplateVersion() + `"`, ""},
+		{"InspectWithoutMetadata", []string{"inspect", plain}, "", exitFailure, "", "render with --metadata"},
+		{"InspectNoFile", []string{"inspect"}, "", exitInvalid, "", "Usage: pdf50tawi inspect"},
+
+		{"TemplateExport", []string{"template", "export", "--out-dir", filepath.Join(dir, "form")}, "", exitOK, "layout.json", ""},
+		{"TemplateWithoutExport", []string{"template"}, "", exitInvalid, "", "Usage: pdf50tawi template export"},
+	}
+	// The cases run in order: inspect reads the PDFs that render wrote.
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			code := run(tc.args, strings.NewReader(tc.stdin), &stdout, &stderr)
+			if code != tc.want {
+				t.Fatalf("exit %d, want %d\nstdout: %s\nstderr: %s", code, tc.want, stdout.String(), stderr.String())
+			}
+			if !strings.Contains(stdout.String(), tc.wantStdout) {
+				t.Errorf("stdout %q does not contain %q", stdout.String(), tc.wantStdout)
+			}
+			if !strings.Contains(stderr.String(), tc.wantStderr) {
+				t.Errorf("stderr %q does not contain %q", stderr.String(), tc.wantStderr)
+			}
+		})
+	}
+
+	for _, name := range []string{"tax50tawiTemplate.pdf", "layout.json"} {
+		if _, err := os.Stat(filepath.Join(dir, "form", name)); err != nil {
+			t.Errorf("template export: %v", err)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// fileSequenceStore is a pdf50tawi.SequenceStore kept in a JSON file, so a
+// batch continues the numbers where the previous one stopped. The file is
+// rewritten after every number; it is meant for one batch at a time.
+type fileSequenceStore struct {
+	path string
+	seqs map[string]int64
+}
+
+// openFileSequenceStore reads the sequences in path. A missing file holds
+// no sequences yet.
+func openFileSequenceStore(path string) (*fileSequenceStore, error) {
+	s := &fileSequenceStore{path: path, seqs: map[string]int64{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.seqs); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+func (s *fileSequenceStore) Next(_ context.Context, key string) (int64, error) {
+	s.seqs[key]++
+	if err := s.save(); err != nil {
+		s.seqs[key]--
+		return 0, err
+	}
+	return s.seqs[key], nil
+}
+
+// save replaces the file through a rename, so an interrupted write never
+// leaves it half written.
+func (s *fileSequenceStore) save() error {
+	data, err := json.MarshalIndent(s.seqs, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(s.path), ".sequences-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), s.path)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileSequenceStore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "sequences.json")
+	s, err := openFileSequenceStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []struct {
+		key string
+		n   int64
+	}{{"a/2568", 1}, {"a/2568", 2}, {"b/2568", 1}} {
+		if n, err := s.Next(ctx, want.key); err != nil || n != want.n {
+			t.Fatalf("Next(%q) = %d, %v, want %d", want.key, n, err, want.n)
+		}
+	}
+
+	reopened, err := openFileSequenceStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := reopened.Next(ctx, "a/2568"); err != nil || n != 3 {
+		t.Fatalf("after reopening: %d, %v", n, err)
+	}
+	if _, err := openFileSequenceStore(writeFile(t, "sequences.json", "[")); err == nil {
+		t.Fatal("corrupt file: expected an error")
+	}
+}
@@ -0,0 +1,299 @@
+package main
+
+// A minimal XLSX reader: enough of SpreadsheetML to pull the cell text of one
+// worksheet out of a payroll export without a third-party dependency.
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The size limits of a worksheet. Row and column numbers come from the
+// file, and each one allocates up to it, so larger ones are refused.
+const (
+	xlsxMaxRows    = 1048576
+	xlsxMaxColumns = 16384 // column XFD
+)
+
+type xlsxWorkbook struct {
+	Props struct {
+		Date1904 bool `xml:"date1904,attr"`
+	} `xml:"workbookPr"`
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRels struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type xlsxText struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxText) String() string {
+	if len(t.Runs) == 0 {
+		return t.T
+	}
+	var b strings.Builder
+	for _, r := range t.Runs {
+		b.WriteString(r.T)
+	}
+	return b.String()
+}
+
+type xlsxStyles struct {
+	NumFmts []struct {
+		ID   int    `xml:"numFmtId,attr"`
+		Code string `xml:"formatCode,attr"`
+	} `xml:"numFmts>numFmt"`
+	CellXfs []struct {
+		NumFmtID int `xml:"numFmtId,attr"`
+	} `xml:"cellXfs>xf"`
+}
+
+type xlsxSheet struct {
+	Rows []struct {
+		R     int `xml:"r,attr"`
+		Cells []struct {
+			Ref    string    `xml:"r,attr"`
+			Style  int       `xml:"s,attr"`
+			Type   string    `xml:"t,attr"`
+			Value  string    `xml:"v"`
+			Inline *xlsxText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// readXLSX returns the cell text of the named worksheet, or of the first
+// worksheet when sheet is empty. Date cells are formatted as dd/mm/yyyy in
+// the Buddhist Era, the way dates are written on the certificate.
+func readXLSX(file, sheet string) ([][]string, error) {
+	zr, err := zip.OpenReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	var wb xlsxWorkbook
+	if err := decodeZipXML(files, "xl/workbook.xml", &wb, false); err != nil {
+		return nil, err
+	}
+	var rels xlsxRels
+	if err := decodeZipXML(files, "xl/_rels/workbook.xml.rels", &rels, false); err != nil {
+		return nil, err
+	}
+	sheetPath, err := findSheet(wb, rels, sheet)
+	if err != nil {
+		return nil, err
+	}
+
+	var sst struct {
+		Items []xlsxText `xml:"si"`
+	}
+	if err := decodeZipXML(files, "xl/sharedStrings.xml", &sst, true); err != nil {
+		return nil, err
+	}
+	var styles xlsxStyles
+	if err := decodeZipXML(files, "xl/styles.xml", &styles, true); err != nil {
+		return nil, err
+	}
+	dateStyles := dateStyleSet(styles)
+
+	var ws xlsxSheet
+	if err := decodeZipXML(files, sheetPath, &ws, false); err != nil {
+		return nil, err
+	}
+
+	var rows [][]string
+	for _, row := range ws.Rows {
+		rowIdx := row.R - 1
+		if row.R == 0 {
+			rowIdx = len(rows)
+		}
+		// A gap up to rowIdx takes rows of the budget too.
+		if rowIdx < 0 || rowIdx >= xlsxMaxRows {
+			return nil, fmt.Errorf("row %d: rows must be numbered 1 to %d", rowIdx+1, xlsxMaxRows)
+		}
+		for len(rows) <= rowIdx {
+			rows = append(rows, nil)
+		}
+		var cells []string
+		for i, c := range row.Cells {
+			col := i
+			if c.Ref != "" {
+				if col, err = columnIndex(c.Ref); err != nil {
+					return nil, err
+				}
+			}
+			if col >= xlsxMaxColumns {
+				return nil, fmt.Errorf("row %d: cell %d is beyond column XFD", rowIdx+1, col+1)
+			}
+			for len(cells) <= col {
+				cells = append(cells, "")
+			}
+			switch c.Type {
+			case "s":
+				idx, err := strconv.Atoi(c.Value)
+				if err != nil || idx < 0 || idx >= len(sst.Items) {
+					return nil, fmt.Errorf("cell %s: invalid shared string %q", c.Ref, c.Value)
+				}
+				cells[col] = sst.Items[idx].String()
+			case "inlineStr":
+				if c.Inline != nil {
+					cells[col] = c.Inline.String()
+				}
+			case "", "n":
+				cells[col] = numericCell(c.Value, dateStyles[c.Style], wb.Props.Date1904)
+			default: // str, b, e
+				cells[col] = c.Value
+			}
+		}
+		rows[rowIdx] = cells
+	}
+	return rows, nil
+}
+
+func decodeZipXML(files map[string]*zip.File, name string, v any, optional bool) error {
+	f, ok := files[name]
+	if !ok {
+		if optional {
+			return nil
+		}
+		return fmt.Errorf("not an XLSX workbook: missing %s", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	if err := xml.NewDecoder(io.LimitReader(rc, 256<<20)).Decode(v); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+func findSheet(wb xlsxWorkbook, rels xlsxRels, name string) (string, error) {
+	if len(wb.Sheets) == 0 {
+		return "", fmt.Errorf("workbook has no sheets")
+	}
+	rid := wb.Sheets[0].RID
+	if name != "" {
+		rid = ""
+		for _, s := range wb.Sheets {
+			if s.Name == name {
+				rid = s.RID
+			}
+		}
+		if rid == "" {
+			return "", fmt.Errorf("sheet %q not found", name)
+		}
+	}
+	for _, r := range rels.Relationships {
+		if r.ID != rid {
+			continue
+		}
+		if strings.HasPrefix(r.Target, "/") {
+			return strings.TrimPrefix(r.Target, "/"), nil
+		}
+		return path.Join("xl", r.Target), nil
+	}
+	return "", fmt.Errorf("sheet relationship %q not found", rid)
+}
+
+// columnIndex converts the letters of a cell reference such as "AB12" to a
+// zero-based column index.
+func columnIndex(ref string) (int, error) {
+	col := 0
+	n := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		col = col*26 + int(r-'A'+1)
+		n++
+		if col > xlsxMaxColumns {
+			return 0, fmt.Errorf("cell %s: column is beyond XFD", ref)
+		}
+	}
+	if n == 0 {
+		return 0, fmt.Errorf("invalid cell reference %q", ref)
+	}
+	return col - 1, nil
+}
+
+// dateStyleSet reports which cell styles display numbers as dates.
+func dateStyleSet(styles xlsxStyles) map[int]bool {
+	custom := make(map[int]string, len(styles.NumFmts))
+	for _, f := range styles.NumFmts {
+		custom[f.ID] = f.Code
+	}
+	set := make(map[int]bool)
+	for i, xf := range styles.CellXfs {
+		id := xf.NumFmtID
+		builtin := (id >= 14 && id <= 17) || id == 22 || (id >= 27 && id <= 36) || (id >= 50 && id <= 58) || (id >= 71 && id <= 81)
+		if code, ok := custom[id]; ok {
+			builtin = isDateFormat(code)
+		}
+		set[i] = builtin
+	}
+	return set
+}
+
+// isDateFormat reports whether a custom number format shows a day or year,
+// ignoring quoted literals and [colour]/[locale] sections.
+func isDateFormat(code string) bool {
+	inQuote, inBracket := false, false
+	for _, r := range strings.ToLower(code) {
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+		case inQuote:
+		case r == '[':
+			inBracket = true
+		case r == ']':
+			inBracket = false
+		case inBracket:
+		case r == 'd' || r == 'y' || r == 'b': // b: Buddhist year
+			return true
+		}
+	}
+	return false
+}
+
+// numericCell renders a numeric cell value: dates as dd/mm/yyyy (B.E.), other
+// numbers in their shortest form so 1234.5599999999999 reads 1234.56.
+func numericCell(v string, isDate, date1904 bool) string {
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return v
+	}
+	if !isDate {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	epoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	if date1904 {
+		epoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	t := epoch.AddDate(0, 0, int(math.Floor(f)))
+	return fmt.Sprintf("%02d/%02d/%d", t.Day(), int(t.Month()), t.Year()+543)
+}
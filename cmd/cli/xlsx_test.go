@@ -0,0 +1,165 @@
+package main
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeXLSX writes a workbook with the given sheets, in order, and returns
+// its path. Each sheet is the XML inside <sheetData>.
+func writeXLSX(t *testing.T, sharedStrings string, sheets ...[2]string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "book.xlsx")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	add := func(name, content string) {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var wb, rels strings.Builder
+	wb.WriteString(`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	rels.WriteString(`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	for i, s := range sheets {
+		id := "rId" + string(rune('1'+i))
+		target := "worksheets/sheet" + string(rune('1'+i)) + ".xml"
+		wb.WriteString(`<sheet name="` + s[0] + `" sheetId="1" r:id="` + id + `"/>`)
+		rels.WriteString(`<Relationship Id="` + id + `" Target="` + target + `"/>`)
+		add("xl/"+target, `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`+s[1]+`</sheetData></worksheet>`)
+	}
+	wb.WriteString(`</sheets></workbook>`)
+	rels.WriteString(`</Relationships>`)
+	add("xl/workbook.xml", wb.String())
+	add("xl/_rels/workbook.xml.rels", rels.String())
+	if sharedStrings != "" {
+		add("xl/sharedStrings.xml", `<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`+sharedStrings+`</sst>`)
+	}
+	// Style 1 is a built-in date format, style 2 a custom one.
+	add("xl/styles.xml", `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+		<numFmts><numFmt numFmtId="164" formatCode="dd/mm/yyyy"/></numFmts>
+		<cellXfs><xf numFmtId="0"/><xf numFmtId="14"/><xf numFmtId="164"/><xf numFmtId="4"/></cellXfs></styleSheet>`)
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadXLSX(t *testing.T) {
+	sst := `<si><t>ชื่อ</t></si><si><t>จำนวนเงิน</t></si><si><r><t>นาย </t></r><r><t>ก</t></r></si>`
+	payroll := `
+		<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c><c r="C1" t="inlineStr"><is><t>วันที่</t></is></c></row>
+		<row r="2"><c r="A2" t="s"><v>2</v></c><c r="B2"><v>1234.5599999999999</v></c><c r="C2" s="1"><v>45688</v></c></row>
+		<row r="4"><c r="A4" t="inlineStr"><is><t>นาย ข</t></is></c><c r="C4" s="2"><v>45689.75</v></c><c r="D4" s="3"><v>7</v></c></row>`
+	path := writeXLSX(t, sst, [2]string{"Summary", `<row r="1"><c r="A1" t="inlineStr"><is><t>x</t></is></c></row>`}, [2]string{"Payroll", payroll})
+
+	testCases := []struct {
+		name, sheet string
+		want        [][]string
+	}{
+		{"FirstSheet", "", [][]string{{"x"}}},
+		{"NamedSheet", "Payroll", [][]string{
+			{"ชื่อ", "จำนวนเงิน", "วันที่"},
+			{"นาย ก", "1234.56", "31/01/2568"}, // shared rich text, numeric, built-in date
+			nil,                              // row 3 is missing
+			{"นาย ข", "", "01/02/2568", "7"}, // empty B4, custom date, number style
+		}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := readXLSX(path, tc.sheet)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+
+	if _, err := readXLSX(path, "Missing"); err == nil || !strings.Contains(err.Error(), `sheet "Missing" not found`) {
+		t.Fatalf("missing sheet: %v", err)
+	}
+	bad := writeXLSX(t, sst, [2]string{"Sheet1", `<row r="1"><c r="A1" t="s"><v>9</v></c></row>`})
+	if _, err := readXLSX(bad, ""); err == nil || !strings.Contains(err.Error(), "invalid shared string") {
+		t.Fatalf("shared string out of range: %v", err)
+	}
+	for _, tc := range []struct{ row, wantErr string }{
+		{`<row r="2000000000"><c r="A2000000000"><v>1</v></c></row>`, "row 2000000000: rows must be numbered 1 to 1048576"},
+		{`<row r="1048577"><c r="A1048577"><v>1</v></c></row>`, "row 1048577"},
+		{`<row r="-1"><c><v>1</v></c></row>`, "row -1"},
+		{`<row r="1"><c r="XFDXFDXFD1"><v>1</v></c></row>`, "cell XFDXFDXFD1: column is beyond XFD"},
+	} {
+		huge := writeXLSX(t, "", [2]string{"Sheet1", tc.row})
+		if _, err := readXLSX(huge, ""); err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			t.Errorf("%s: error %v, want %q", tc.row, err, tc.wantErr)
+		}
+	}
+	notXLSX := filepath.Join(t.TempDir(), "payroll.xlsx")
+	if err := os.WriteFile(notXLSX, []byte("a,b\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readXLSX(notXLSX, ""); err == nil {
+		t.Fatal("a CSV named .xlsx: expected an error")
+	}
+}
+
+func TestNumericCell(t *testing.T) {
+	testCases := []struct {
+		v                string
+		isDate, date1904 bool
+		want             string
+	}{
+		{"1234.5599999999999", false, false, "1234.56"},
+		{"360000", false, false, "360000"},
+		{"1E-3", false, false, "0.001"},
+		{"45688", true, false, "31/01/2568"},
+		{"45688.99", true, false, "31/01/2568"},
+		{"44226", true, true, "31/01/2568"}, // the same day in a 1904 workbook
+		{"#N/A", false, false, "#N/A"},
+	}
+	for _, tc := range testCases {
+		if got := numericCell(tc.v, tc.isDate, tc.date1904); got != tc.want {
+			t.Errorf("numericCell(%q, %v, %v) = %q, want %q", tc.v, tc.isDate, tc.date1904, got, tc.want)
+		}
+	}
+}
+
+func TestIsDateFormat(t *testing.T) {
+	for code, want := range map[string]bool{
+		"dd/mm/yyyy":          true,
+		"[$-th-TH]d mmm bbbb": true,
+		"#,##0.00":            false,
+		`"day "0`:             false,
+		"[Red]#,##0":          false,
+	} {
+		if got := isDateFormat(code); got != want {
+			t.Errorf("isDateFormat(%q) = %v, want %v", code, got, want)
+		}
+	}
+}
+
+func TestColumnIndex(t *testing.T) {
+	for ref, want := range map[string]int{"A1": 0, "C12": 2, "Z3": 25, "AA1": 26, "AB12": 27, "XFD1": 16383} {
+		if got, err := columnIndex(ref); err != nil || got != want {
+			t.Errorf("columnIndex(%q) = %d, %v, want %d", ref, got, err, want)
+		}
+	}
+	for _, ref := range []string{"12", "XFE1", "AAAAAAAAAAAAAAAAAAAAAA1"} {
+		if _, err := columnIndex(ref); err == nil {
+			t.Errorf("columnIndex(%q): expected an error", ref)
+		}
+	}
+}
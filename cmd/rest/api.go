@@ -1,40 +1,233 @@
 package main
 
-// REST API — three strategies for supplying signature and seal images.
+// REST API — issue certificates over HTTP.
+//
+// Issue       POST /api/v1/taxes            JSON or multipart; Certification says where each image comes from
+//
+// The original routes, one per way of supplying the signature and seal images:
 //
 // Strategy A  POST /api/v1/taxes/multipart  multipart/form-data upload
 // Strategy B  POST /api/v1/taxes/base64     JSON body with base64-encoded images
 // Strategy C  POST /api/v1/taxes/url        JSON body with image URLs (server fetches)
+//
+// Images are optional everywhere and must be PNG or JPEG within
+// pdf50tawi.DefaultImageLimits.
+//
+// Batch       POST /api/v1/taxes/batch      many certificates as a ZIP or one merged PDF (batch.go)
+// Validate    POST /api/v1/taxes/validate   validation result, nothing generated
+// Preview     POST /api/v1/taxes/preview    draft PDF or PNG/JPEG image of the certificate
+// Assets      /api/v1/payers/:taxId/assets  each payer's stored signature and seal (payerassets.go)
+// Jobs        /api/v1/jobs                  batches in the background (jobs.go)
+// Registry    /api/v1/certificates          every certificate issued, once REGISTRY_STORE is set (registry.go)
+//                                           voided and reissued with a new number (reissue.go)
+//
+// Once configured, every /api/ route requires an API key or JWT scoped to
+// the payers it may issue for (auth.go), and is rate limited per caller;
+// the routes that generate also share a bounded number of slots (limits.go).
+// Issuing and submitting a job honour an Idempotency-Key header, so a retry
+// does not issue twice (idempotency.go). Empty book and document numbers
+// can be filled in from per-payer sequences (numbering.go).
+//
+// OpenAPI     GET /openapi.json, GET /docs  the contract of all of the above (openapi.go)
+// Health      GET /healthz, GET /readyz     liveness and readiness probes (server.go)
+// Metrics     GET /metrics                  Prometheus metrics; every request is logged as JSON (observe.go)
+//
+// Settings such as the listen address, TLS and timeouts come from
+// CONFIG_FILE and the environment (config.go).
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"image/jpeg"
+	"image/png"
 	"io"
 	"log"
+	"log/slog"
 	"mime/multipart"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/AnuchitO/pdf50tawi"
 	"github.com/labstack/echo/v4"
 )
 
+// assets holds the images clients refer to by id. It is nil unless ASSET_DIR
+// is set.
+var assets assetStore
+
+// fetcher downloads images given by URL; see imageFetcherFromEnv.
+var fetcher *pdf50tawi.ImageFetcher
+
 func main() {
+	var err error
+	if config, err = serverConfigFromEnv(); err != nil {
+		log.Fatal(err)
+	}
+	logOpts := &slog.HandlerOptions{Level: config.LogLevel}
+	if config.LogFormat == "text" {
+		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, logOpts)))
+	} else {
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, logOpts)))
+	}
+
+	if dir := os.Getenv("ASSET_DIR"); dir != "" {
+		assets = dirAssetStore{dir: dir}
+		payerAssets = dirAssetStore{dir: dir}
+	}
+	if fetcher, err = imageFetcherFromEnv(); err != nil {
+		fatal(err)
+	}
+	if jobs, err = jobManagerFromEnv(); err != nil {
+		fatal(err)
+	}
+	if numbering, err = numberingFromEnv(); err != nil {
+		fatal(err)
+	}
+	if registry, err = registryFromEnv(); err != nil {
+		fatal(err)
+	}
+	if idempotency, err = idempotencyFromEnv(); err != nil {
+		fatal(err)
+	}
+	if auth, err = authenticatorFromEnv(); err != nil {
+		fatal(err)
+	}
+	if auth == nil {
+		slog.Warn("authentication is not configured: anyone can issue certificates (see auth.go)")
+	}
+	if err := pdf50tawi.CheckResources(); err != nil {
+		fatal(err)
+	}
+	if config.RateLimit > 0 {
+		rateLimits = newRateLimiter(config.RateLimit, config.RateBurst)
+	}
+	generations = newGenerationLimiter(config.MaxGenerations, config.GenerationQueue, time.Duration(config.GenerationWait))
+	if err := serve(config); err != nil {
+		fatal(err)
+	}
+}
+
+// fatal logs err whatever LOG_LEVEL is and exits.
+func fatal(err error) {
+	slog.Error(err.Error())
+	os.Exit(1)
+}
+
+// newServer returns the server with every route registered. Each route must
+// also be described in openapi.json.
+func newServer() *echo.Echo {
 	e := echo.New()
+	e.Use(observe)
+	e.Use(serverMiddleware()...)
+	e.Use(requireAuth)
+	e.Use(limitRate)
+
+	e.POST("/api/v1/taxes", handleIssue, idempotent, holdGeneration)
+	e.POST("/api/v1/taxes/multipart", handleMultipart, idempotent, holdGeneration)
+	e.POST("/api/v1/taxes/base64", handleBase64, idempotent, holdGeneration)
+	e.POST("/api/v1/taxes/url", handleURL, idempotent, holdGeneration)
+	e.POST("/api/v1/taxes/batch", handleBatch, idempotent) // a slot per certificate, see issueBatch
+	e.POST("/api/v1/taxes/validate", handleValidate)
+	e.POST("/api/v1/taxes/preview", handlePreview, holdGeneration)
+
+	e.PUT("/api/v1/payers/:taxId/assets/:kind", handlePutPayerAsset)
+	e.GET("/api/v1/payers/:taxId/assets/:kind", handleGetPayerAsset)
+	e.DELETE("/api/v1/payers/:taxId/assets/:kind", handleDeletePayerAsset)
+
+	e.GET("/api/v1/certificates", handleListCertificates)
+	e.GET("/api/v1/certificates/:id", handleGetCertificate)
+	e.GET("/api/v1/certificates/:id/pdf", handleCertificatePDF)
+	e.POST("/api/v1/certificates/:id/void", handleVoidCertificate, idempotent, holdGeneration)
+	e.POST("/api/v1/certificates/:id/reissue", handleReissueCertificate, idempotent, holdGeneration)
+
+	e.POST("/api/v1/jobs", handleSubmitJob, idempotent)
+	e.GET("/api/v1/jobs/:id", handleGetJob)
+	e.GET("/api/v1/jobs/:id/result", handleJobResult)
+	e.DELETE("/api/v1/jobs/:id", handleCancelJob)
+
+	e.GET("/healthz", handleHealthz)
+	e.GET("/readyz", handleReadyz)
+	e.GET("/metrics", handleMetrics)
+	e.GET("/openapi.json", handleOpenAPI)
+	e.GET("/docs", handleDocs)
+	return e
+}
+
+// ── Issue: image sources described in Certification ─────────────────────────
+//
+// The body is either JSON, {"taxInfo": {...}}, or multipart/form-data with
+// the TaxInfo JSON in the taxInfo field. certification.payerSignatureImage
+// and certification.companySealImage each name where the image comes from:
+//
+//	{"sourceType": "upload", "value": "signatureImage"}   multipart part "signatureImage"
+//	{"sourceType": "base64", "value": "iVBORw0KGgo..."}   inline, a data: URL is accepted too
+//	{"sourceType": "url",    "value": "https://..."}      fetched by the server
+//	{"sourceType": "asset",  "value": "company-seal.png"} stored on the server (ASSET_DIR)
+//	{"sourceType": "payer",  "value": "seal"}             stored for payer.taxId (payerassets.go)
+//
+// Both images are optional.
+//
+// curl -X POST http://localhost:8080/api/v1/taxes \
+//   -F 'taxInfo={..., "certification": {"payerSignatureImage": {"sourceType": "upload", "value": "signatureImage"}, ...}}' \
+//   -F 'signatureImage=@signature.png' \
+//   -o certificate.pdf
+func handleIssue(c echo.Context) error {
+	req, err := parseRequest(c)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	defer req.Close()
+	if err := authorizePayers(c, req.TaxInfo); err != nil {
+		return errorJSON(c, err)
+	}
+	if err := validateTaxInfo(opIssue, req.TaxInfo); err != nil {
+		return c.JSON(http.StatusBadRequest, errResp(err.Error()))
+	}
+	sign, seal, err := req.images(c.Request().Context())
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return streamCertificate(c, req.TaxInfo, sign, seal)
+}
+
+// ── Validate: check the TaxInfo without generating anything ─────────────────
+//
+// Same body as POST /api/v1/taxes. Answers 200 with the list of problems, so
+// a form can be checked as the user types; images are not loaded.
+//
+// curl -X POST http://localhost:8080/api/v1/taxes/validate \
+//   -H 'Content-Type: application/json' \
+//   -d '{"taxInfo": {"payer": {...}, ...}}'
+//
+//	{"valid": false, "issues": [{"field": "payee.taxId", "code": "tax_id_format", "message": "payee.taxId must be 13 digits"}]}
+type validateResponse struct {
+	Valid  bool                        `json:"valid"`
+	Issues []pdf50tawi.ValidationIssue `json:"issues,omitempty"`
+}
 
-	e.POST("/api/v1/taxes/multipart", handleMultipart)
-	e.POST("/api/v1/taxes/base64", handleBase64)
-	e.POST("/api/v1/taxes/url", handleURL)
+func handleValidate(c echo.Context) error {
+	req, err := parseRequest(c)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	defer req.Close()
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	res := validateResponse{Valid: true}
+	if err := validateTaxInfo(opValidate, req.TaxInfo); err != nil {
+		var ve *pdf50tawi.ValidationError
+		if !errors.As(err, &ve) {
+			return c.JSON(http.StatusInternalServerError, errResp(err.Error()))
+		}
+		res = validateResponse{Valid: false, Issues: ve.Issues}
 	}
-	log.Printf("Starting server on port %s", port)
-	log.Fatal(e.Start(":" + port))
+	return c.JSON(http.StatusOK, res)
 }
 
 // ── Strategy A: multipart/form-data ──────────────────────────────────────────
@@ -55,7 +248,10 @@ func handleMultipart(c echo.Context) error {
 	if err != nil {
 		return c.JSON(http.StatusBadRequest, errResp(err.Error()))
 	}
-	if err := pdf50tawi.ValidateTaxInfo(taxInfo); err != nil {
+	if err := authorizePayers(c, taxInfo); err != nil {
+		return errorJSON(c, err)
+	}
+	if err := validateTaxInfo(opIssue, taxInfo); err != nil {
 		return c.JSON(http.StatusBadRequest, errResp(err.Error()))
 	}
 
@@ -92,20 +288,23 @@ func handleBase64(c echo.Context) error {
 	if err := c.Bind(&req); err != nil {
 		return c.JSON(http.StatusBadRequest, errResp(err.Error()))
 	}
-	if err := pdf50tawi.ValidateTaxInfo(req.TaxInfo); err != nil {
+	if err := authorizePayers(c, req.TaxInfo); err != nil {
+		return errorJSON(c, err)
+	}
+	if err := validateTaxInfo(opIssue, req.TaxInfo); err != nil {
 		return c.JSON(http.StatusBadRequest, errResp(err.Error()))
 	}
 
-	signData, err := base64.StdEncoding.DecodeString(req.SignatureBase64)
+	sign, err := decodeBase64Image(req.SignatureBase64)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, errResp("invalid signatureBase64: "+err.Error()))
+		return c.JSON(http.StatusBadRequest, errResp("signatureBase64: "+err.Error()))
 	}
-	sealData, err := base64.StdEncoding.DecodeString(req.SealBase64)
+	seal, err := decodeBase64Image(req.SealBase64)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, errResp("invalid sealBase64: "+err.Error()))
+		return c.JSON(http.StatusBadRequest, errResp("sealBase64: "+err.Error()))
 	}
 
-	return streamCertificate(c, req.TaxInfo, bytes.NewReader(signData), bytes.NewReader(sealData))
+	return streamCertificate(c, req.TaxInfo, sign, seal)
 }
 
 // ── Strategy C: JSON with image URLs (server fetches) ────────────────────────
@@ -129,15 +328,19 @@ func handleURL(c echo.Context) error {
 	if err := c.Bind(&req); err != nil {
 		return c.JSON(http.StatusBadRequest, errResp(err.Error()))
 	}
-	if err := pdf50tawi.ValidateTaxInfo(req.TaxInfo); err != nil {
+	if err := authorizePayers(c, req.TaxInfo); err != nil {
+		return errorJSON(c, err)
+	}
+	if err := validateTaxInfo(opIssue, req.TaxInfo); err != nil {
 		return c.JSON(http.StatusBadRequest, errResp(err.Error()))
 	}
 
-	sign, err := pdf50tawi.LoadImageFromURL(req.SignatureURL)
+	ctx := c.Request().Context()
+	sign, err := fetchImage(ctx, req.SignatureURL)
 	if err != nil {
 		return c.JSON(http.StatusBadRequest, errResp("signatureURL: "+err.Error()))
 	}
-	seal, err := pdf50tawi.LoadImageFromURL(req.SealURL)
+	seal, err := fetchImage(ctx, req.SealURL)
 	if err != nil {
 		return c.JSON(http.StatusBadRequest, errResp("sealURL: "+err.Error()))
 	}
@@ -145,13 +348,95 @@ func handleURL(c echo.Context) error {
 	return streamCertificate(c, req.TaxInfo, sign, seal)
 }
 
+// ── Preview: draft PDF or PNG/JPEG image ────────────────────────────────────
+//
+// Same body as POST /api/v1/taxes (signatureBase64/sealBase64 are still
+// accepted). The certificate is stamped ตัวอย่าง / DRAFT so a preview cannot
+// pass for the issued document.
+//
+// curl -X POST 'http://localhost:8080/api/v1/taxes/preview?dpi=72&format=png' \
+//   -H 'Content-Type: application/json' \
+//   -d '{"taxInfo": {"payer": {...}, ...}}' \
+//   -o preview.png
+const defaultPreviewDPI = 96
+
+func handlePreview(c echo.Context) error {
+	dpi := float64(defaultPreviewDPI)
+	if v := c.QueryParam("dpi"); v != "" {
+		d, err := strconv.ParseFloat(v, 64)
+		if err != nil || d <= 0 || d > pdf50tawi.MaxRenderDPI {
+			return c.JSON(http.StatusBadRequest, errResp(fmt.Sprintf("dpi must be a number greater than 0 and at most %d", pdf50tawi.MaxRenderDPI)))
+		}
+		dpi = d
+	}
+	format := c.QueryParam("format")
+	if format == "" {
+		format = "png"
+	}
+	if format != "png" && format != "jpeg" && format != "pdf" {
+		return c.JSON(http.StatusBadRequest, errResp("format must be png, jpeg or pdf"))
+	}
+
+	req, err := parseRequest(c)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	defer req.Close()
+	if err := authorizePayers(c, req.TaxInfo); err != nil {
+		return errorJSON(c, err)
+	}
+	if err := validateTaxInfo(opPreview, req.TaxInfo); err != nil {
+		return c.JSON(http.StatusBadRequest, errResp(err.Error()))
+	}
+	sign, seal, err := req.images(c.Request().Context())
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	draft := pdf50tawi.WithWatermark(pdf50tawi.DraftWatermark())
+
+	var buf bytes.Buffer
+	if format == "pdf" {
+		if err := issuePDF(opPreview, &buf, req.TaxInfo, sign, seal, draft); err != nil {
+			return c.JSON(http.StatusInternalServerError, errResp("generate preview: "+err.Error()))
+		}
+		c.Response().Header().Set("Content-Disposition", "inline; filename=preview.pdf")
+		return c.Stream(http.StatusOK, "application/pdf", &buf)
+	}
+
+	start := time.Now()
+	img, err := pdf50tawi.RenderCertificateImage(req.TaxInfo, sign, seal, dpi, draft)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, errResp("render preview: "+err.Error()))
+	}
+	generationDuration.WithLabelValues(opPreview).Observe(time.Since(start).Seconds())
+	if format == "jpeg" {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85})
+	} else {
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, errResp("encode preview: "+err.Error()))
+	}
+	return c.Stream(http.StatusOK, "image/"+format, &buf)
+}
+
 // ── Shared helpers ────────────────────────────────────────────────────────────
 
 func streamCertificate(c echo.Context, taxInfo pdf50tawi.TaxInfo, sign, seal io.Reader) error {
+	if err := assignResponseNumbers(c, &taxInfo); err != nil {
+		return errorJSON(c, err)
+	}
 	var buf bytes.Buffer
-	if err := pdf50tawi.IssueWHTCertificatePDF(&buf, taxInfo, sign, seal); err != nil {
+	if err := issuePDF(opIssue, &buf, taxInfo, sign, seal); err != nil {
 		return c.JSON(http.StatusInternalServerError, errResp("generate certificate: "+err.Error()))
 	}
+	rec, err := registerCertificate(callerName(c), taxInfo, buf.Bytes())
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	if rec.ID != "" {
+		c.Response().Header().Set(headerCertificateID, rec.ID)
+	}
 	c.Response().Header().Set("Content-Disposition", "attachment; filename=certificate.pdf")
 	return c.Stream(http.StatusOK, "application/pdf", &buf)
 }
@@ -168,22 +453,82 @@ func parseTaxInfoFromForm(form *multipart.Form) (pdf50tawi.TaxInfo, error) {
 	return taxInfo, nil
 }
 
+// Every image goes through pdf50tawi.CheckImage as soon as it is read, so an
+// unsupported or oversized file is a 400 rather than a blank or failed
+// certificate. A missing image is nil: the certificate is issued without it.
+
+// readFormFile returns the image uploaded in field, or nil when there is none.
 func readFormFile(form *multipart.Form, field string) (io.Reader, error) {
 	files, ok := form.File[field]
 	if !ok || len(files) == 0 {
-		return nil, fmt.Errorf("missing file field '%s'", field)
+		return nil, nil
 	}
 	f, err := files[0].Open()
 	if err != nil {
 		return nil, err
 	}
 	defer f.Close()
+	return pdf50tawi.CheckImage(f, pdf50tawi.DefaultImageLimits)
+}
 
-	var buf bytes.Buffer
-	if _, err := io.Copy(&buf, f); err != nil {
-		return nil, err
+// decodeBase64Image decodes a base64 image, optionally written as a data:
+// URL. An empty string means no image.
+func decodeBase64Image(s string) (io.Reader, error) {
+	if s == "" {
+		return nil, nil
+	}
+	if strings.HasPrefix(s, "data:") {
+		_, s, _ = strings.Cut(s, ",")
+	}
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64: %w", err)
+	}
+	return pdf50tawi.CheckImage(bytes.NewReader(data), pdf50tawi.DefaultImageLimits)
+}
+
+// fetchImage downloads the image at url. An empty url means no image.
+func fetchImage(ctx context.Context, url string) (io.Reader, error) {
+	if url == "" {
+		return nil, nil
+	}
+	img, err := fetcher.Fetch(ctx, url)
+	if err != nil {
+		countFetchError(err)
+	}
+	return img, err
+}
+
+// imageFetcherFromEnv configures the URL fetcher. The URLs come from
+// clients, so by default only public addresses are fetched:
+//
+//	IMAGE_ALLOWED_HOSTS  comma-separated hosts, e.g. "cdn.example.com,*.s3.amazonaws.com"
+//	IMAGE_ALLOW_PRIVATE  "true" to allow loopback and private addresses (local demos)
+//	IMAGE_FETCH_TIMEOUT  e.g. "5s" (default 10s)
+func imageFetcherFromEnv() (*pdf50tawi.ImageFetcher, error) {
+	f := &pdf50tawi.ImageFetcher{}
+	if v := os.Getenv("IMAGE_ALLOWED_HOSTS"); v != "" {
+		for _, host := range strings.Split(v, ",") {
+			if host = strings.TrimSpace(host); host != "" {
+				f.AllowedHosts = append(f.AllowedHosts, host)
+			}
+		}
+	}
+	if v := os.Getenv("IMAGE_ALLOW_PRIVATE"); v != "" {
+		allow, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("IMAGE_ALLOW_PRIVATE: %w", err)
+		}
+		f.AllowPrivate = allow
+	}
+	if v := os.Getenv("IMAGE_FETCH_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("IMAGE_FETCH_TIMEOUT: %w", err)
+		}
+		f.Timeout = d
 	}
-	return &buf, nil
+	return f, nil
 }
 
 func errResp(msg string) map[string]string {
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/AnuchitO/pdf50tawi"
+)
+
+// errAssetNotFound is returned by an assetStore for an unknown id.
+var errAssetNotFound = errors.New("asset not found")
+
+// assetStore looks up images kept on the server, such as a company's seal,
+// so clients can refer to them with {"sourceType": "asset", "value": id}
+// instead of sending them with every request.
+type assetStore interface {
+	Open(id string) (io.Reader, error)
+}
+
+// dirAssetStore serves the image files of a directory; the id of an asset is
+// its file name, e.g. "company-seal.png".
+type dirAssetStore struct {
+	dir string
+}
+
+func (s dirAssetStore) Open(id string) (io.Reader, error) {
+	// Ids are plain file names: no paths, no hidden files.
+	if id == "" || id != filepath.Base(id) || strings.HasPrefix(id, ".") {
+		return nil, errAssetNotFound
+	}
+	r, err := pdf50tawi.LoadImageFromFile(filepath.Join(s.dir, id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, errAssetNotFound
+	}
+	return r, err
+}
+
+// payerAssetStore keeps the signature and seal of each payer, normalised to
+// PNG, so issuance requests can use {"sourceType": "payer", "value": kind}
+// instead of carrying the image. kind is pdf50tawi.PayerAssetSignature or
+// pdf50tawi.PayerAssetSeal; missing assets are errAssetNotFound.
+type payerAssetStore interface {
+	PutPayerAsset(taxID, kind string, png []byte) (created bool, err error)
+	PayerAsset(taxID, kind string) ([]byte, error)
+	DeletePayerAsset(taxID, kind string) error
+}
+
+// payerAssetPath is dir/payers/<taxID>/<kind>.png. The handlers only pass
+// 13-digit tax IDs and known kinds; anything else is refused here too, so
+// the path cannot leave dir.
+func (s dirAssetStore) payerAssetPath(taxID, kind string) (string, error) {
+	if len(taxID) != 13 || strings.Trim(taxID, "0123456789") != "" ||
+		(kind != pdf50tawi.PayerAssetSignature && kind != pdf50tawi.PayerAssetSeal) {
+		return "", errAssetNotFound
+	}
+	return filepath.Join(s.dir, "payers", taxID, kind+".png"), nil
+}
+
+func (s dirAssetStore) PutPayerAsset(taxID, kind string, png []byte) (bool, error) {
+	path, err := s.payerAssetPath(taxID, kind)
+	if err != nil {
+		return false, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return false, err
+	}
+	_, statErr := os.Stat(path)
+	// Write then rename, so a reader never sees half an image.
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+kind+"-*.png")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(png); err != nil {
+		tmp.Close()
+		return false, err
+	}
+	if err := tmp.Close(); err != nil {
+		return false, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return false, err
+	}
+	return errors.Is(statErr, fs.ErrNotExist), nil
+}
+
+func (s dirAssetStore) PayerAsset(taxID, kind string) ([]byte, error) {
+	path, err := s.payerAssetPath(taxID, kind)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, errAssetNotFound
+	}
+	return data, err
+}
+
+func (s dirAssetStore) DeletePayerAsset(taxID, kind string) error {
+	path, err := s.payerAssetPath(taxID, kind)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return errAssetNotFound
+	}
+	return err
+}
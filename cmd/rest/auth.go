@@ -0,0 +1,449 @@
+package main
+
+// ── Auth: who may issue certificates for which payer ────────────────────────
+//
+// Every /api/ route needs credentials once authentication is configured:
+//
+//	X-API-Key: <key>
+//	Authorization: Bearer <key or JWT>
+//
+// An API key or token is scoped to a set of payer tax IDs; a request whose
+// TaxInfo names a payer outside that set is refused with 403. "*" allows
+// every payer. JWTs are verified locally (HS256/384/512 with a shared
+// secret, RS256/384/512 with a public key), must carry exp, and list their
+// payers in a "payers" claim:
+//
+//	{"sub": "payroll-service", "exp": 1767225600, "payers": ["0105551234567"]}
+//
+// Configuration comes from the JSON file named by AUTH_CONFIG,
+//
+//	{
+//	  "apiKeys": [
+//	    {"name": "acme-payroll", "keySha256": "9f86d08...", "payers": ["0105551234567"]},
+//	    {"name": "ops", "key": "dev-only-key", "payers": ["*"]}
+//	  ],
+//	  "jwt": {"hmacSecret": "...", "rsaPublicKeyFile": "jwt.pem", "issuer": "...", "audience": "pdf50tawi"}
+//	}
+//
+// or from the environment:
+//
+//	AUTH_API_KEYS        name:key:payer|payer,... e.g. "acme:s3cret:0105551234567|0105559876543,ops:k2:*"
+//	AUTH_JWT_SECRET      HMAC secret
+//	AUTH_JWT_PUBLIC_KEY  path of a PEM RSA public key
+//	AUTH_JWT_ISSUER      required iss, if set
+//	AUTH_JWT_AUDIENCE    required aud, if set
+//
+// Without any of these the server runs unauthenticated, as before.
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	_ "crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/AnuchitO/pdf50tawi"
+	"github.com/labstack/echo/v4"
+)
+
+// principal is an authenticated caller.
+type principal struct {
+	Name string
+	// ID tells credentials apart where Name may not: two API keys can share
+	// a name. It owns the caller's jobs.
+	ID     string
+	Payers []string // payer tax IDs without spaces; "*" for any
+}
+
+// mayIssueFor reports whether p may issue certificates for the payer with
+// taxID.
+func (p *principal) mayIssueFor(taxID string) bool {
+	taxID = strings.ReplaceAll(taxID, " ", "")
+	return slices.Contains(p.Payers, "*") || (taxID != "" && slices.Contains(p.Payers, taxID))
+}
+
+// authConfig is the AUTH_CONFIG file.
+type authConfig struct {
+	APIKeys []apiKeyConfig `json:"apiKeys"`
+	JWT     jwtConfig      `json:"jwt"`
+}
+
+type apiKeyConfig struct {
+	Name      string   `json:"name"`
+	Key       string   `json:"key,omitempty"`       // the key itself, or
+	KeySHA256 string   `json:"keySha256,omitempty"` // its hex SHA-256, to keep it out of the file
+	Payers    []string `json:"payers"`
+}
+
+type jwtConfig struct {
+	HMACSecret       string `json:"hmacSecret,omitempty"`
+	RSAPublicKeyFile string `json:"rsaPublicKeyFile,omitempty"`
+	Issuer           string `json:"issuer,omitempty"`
+	Audience         string `json:"audience,omitempty"`
+}
+
+// authenticator checks the credentials of a request.
+type authenticator struct {
+	keys       map[[sha256.Size]byte]*principal // by SHA-256 of the key
+	hmacSecret []byte
+	rsaKey     *rsa.PublicKey
+	issuer     string
+	audience   string
+	now        func() time.Time
+}
+
+var (
+	errNoCredentials      = errors.New("missing API key or bearer token")
+	errInvalidCredentials = errors.New("invalid API key or token")
+)
+
+// newAuthenticator builds an authenticator from cfg; it returns nil when cfg
+// configures no credentials at all.
+func newAuthenticator(cfg authConfig) (*authenticator, error) {
+	a := &authenticator{
+		keys:     map[[sha256.Size]byte]*principal{},
+		issuer:   cfg.JWT.Issuer,
+		audience: cfg.JWT.Audience,
+		now:      time.Now,
+	}
+	for i, k := range cfg.APIKeys {
+		if len(k.Payers) == 0 {
+			return nil, fmt.Errorf("apiKeys[%d]: payers is required (use [\"*\"] for every payer)", i)
+		}
+		var sum [sha256.Size]byte
+		switch {
+		case k.Key != "" && k.KeySHA256 == "":
+			sum = sha256.Sum256([]byte(k.Key))
+		case k.KeySHA256 != "" && k.Key == "":
+			b, err := hex.DecodeString(k.KeySHA256)
+			if err != nil || len(b) != sha256.Size {
+				return nil, fmt.Errorf("apiKeys[%d]: keySha256 must be 64 hex digits", i)
+			}
+			copy(sum[:], b)
+		default:
+			return nil, fmt.Errorf("apiKeys[%d]: set exactly one of key and keySha256", i)
+		}
+		if _, dup := a.keys[sum]; dup {
+			return nil, fmt.Errorf("apiKeys[%d]: duplicate key", i)
+		}
+		a.keys[sum] = &principal{Name: k.Name, ID: "key:" + hex.EncodeToString(sum[:8]), Payers: normalizePayers(k.Payers)}
+	}
+	if cfg.JWT.HMACSecret != "" {
+		a.hmacSecret = []byte(cfg.JWT.HMACSecret)
+	}
+	if cfg.JWT.RSAPublicKeyFile != "" {
+		key, err := loadRSAPublicKey(cfg.JWT.RSAPublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		a.rsaKey = key
+	}
+	if len(a.keys) == 0 && a.hmacSecret == nil && a.rsaKey == nil {
+		return nil, nil
+	}
+	return a, nil
+}
+
+// authenticatorFromEnv reads AUTH_CONFIG, then lets the AUTH_* variables add
+// keys and override the JWT settings.
+func authenticatorFromEnv() (*authenticator, error) {
+	var cfg authConfig
+	if path := os.Getenv("AUTH_CONFIG"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("AUTH_CONFIG: %w", err)
+		}
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return nil, fmt.Errorf("AUTH_CONFIG %s: %w", path, err)
+		}
+	}
+	if v := os.Getenv("AUTH_API_KEYS"); v != "" {
+		for _, entry := range strings.Split(v, ",") {
+			name, rest, ok1 := strings.Cut(strings.TrimSpace(entry), ":")
+			key, payers, ok2 := strings.Cut(rest, ":")
+			if !ok1 || !ok2 || key == "" {
+				return nil, fmt.Errorf("AUTH_API_KEYS: %q is not name:key:payers", entry)
+			}
+			cfg.APIKeys = append(cfg.APIKeys, apiKeyConfig{Name: name, Key: key, Payers: strings.Split(payers, "|")})
+		}
+	}
+	for env, field := range map[string]*string{
+		"AUTH_JWT_SECRET":     &cfg.JWT.HMACSecret,
+		"AUTH_JWT_PUBLIC_KEY": &cfg.JWT.RSAPublicKeyFile,
+		"AUTH_JWT_ISSUER":     &cfg.JWT.Issuer,
+		"AUTH_JWT_AUDIENCE":   &cfg.JWT.Audience,
+	} {
+		if v := os.Getenv(env); v != "" {
+			*field = v
+		}
+	}
+	a, err := newAuthenticator(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("auth: %w", err)
+	}
+	return a, nil
+}
+
+func normalizePayers(payers []string) []string {
+	out := make([]string, 0, len(payers))
+	for _, p := range payers {
+		if p = strings.ReplaceAll(strings.TrimSpace(p), " ", ""); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func loadRSAPublicKey(path string) (*rsa.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("JWT public key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("JWT public key %s: no PEM block", path)
+	}
+	var key any
+	if block.Type == "RSA PUBLIC KEY" {
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	} else {
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("JWT public key %s: %w", path, err)
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("JWT public key %s: not an RSA key", path)
+	}
+	return rsaKey, nil
+}
+
+// authenticate returns the caller of r.
+func (a *authenticator) authenticate(r *http.Request) (*principal, error) {
+	cred := r.Header.Get("X-API-Key")
+	if cred == "" {
+		scheme, token, ok := strings.Cut(r.Header.Get(echo.HeaderAuthorization), " ")
+		if ok && strings.EqualFold(scheme, "Bearer") {
+			cred = strings.TrimSpace(token)
+		}
+	}
+	if cred == "" {
+		return nil, errNoCredentials
+	}
+	if p, ok := a.keys[sha256.Sum256([]byte(cred))]; ok {
+		return p, nil
+	}
+	if strings.Count(cred, ".") == 2 && (a.hmacSecret != nil || a.rsaKey != nil) {
+		return a.verifyJWT(cred)
+	}
+	return nil, errInvalidCredentials
+}
+
+// jwtClaims are the claims read from a token.
+type jwtClaims struct {
+	Subject   string      `json:"sub"`
+	Issuer    string      `json:"iss"`
+	Audience  jwtAudience `json:"aud"`
+	ExpiresAt *float64    `json:"exp"`
+	NotBefore *float64    `json:"nbf"`
+	Payers    []string    `json:"payers"`
+}
+
+// jwtAudience is the aud claim, a string or an array of strings.
+type jwtAudience []string
+
+func (a *jwtAudience) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*a = jwtAudience{one}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(a))
+}
+
+// clockSkew is the leeway allowed on exp and nbf.
+const clockSkew = time.Minute
+
+// verifyJWT checks the signature and claims of a compact JWS. The algorithm
+// must match a configured key: an HMAC token is never checked against the
+// RSA key, and "none" is refused.
+func (a *authenticator) verifyJWT(token string) (*principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errInvalidCredentials
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, errInvalidCredentials
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errInvalidCredentials
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+
+	if len(header.Alg) != 5 {
+		return nil, fmt.Errorf("%w: unsupported alg %q", errInvalidCredentials, header.Alg)
+	}
+	var hash crypto.Hash
+	switch header.Alg[2:] {
+	case "256":
+		hash = crypto.SHA256
+	case "384":
+		hash = crypto.SHA384
+	case "512":
+		hash = crypto.SHA512
+	default:
+		return nil, fmt.Errorf("%w: unsupported alg %q", errInvalidCredentials, header.Alg)
+	}
+	switch header.Alg[:2] {
+	case "HS":
+		if a.hmacSecret == nil {
+			return nil, fmt.Errorf("%w: unsupported alg %q", errInvalidCredentials, header.Alg)
+		}
+		mac := hmac.New(hash.New, a.hmacSecret)
+		mac.Write(signed)
+		if !hmac.Equal(mac.Sum(nil), sig) {
+			return nil, errInvalidCredentials
+		}
+	case "RS":
+		if a.rsaKey == nil {
+			return nil, fmt.Errorf("%w: unsupported alg %q", errInvalidCredentials, header.Alg)
+		}
+		h := hash.New()
+		h.Write(signed)
+		if rsa.VerifyPKCS1v15(a.rsaKey, hash, h.Sum(nil), sig) != nil {
+			return nil, errInvalidCredentials
+		}
+	default:
+		return nil, fmt.Errorf("%w: unsupported alg %q", errInvalidCredentials, header.Alg)
+	}
+
+	var claims jwtClaims
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, errInvalidCredentials
+	}
+	now := a.now()
+	if claims.ExpiresAt == nil {
+		return nil, fmt.Errorf("%w: exp is required", errInvalidCredentials)
+	}
+	if now.After(time.Unix(int64(*claims.ExpiresAt), 0).Add(clockSkew)) {
+		return nil, fmt.Errorf("%w: token expired", errInvalidCredentials)
+	}
+	if claims.NotBefore != nil && now.Add(clockSkew).Before(time.Unix(int64(*claims.NotBefore), 0)) {
+		return nil, fmt.Errorf("%w: token not valid yet", errInvalidCredentials)
+	}
+	if a.issuer != "" && claims.Issuer != a.issuer {
+		return nil, fmt.Errorf("%w: wrong issuer", errInvalidCredentials)
+	}
+	if a.audience != "" && !slices.Contains(claims.Audience, a.audience) {
+		return nil, fmt.Errorf("%w: wrong audience", errInvalidCredentials)
+	}
+	return &principal{Name: claims.Subject, ID: "jwt:" + claims.Issuer + ":" + claims.Subject, Payers: normalizePayers(claims.Payers)}, nil
+}
+
+func decodeJWTPart(part string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// auth is the authenticator of the server; nil leaves the API open.
+var auth *authenticator
+
+const principalKey = "principal"
+
+// requireAuth authenticates every /api/ request when auth is configured and
+// stores the caller in the context.
+func requireAuth(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if auth == nil || !strings.HasPrefix(c.Request().URL.Path, "/api/") {
+			return next(c)
+		}
+		p, err := auth.authenticate(c.Request())
+		if err != nil {
+			c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer realm="pdf50tawi"`)
+			return c.JSON(http.StatusUnauthorized, errResp(err.Error()))
+		}
+		c.Set(principalKey, p)
+		return next(c)
+	}
+}
+
+// caller returns the authenticated caller of c, or nil when the API is open.
+func caller(c echo.Context) *principal {
+	p, _ := c.Get(principalKey).(*principal)
+	return p
+}
+
+// callerName is the name of the caller of c, or "" when the API is open.
+func callerName(c echo.Context) string {
+	if p := caller(c); p != nil {
+		return p.Name
+	}
+	return ""
+}
+
+// authorizePayers refuses, with 403, a caller that may not issue for the
+// payer of every taxInfo, or may not use its image sources.
+func authorizePayers(c echo.Context, taxInfos ...pdf50tawi.TaxInfo) error {
+	for i, t := range taxInfos {
+		err := authorizePayer(c, t.Payer.TaxID)
+		if err == nil {
+			err = authorizeImageSources(c, t.Certification.PayerSignatureImage, t.Certification.CompanySealImage)
+		}
+		var ae *apiError
+		if errors.As(err, &ae) && len(taxInfos) > 1 {
+			ae.msg = fmt.Sprintf("item %d: %s", i, ae.msg)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// authorizeImageSources refuses, with 403, asset sources from a caller
+// limited to some payers. The files of ASSET_DIR belong to no payer, so such
+// a caller could stamp another payer's seal; it uses payer sources instead.
+func authorizeImageSources(c echo.Context, srcs ...*pdf50tawi.ImageSource) error {
+	if p := caller(c); p == nil || slices.Contains(p.Payers, "*") {
+		return nil
+	}
+	for _, src := range srcs {
+		if src != nil && src.SourceType == pdf50tawi.ImageSourceAsset {
+			return &apiError{http.StatusForbidden, `asset sources need a credential for every payer; use {"sourceType": "payer"} for this payer's own images`}
+		}
+	}
+	return nil
+}
+
+// authorizePayer refuses, with 403, a caller that may not act for the payer
+// with taxID.
+func authorizePayer(c echo.Context, taxID string) error {
+	p := caller(c)
+	if p == nil || p.mayIssueFor(taxID) {
+		return nil
+	}
+	if taxID == "" {
+		return &apiError{http.StatusForbidden, "payer.taxId is required to check this credential's payers"}
+	}
+	return &apiError{http.StatusForbidden, fmt.Sprintf("not allowed to issue certificates for payer %q", taxID)}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testNow = time.Date(2026, 1, 31, 9, 0, 0, 0, time.UTC)
+
+func signHS(t *testing.T, alg string, secret []byte, claims map[string]any) string {
+	t.Helper()
+	signed := jwtSigningInput(t, alg, claims)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func signRS(t *testing.T, key *rsa.PrivateKey, claims map[string]any) string {
+	t.Helper()
+	signed := jwtSigningInput(t, "RS256", claims)
+	sum := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func jwtSigningInput(t *testing.T, alg string, claims map[string]any) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+}
+
+func writePublicKey(t *testing.T, key *rsa.PrivateKey) string {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "jwt.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestVerifyJWT(t *testing.T) {
+	secret := []byte("test-secret")
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := newAuthenticator(authConfig{JWT: jwtConfig{
+		HMACSecret:       string(secret),
+		RSAPublicKeyFile: writePublicKey(t, rsaKey),
+		Issuer:           "https://idp.example.com",
+		Audience:         "pdf50tawi",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.now = func() time.Time { return testNow }
+
+	claims := func(edit func(map[string]any)) map[string]any {
+		c := map[string]any{
+			"sub":    "payroll",
+			"iss":    "https://idp.example.com",
+			"aud":    []string{"pdf50tawi", "other"},
+			"exp":    testNow.Add(time.Hour).Unix(),
+			"payers": []string{"0105551234567"},
+		}
+		if edit != nil {
+			edit(c)
+		}
+		return c
+	}
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	pubDER := x509.MarshalPKCS1PublicKey(&rsaKey.PublicKey)
+
+	testCases := []struct {
+		name  string
+		token string
+		ok    bool
+	}{
+		{"HS256", signHS(t, "HS256", secret, claims(nil)), true},
+		{"RS256", signRS(t, rsaKey, claims(nil)), true},
+		{"AudienceString", signHS(t, "HS256", secret, claims(func(c map[string]any) { c["aud"] = "pdf50tawi" })), true},
+		{"WrongSecret", signHS(t, "HS256", []byte("guess"), claims(nil)), false},
+		{"WrongRSAKey", signRS(t, otherKey, claims(nil)), false},
+		{"Expired", signHS(t, "HS256", secret, claims(func(c map[string]any) { c["exp"] = testNow.Add(-time.Hour).Unix() })), false},
+		{"NoExpiry", signHS(t, "HS256", secret, claims(func(c map[string]any) { delete(c, "exp") })), false},
+		{"NotYetValid", signHS(t, "HS256", secret, claims(func(c map[string]any) { c["nbf"] = testNow.Add(time.Hour).Unix() })), false},
+		{"WrongIssuer", signHS(t, "HS256", secret, claims(func(c map[string]any) { c["iss"] = "https://evil.example.com" })), false},
+		{"WrongAudience", signHS(t, "HS256", secret, claims(func(c map[string]any) { c["aud"] = "other" })), false},
+		{"AlgNone", jwtSigningInput(t, "none", claims(nil)) + ".", false},
+		// The public key is not a secret: an HS256 token signed with it
+		// must not pass for an RS256 one.
+		{"AlgConfusion", signHS(t, "HS256", pubDER, claims(nil)), false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := a.verifyJWT(tc.token)
+			if !tc.ok {
+				if !errors.Is(err, errInvalidCredentials) {
+					t.Fatalf("expected errInvalidCredentials, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if p.Name != "payroll" || !p.mayIssueFor("0105551234567") || p.mayIssueFor("0105559876543") {
+				t.Fatalf("unexpected principal %+v", p)
+			}
+		})
+	}
+}
+
+func TestRequireAuth(t *testing.T) {
+	a, err := newAuthenticator(authConfig{APIKeys: []apiKeyConfig{
+		{Name: "acme", Key: "acme-key", Payers: []string{"1234567890123"}},
+		{Name: "other", Key: "other-key", Payers: []string{"0105559876543"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth = a
+	t.Cleanup(func() { auth = nil })
+	e := newServer()
+
+	// The payer of the validate example is 1234567890123.
+	body := `{"taxInfo": {"payer": {"taxId": "1234567890123", "name": "บริษัท ตัวอย่าง จำกัด"}, "payee": {"name": "นาย ก"}}}`
+	testCases := []struct {
+		name   string
+		method string
+		path   string
+		header string
+		value  string
+		want   int
+	}{
+		{"NoCredentials", http.MethodPost, "/api/v1/taxes/validate", "", "", http.StatusUnauthorized},
+		{"WrongKey", http.MethodPost, "/api/v1/taxes/validate", "X-API-Key", "guess", http.StatusUnauthorized},
+		{"APIKeyHeader", http.MethodPost, "/api/v1/taxes/validate", "X-API-Key", "acme-key", http.StatusOK},
+		{"BearerKey", http.MethodPost, "/api/v1/taxes/validate", "Authorization", "Bearer acme-key", http.StatusOK},
+		{"OtherPayer", http.MethodPost, "/api/v1/taxes", "X-API-Key", "other-key", http.StatusForbidden},
+		{"OtherPayerBatch", http.MethodPost, "/api/v1/taxes/batch", "X-API-Key", "other-key", http.StatusForbidden},
+		{"OpenAPIIsPublic", http.MethodGet, "/openapi.json", "", "", http.StatusOK},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			reqBody := body
+			if strings.HasSuffix(tc.path, "/batch") {
+				reqBody = `{"items": [` + body[len(`{"taxInfo": `):len(body)-1] + `]}`
+			}
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(reqBody))
+			req.Header.Set("Content-Type", "application/json")
+			if tc.header != "" {
+				req.Header.Set(tc.header, tc.value)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			if rec.Code != tc.want {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tc.want, rec.Body)
+			}
+		})
+	}
+}
+
+func TestAssetSourcesNeedEveryPayer(t *testing.T) {
+	dir := t.TempDir()
+	var seal bytes.Buffer
+	if err := png.Encode(&seal, image.NewRGBA(image.Rect(0, 0, 20, 20))); err != nil {
+		t.Fatal(err)
+	}
+	// A seal in the shared ASSET_DIR, e.g. another payer's.
+	if err := os.WriteFile(filepath.Join(dir, "other-seal.png"), seal.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	assets = dirAssetStore{dir: dir}
+	a, err := newAuthenticator(authConfig{APIKeys: []apiKeyConfig{
+		{Name: "acme", Key: "acme-key", Payers: []string{"1234567890123"}},
+		{Name: "admin", Key: "admin-key", Payers: []string{"*"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth = a
+	t.Cleanup(func() { assets, auth = nil, nil })
+	e := newServer()
+
+	asset := `{"sourceType": "asset", "value": "other-seal.png"}`
+	taxInfo := `{"payer": {"taxId": "1234567890123", "name": "บริษัท ตัวอย่าง จำกัด"},
+		"payee": {"taxId": "3101234567890", "name": "นาย ก", "pnd_3": true},
+		"income40_2": {"datePaid": "31 มกราคม 2568", "amountPaid": "10,000.00", "taxWithheld": "300.00"},
+		"withholdingType": {"withholdingTax": true},
+		"certification": {"dateOfIssuance": {"day": "31", "month": "มกราคม", "year": "2568"}CERT}}`
+	withSeal := strings.Replace(taxInfo, "CERT", `, "companySealImage": `+asset, 1)
+	plain := strings.Replace(taxInfo, "CERT", "", 1)
+	testCases := []struct {
+		name, path, key, body string
+		want                  int
+	}{
+		{"Restricted", "/api/v1/taxes", "acme-key", `{"taxInfo": ` + withSeal + `}`, http.StatusForbidden},
+		{"RestrictedBatchItem", "/api/v1/taxes/batch", "acme-key", `[` + plain + `, ` + withSeal + `]`, http.StatusForbidden},
+		{"RestrictedBatchShared", "/api/v1/taxes/batch", "acme-key", `{"items": [` + plain + `], "companySealImage": ` + asset + `}`, http.StatusForbidden},
+		{"RestrictedWithoutAsset", "/api/v1/taxes", "acme-key", `{"taxInfo": ` + plain + `}`, http.StatusOK},
+		{"EveryPayer", "/api/v1/taxes", "admin-key", `{"taxInfo": ` + withSeal + `}`, http.StatusOK},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-API-Key", tc.key)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			if rec.Code != tc.want {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tc.want, rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,609 @@
+package main
+
+// ── Batch: many certificates in one request ─────────────────────────────────
+//
+// POST /api/v1/taxes/batch             ZIP of one PDF per item plus manifest.json
+// POST /api/v1/taxes/batch?format=pdf  one merged PDF (422 with the manifest if any item fails)
+//
+// The items are TaxInfo objects, sent as
+//
+//	application/json      [{...}, {...}] or {"items": [...], "payerSignatureImage": {...}, "companySealImage": {...}}
+//	application/x-ndjson  one TaxInfo per line
+//	multipart/form-data   an "items" part holding either of the above, with
+//	                      "signature" and "seal" file parts shared by all items
+//
+// An item's own certification image sources take precedence over the shared
+// images.
+//
+// curl -X POST http://localhost:8080/api/v1/taxes/batch \
+//   -F 'items=@payroll.ndjson' \
+//   -F 'signature=@signature.png' \
+//   -F 'seal=@seal.png' \
+//   -o certificates.zip
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"github.com/AnuchitO/pdf50tawi"
+	"github.com/labstack/echo/v4"
+)
+
+// maxBatchItems bounds one batch request; larger runs belong in a job (see
+// jobs.go) or in several requests.
+const maxBatchItems = 1000
+
+const mimeNDJSON = "application/x-ndjson"
+
+// batchEnvelope is the object form of a JSON batch body.
+type batchEnvelope struct {
+	Items               []pdf50tawi.TaxInfo    `json:"items"`
+	PayerSignatureImage *pdf50tawi.ImageSource `json:"payerSignatureImage,omitempty"`
+	CompanySealImage    *pdf50tawi.ImageSource `json:"companySealImage,omitempty"`
+}
+
+// batchRequest is a parsed batch body. It is held in memory, without the
+// temporary files of the multipart form, so it can outlive the request as
+// an asynchronous job.
+type batchRequest struct {
+	items      []pdf50tawi.TaxInfo
+	sign, seal *pdf50tawi.ImageSource // shared image sources
+	uploads    map[string][]byte      // file parts by name; nil unless multipart
+	maxItems   int
+	issuer     string // the caller, recorded in the registry
+
+	// hold takes a generation slot for one certificate; nil is
+	// waitGeneration, as for a job.
+	hold func(ctx context.Context) (release func(), err error)
+}
+
+// batchItemResult is the manifest entry of one item.
+type batchItemResult struct {
+	Index          int                         `json:"index"` // position in the request, from 0
+	DocumentNumber string                      `json:"documentNumber,omitempty"`
+	PayeeTaxID     string                      `json:"payeeTaxId,omitempty"`
+	File           string                      `json:"file,omitempty"`
+	CertificateID  string                      `json:"certificateId,omitempty"` // in the registry, when it is enabled
+	Error          string                      `json:"error,omitempty"`
+	Issues         []pdf50tawi.ValidationIssue `json:"issues,omitempty"`
+}
+
+// batchManifest is manifest.json.
+type batchManifest struct {
+	Issued  int               `json:"issued"`
+	Failed  int               `json:"failed"`
+	Results []batchItemResult `json:"results"`
+}
+
+func handleBatch(c echo.Context) error {
+	format := c.QueryParam("format")
+	if format == "" {
+		format = "zip"
+	}
+	if format != "zip" && format != "pdf" {
+		return c.JSON(http.StatusBadRequest, errResp("format must be zip or pdf"))
+	}
+
+	req, err := parseBatchRequest(c, maxBatchItems)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	if err := authorizePayers(c, req.items...); err != nil {
+		return errorJSON(c, err)
+	}
+	if err := authorizeImageSources(c, req.sign, req.seal); err != nil {
+		return errorJSON(c, err)
+	}
+	req.issuer = callerName(c)
+	req.hold = batchGenerationSlots()
+	ctx := c.Request().Context()
+	signData, sealData, err := req.sharedImages(ctx)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+
+	if format == "pdf" {
+		var buf bytes.Buffer
+		manifest, err := writeBatchPDF(ctx, &buf, req, signData, sealData, nil)
+		if errors.Is(err, errBusy) {
+			return generationUnavailable(c, err)
+		}
+		if err != nil {
+			return errorJSON(c, err)
+		}
+		if manifest.Failed > 0 {
+			return c.JSON(http.StatusUnprocessableEntity, manifest)
+		}
+		c.Response().Header().Set("Content-Disposition", "attachment; filename=certificates.pdf")
+		return c.Stream(http.StatusOK, "application/pdf", &buf)
+	}
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "application/zip")
+	res.Header().Set("Content-Disposition", "attachment; filename=certificates.zip")
+	// The 200 goes out with the first entry, so a batch turned away for
+	// lack of a generation slot before then still gets 503.
+	_, err = writeBatchZip(ctx, res, req, signData, sealData, res.Flush, nil)
+	if err != nil && !res.Committed {
+		res.Header().Del("Content-Disposition")
+		if errors.Is(err, errBusy) {
+			return generationUnavailable(c, err)
+		}
+		return errorJSON(c, err)
+	}
+	return err // once the status is sent, the client sees a broken archive
+}
+
+// writeBatchZip writes the ZIP of req to w: one PDF per issued item, then
+// manifest.json. Each PDF is registered as it is written. flush, if not nil,
+// is called after each PDF.
+func writeBatchZip(ctx context.Context, w io.Writer, req *batchRequest, signData, sealData []byte, flush func(), progress func(batchManifest)) (batchManifest, error) {
+	zw := zip.NewWriter(w)
+	manifest, err := issueBatch(ctx, req, signData, sealData, false, func(res *batchItemResult, taxInfo pdf50tawi.TaxInfo, pdf []byte) error {
+		rec, err := registerCertificate(req.issuer, taxInfo, pdf)
+		if err != nil {
+			return err
+		}
+		res.CertificateID = rec.ID
+		f, err := zw.Create(res.File)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(pdf); err != nil {
+			return err
+		}
+		if flush != nil {
+			flush()
+		}
+		return nil
+	}, progress)
+	if err != nil {
+		return manifest, err
+	}
+	f, err := zw.Create("manifest.json")
+	if err != nil {
+		return manifest, err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(manifest); err != nil {
+		return manifest, err
+	}
+	return manifest, zw.Close()
+}
+
+// writeBatchPDF writes the certificates of req to w merged into one PDF. If
+// any item fails nothing is written, nor numbered, nor registered, and the
+// manifest says why.
+func writeBatchPDF(ctx context.Context, w io.Writer, req *batchRequest, signData, sealData []byte, progress func(batchManifest)) (batchManifest, error) {
+	var pdfs [][]byte
+	var taxInfos []pdf50tawi.TaxInfo
+	manifest, err := issueBatch(ctx, req, signData, sealData, true, func(_ *batchItemResult, taxInfo pdf50tawi.TaxInfo, pdf []byte) error {
+		pdfs = append(pdfs, pdf)
+		taxInfos = append(taxInfos, taxInfo)
+		return nil
+	}, progress)
+	if err != nil || manifest.Failed > 0 {
+		return manifest, err
+	}
+	for i, pdf := range pdfs {
+		rec, err := registerCertificate(req.issuer, taxInfos[i], pdf)
+		if err != nil {
+			return manifest, err
+		}
+		manifest.Results[i].CertificateID = rec.ID
+	}
+	return manifest, pdf50tawi.MergePDFs(w, pdfs...)
+}
+
+// issueBatch generates the certificate of every valid item, with the shared
+// images unless the item names its own, and hands it to emit with its
+// manifest entry, File already set. Invalid items and items whose images
+// cannot be loaded are recorded in the manifest and skipped; an error is
+// returned only when emit fails, ctx is done or no generation slot is to be
+// had (req.hold). progress, if not nil, is called after each item.
+//
+// With allOrNothing, as for a merged PDF, every item is checked and its
+// images loaded before any is numbered, and none is generated if one
+// fails: a batch that issues nothing takes no numbers.
+func issueBatch(ctx context.Context, req *batchRequest, signData, sealData []byte, allOrNothing bool, emit func(res *batchItemResult, taxInfo pdf50tawi.TaxInfo, pdf []byte) error, progress func(manifest batchManifest)) (batchManifest, error) {
+	manifest := batchManifest{Results: make([]batchItemResult, 0, len(req.items))}
+	record := func(res batchItemResult) {
+		manifest.Results = append(manifest.Results, res)
+		if progress != nil {
+			progress(manifest)
+		}
+	}
+	hold := req.hold
+	if hold == nil {
+		hold = waitGeneration
+	}
+	// issue numbers and generates item i, holding a generation slot; only
+	// a slot refused or emit's error stops the batch.
+	issue := func(i int, item *batchItem) error {
+		res := newBatchItemResult(i, item.taxInfo)
+		release, err := hold(ctx)
+		if err != nil {
+			return err
+		}
+		pdf, err := item.generate(ctx)
+		release()
+		if err != nil {
+			res.setError(err)
+			manifest.Failed++
+		} else {
+			res.DocumentNumber = item.taxInfo.DocumentDetails.DocumentNumber // numbered if it was empty
+			res.File = batchFileName(i, item.taxInfo.DocumentDetails.DocumentNumber)
+			if err := emit(&res, item.taxInfo, pdf); err != nil {
+				return err
+			}
+			manifest.Issued++
+		}
+		record(res)
+		return nil
+	}
+
+	var ready []*batchItem
+	var checked []batchItemResult // with allOrNothing, the results of the check
+	for i, taxInfo := range req.items {
+		if err := ctx.Err(); err != nil {
+			return manifest, err
+		}
+		item, err := prepareBatchItem(ctx, req, taxInfo, signData, sealData)
+		switch {
+		case err != nil:
+			res := newBatchItemResult(i, taxInfo)
+			res.setError(err)
+			manifest.Failed++
+			if allOrNothing {
+				checked = append(checked, res)
+			} else {
+				record(res)
+			}
+		case allOrNothing:
+			ready = append(ready, item)
+			checked = append(checked, newBatchItemResult(i, taxInfo))
+		default:
+			if err := issue(i, item); err != nil {
+				return manifest, err
+			}
+		}
+	}
+	if !allOrNothing {
+		return manifest, nil
+	}
+	if manifest.Failed > 0 {
+		manifest.Results = checked
+		if progress != nil {
+			progress(manifest)
+		}
+		return manifest, nil
+	}
+	// Every item is ready, so ready[i] is item i.
+	for i, item := range ready {
+		if err := ctx.Err(); err != nil {
+			return manifest, err
+		}
+		if err := issue(i, item); err != nil {
+			return manifest, err
+		}
+	}
+	return manifest, nil
+}
+
+func newBatchItemResult(i int, taxInfo pdf50tawi.TaxInfo) batchItemResult {
+	return batchItemResult{Index: i, DocumentNumber: taxInfo.DocumentDetails.DocumentNumber, PayeeTaxID: taxInfo.Payee.TaxID}
+}
+
+// setError records why the item failed.
+func (res *batchItemResult) setError(err error) {
+	var ve *pdf50tawi.ValidationError
+	if errors.As(err, &ve) {
+		res.Issues = ve.Issues
+	}
+	res.Error = err.Error()
+}
+
+// batchItem is an item that is valid and has its images loaded.
+type batchItem struct {
+	taxInfo    pdf50tawi.TaxInfo
+	sign, seal []byte
+}
+
+// prepareBatchItem validates taxInfo and loads its images.
+func prepareBatchItem(ctx context.Context, req *batchRequest, taxInfo pdf50tawi.TaxInfo, signData, sealData []byte) (*batchItem, error) {
+	if err := validateTaxInfo(opBatch, taxInfo); err != nil {
+		return nil, err
+	}
+	item := &batchItem{taxInfo: taxInfo, sign: signData, seal: sealData}
+	// Shared payer sources were left for each item to resolve, as the
+	// items may name different payers.
+	signSrc, sealSrc := taxInfo.Certification.PayerSignatureImage, taxInfo.Certification.CompanySealImage
+	if signSrc == nil && isPayerSource(req.sign) {
+		signSrc = req.sign
+	}
+	if sealSrc == nil && isPayerSource(req.seal) {
+		sealSrc = req.seal
+	}
+	for _, img := range []struct {
+		label string
+		src   *pdf50tawi.ImageSource
+		data  *[]byte
+	}{
+		{"certification.payerSignatureImage", signSrc, &item.sign},
+		{"certification.companySealImage", sealSrc, &item.seal},
+	} {
+		if img.src == nil {
+			continue
+		}
+		r, err := resolveImage(ctx, img.src, req.upload(), taxInfo.Payer.TaxID)
+		if err == nil && r != nil {
+			*img.data, err = io.ReadAll(r)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", img.label, err)
+		}
+	}
+	return item, nil
+}
+
+// generate fills in the empty numbers of the item when numbering is
+// enabled, and generates its certificate.
+func (item *batchItem) generate(ctx context.Context) ([]byte, error) {
+	if err := assignNumbers(ctx, &item.taxInfo); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := issuePDF(opBatch, &buf, item.taxInfo, optionalReader(item.sign), optionalReader(item.seal)); err != nil {
+		return nil, fmt.Errorf("generate certificate: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func isPayerSource(src *pdf50tawi.ImageSource) bool {
+	return src != nil && src.SourceType == pdf50tawi.ImageSourcePayer
+}
+
+// sharedImages loads the images shared by all items: the envelope's image
+// sources, or the signature and seal parts of a multipart request. Payer
+// sources are resolved per item instead.
+func (r *batchRequest) sharedImages(ctx context.Context) (sign, seal []byte, err error) {
+	load := func(label string, src *pdf50tawi.ImageSource, part string) ([]byte, error) {
+		var img io.Reader
+		var err error
+		switch upload := r.upload(); {
+		case isPayerSource(src):
+			if src.Value != pdf50tawi.PayerAssetSignature && src.Value != pdf50tawi.PayerAssetSeal {
+				return nil, badRequest(label + ".value must be signature or seal")
+			}
+			return nil, nil
+		case src != nil:
+			img, err = resolveImage(ctx, src, upload, "")
+		case upload != nil:
+			img, err = upload(part)
+		}
+		if err != nil {
+			return nil, badRequest(label + ": " + err.Error())
+		}
+		if img == nil {
+			return nil, nil
+		}
+		return io.ReadAll(img)
+	}
+	if sign, err = load("payerSignatureImage", r.sign, "signature"); err != nil {
+		return nil, nil, err
+	}
+	if seal, err = load("companySealImage", r.seal, "seal"); err != nil {
+		return nil, nil, err
+	}
+	return sign, seal, nil
+}
+
+// upload returns the file parts of a multipart request, nil otherwise.
+func (r *batchRequest) upload() uploadFunc {
+	if r.uploads == nil {
+		return nil
+	}
+	return func(part string) (io.Reader, error) {
+		data, ok := r.uploads[part]
+		if !ok {
+			return nil, nil
+		}
+		return pdf50tawi.CheckImage(bytes.NewReader(data), pdf50tawi.DefaultImageLimits)
+	}
+}
+
+// parseBatchRequest reads the items, at most maxItems of them, and the
+// shared image sources.
+func parseBatchRequest(c echo.Context, maxItems int) (*batchRequest, error) {
+	req := &batchRequest{maxItems: maxItems}
+	var body io.Reader
+	mediaType, _, _ := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+	switch mediaType {
+	case echo.MIMEApplicationJSON, mimeNDJSON:
+		body = c.Request().Body
+	case echo.MIMEMultipartForm:
+		form, err := c.MultipartForm()
+		if err != nil {
+			return nil, badRequest("parse multipart form: " + err.Error())
+		}
+		defer form.RemoveAll()
+		if body, err = formItems(form); err != nil {
+			return nil, err
+		}
+		if req.uploads, err = formUploads(form); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, &apiError{http.StatusUnsupportedMediaType, "Content-Type must be application/json, application/x-ndjson or multipart/form-data"}
+	}
+
+	if err := req.decodeItems(body); err != nil {
+		return nil, err
+	}
+	if len(req.items) == 0 {
+		return nil, badRequest("no items")
+	}
+	return req, nil
+}
+
+// formItems returns the "items" field or file part of form.
+func formItems(form *multipart.Form) (io.Reader, error) {
+	if v := form.Value["items"]; len(v) > 0 {
+		return strings.NewReader(v[0]), nil
+	}
+	if f := form.File["items"]; len(f) > 0 {
+		return readPart(f[0])
+	}
+	return nil, badRequest("missing 'items' form field")
+}
+
+// formUploads reads every file part except items into memory.
+func formUploads(form *multipart.Form) (map[string][]byte, error) {
+	uploads := map[string][]byte{}
+	for name, files := range form.File {
+		if name == "items" || len(files) == 0 {
+			continue
+		}
+		r, err := readPart(files[0])
+		if err != nil {
+			return nil, err
+		}
+		uploads[name] = r.Bytes()
+	}
+	return uploads, nil
+}
+
+func readPart(fh *multipart.FileHeader) (*bytes.Buffer, error) {
+	f, err := fh.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, f); err != nil {
+		return nil, err
+	}
+	return &buf, nil
+}
+
+// decodeItems accepts a JSON array, the batchEnvelope object or a stream of
+// TaxInfo values such as NDJSON.
+func (r *batchRequest) decodeItems(body io.Reader) error {
+	br := bufio.NewReader(body)
+	first, err := firstNonSpace(br)
+	if err != nil {
+		return badRequest("empty body")
+	}
+	dec := json.NewDecoder(br)
+
+	switch first {
+	case '[':
+		if _, err := dec.Token(); err != nil {
+			return badRequest("invalid JSON body: " + err.Error())
+		}
+		for dec.More() {
+			if err := r.decodeItem(dec); err != nil {
+				return err
+			}
+		}
+		return nil
+	case '{':
+		// Either the envelope or the first TaxInfo of a stream: an
+		// envelope has an "items" key.
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return badRequest("invalid JSON body: " + err.Error())
+		}
+		var probe map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &probe); err != nil {
+			return badRequest("invalid JSON body: " + err.Error())
+		}
+		if _, ok := probe["items"]; ok {
+			var env batchEnvelope
+			if err := json.Unmarshal(raw, &env); err != nil {
+				return badRequest("invalid JSON body: " + err.Error())
+			}
+			if len(env.Items) > r.maxItems {
+				return tooManyItems(r.maxItems)
+			}
+			r.items, r.sign, r.seal = env.Items, env.PayerSignatureImage, env.CompanySealImage
+			return nil
+		}
+		var taxInfo pdf50tawi.TaxInfo
+		if err := json.Unmarshal(raw, &taxInfo); err != nil {
+			return badRequest("item 0: " + err.Error())
+		}
+		r.items = append(r.items, taxInfo)
+		for dec.More() {
+			if err := r.decodeItem(dec); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return badRequest("body must be a JSON array, an object with items, or NDJSON")
+}
+
+func (r *batchRequest) decodeItem(dec *json.Decoder) error {
+	if len(r.items) == r.maxItems {
+		return tooManyItems(r.maxItems)
+	}
+	var taxInfo pdf50tawi.TaxInfo
+	if err := dec.Decode(&taxInfo); err != nil {
+		return badRequest(fmt.Sprintf("item %d: %v", len(r.items), err))
+	}
+	r.items = append(r.items, taxInfo)
+	return nil
+}
+
+func tooManyItems(max int) error {
+	return &apiError{http.StatusRequestEntityTooLarge, fmt.Sprintf("at most %d items per batch", max)}
+}
+
+// firstNonSpace returns the first byte of br that is not JSON whitespace,
+// leaving it unread.
+func firstNonSpace(br *bufio.Reader) (byte, error) {
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if b != ' ' && b != '\t' && b != '\r' && b != '\n' {
+			return b, br.UnreadByte()
+		}
+	}
+}
+
+// batchFileName names the PDF of item i inside the ZIP, e.g.
+// "0001_WHT-001.pdf". The index keeps names unique.
+func batchFileName(i int, documentNumber string) string {
+	clean := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) || r < ' ' {
+			return '-'
+		}
+		return r
+	}, documentNumber)
+	if clean == "" {
+		return fmt.Sprintf("%04d.pdf", i+1)
+	}
+	return fmt.Sprintf("%04d_%s.pdf", i+1, clean)
+}
+
+func optionalReader(data []byte) io.Reader {
+	if data == nil {
+		return nil
+	}
+	return bytes.NewReader(data)
+}
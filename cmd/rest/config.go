@@ -0,0 +1,210 @@
+package main
+
+// ── Server configuration ─────────────────────────────────────────────────────
+//
+// Settings are read from the JSON file named by CONFIG_FILE, if any, then
+// each environment variable overrides its setting:
+//
+//	CONFIG_FILE       e.g. /etc/pdf50tawi/server.json
+//	ADDR              listen address, default ":8080" (PORT=9000 still means ":9000")
+//	TLS_CERT_FILE     serve HTTPS with this certificate ...
+//	TLS_KEY_FILE      ... and key; both or neither
+//	BODY_LIMIT        largest request body, e.g. "512K", "64M" (default 64M)
+//	READ_TIMEOUT      reading a whole request, default 1m
+//	WRITE_TIMEOUT     writing a whole response, default 5m
+//	IDLE_TIMEOUT      keep-alive connections, default 2m
+//	SHUTDOWN_DELAY    how long SIGTERM keeps serving, with /readyz failing, before
+//	                  closing the listener, so load balancers stop routing first (default 0)
+//	SHUTDOWN_TIMEOUT  how long SIGTERM then waits for requests and jobs, default 30s
+//	CORS_ORIGINS      comma-separated origins allowed to call the API from a browser
+//	RATE_LIMIT        requests per second for each caller on /api/, e.g. "5" or "0.5" (default off)
+//	RATE_BURST        requests a caller may make at once, default 10
+//	MAX_GENERATIONS   certificates generated at the same time, default twice the CPUs
+//	GENERATION_QUEUE  requests waiting for a generation, default 100
+//	GENERATION_WAIT   how long each may wait, default 10s
+//	LOG_LEVEL         debug, info (default), warn or error
+//	LOG_FORMAT        json (default) or text
+//
+// The file uses the same settings in camelCase:
+//
+//	{"addr": ":8443", "tlsCertFile": "cert.pem", "tlsKeyFile": "key.pem",
+//	 "bodyLimit": "16M", "writeTimeout": "2m", "corsOrigins": ["https://hr.example.com"]}
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type serverConfig struct {
+	Addr            string     `json:"addr"`
+	TLSCertFile     string     `json:"tlsCertFile"`
+	TLSKeyFile      string     `json:"tlsKeyFile"`
+	BodyLimit       byteSize   `json:"bodyLimit"`
+	ReadTimeout     duration   `json:"readTimeout"`
+	WriteTimeout    duration   `json:"writeTimeout"`
+	IdleTimeout     duration   `json:"idleTimeout"`
+	ShutdownDelay   duration   `json:"shutdownDelay"`
+	ShutdownTimeout duration   `json:"shutdownTimeout"`
+	CORSOrigins     []string   `json:"corsOrigins"`
+	RateLimit       float64    `json:"rateLimit"`
+	RateBurst       int        `json:"rateBurst"`
+	MaxGenerations  int        `json:"maxGenerations"`
+	GenerationQueue int        `json:"generationQueue"`
+	GenerationWait  duration   `json:"generationWait"`
+	LogLevel        slog.Level `json:"logLevel"`
+	LogFormat       string     `json:"logFormat"`
+}
+
+// config is the configuration of the server. Its zero value, which tests
+// use, sets no body limit and no CORS.
+var config serverConfig
+
+func defaultServerConfig() serverConfig {
+	return serverConfig{
+		Addr:            ":8080",
+		BodyLimit:       64 << 20,
+		ReadTimeout:     duration(time.Minute),
+		WriteTimeout:    duration(5 * time.Minute),
+		IdleTimeout:     duration(2 * time.Minute),
+		ShutdownTimeout: duration(30 * time.Second),
+		RateBurst:       10,
+		MaxGenerations:  2 * runtime.GOMAXPROCS(0),
+		GenerationQueue: 100,
+		GenerationWait:  duration(10 * time.Second),
+		LogLevel:        slog.LevelInfo,
+		LogFormat:       "json",
+	}
+}
+
+// serverConfigFromEnv reads CONFIG_FILE, then lets the environment override
+// it; see the top of this file.
+func serverConfigFromEnv() (serverConfig, error) {
+	cfg := defaultServerConfig()
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return cfg, fmt.Errorf("CONFIG_FILE: %w", err)
+		}
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return cfg, fmt.Errorf("CONFIG_FILE %s: %w", path, err)
+		}
+	}
+
+	if v := os.Getenv("PORT"); v != "" {
+		cfg.Addr = ":" + v
+	}
+	for env, field := range map[string]*string{
+		"ADDR":          &cfg.Addr,
+		"TLS_CERT_FILE": &cfg.TLSCertFile,
+		"TLS_KEY_FILE":  &cfg.TLSKeyFile,
+		"LOG_FORMAT":    &cfg.LogFormat,
+	} {
+		if v := os.Getenv(env); v != "" {
+			*field = v
+		}
+	}
+	for env, field := range map[string]interface{ UnmarshalText([]byte) error }{
+		"BODY_LIMIT":       &cfg.BodyLimit,
+		"READ_TIMEOUT":     &cfg.ReadTimeout,
+		"WRITE_TIMEOUT":    &cfg.WriteTimeout,
+		"IDLE_TIMEOUT":     &cfg.IdleTimeout,
+		"SHUTDOWN_DELAY":   &cfg.ShutdownDelay,
+		"SHUTDOWN_TIMEOUT": &cfg.ShutdownTimeout,
+		"GENERATION_WAIT":  &cfg.GenerationWait,
+		"LOG_LEVEL":        &cfg.LogLevel,
+	} {
+		if v := os.Getenv(env); v != "" {
+			if err := field.UnmarshalText([]byte(v)); err != nil {
+				return cfg, fmt.Errorf("%s: %w", env, err)
+			}
+		}
+	}
+	for env, field := range map[string]*int{
+		"RATE_BURST":       &cfg.RateBurst,
+		"MAX_GENERATIONS":  &cfg.MaxGenerations,
+		"GENERATION_QUEUE": &cfg.GenerationQueue,
+	} {
+		var err error
+		if *field, err = envInt(env, *field); err != nil {
+			return cfg, err
+		}
+	}
+	if v := os.Getenv("RATE_LIMIT"); v != "" {
+		r, err := strconv.ParseFloat(v, 64)
+		if err != nil || r <= 0 {
+			return cfg, fmt.Errorf("RATE_LIMIT: must be a positive number, got %q", v)
+		}
+		cfg.RateLimit = r
+	}
+	if v := os.Getenv("CORS_ORIGINS"); v != "" {
+		cfg.CORSOrigins = nil
+		for _, origin := range strings.Split(v, ",") {
+			if origin = strings.TrimSpace(origin); origin != "" {
+				cfg.CORSOrigins = append(cfg.CORSOrigins, origin)
+			}
+		}
+	}
+
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		return cfg, errors.New("TLS needs both a certificate and a key file")
+	}
+	if cfg.LogFormat != "json" && cfg.LogFormat != "text" {
+		return cfg, fmt.Errorf("logFormat must be json or text, got %q", cfg.LogFormat)
+	}
+	if cfg.RateLimit < 0 || cfg.RateBurst < 1 || cfg.MaxGenerations < 1 || cfg.GenerationQueue < 0 {
+		return cfg, errors.New("rateLimit, rateBurst, maxGenerations and generationQueue must be positive")
+	}
+	if cfg.BodyLimit <= 0 {
+		return cfg, errors.New("bodyLimit must be positive")
+	}
+	return cfg, nil
+}
+
+// duration is a time.Duration written as in "30s" or "5m".
+type duration time.Duration
+
+func (d *duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	if v <= 0 {
+		return fmt.Errorf("must be a positive duration, got %q", text)
+	}
+	*d = duration(v)
+	return nil
+}
+
+// byteSize is a number of bytes written as in "1048576", "512K", "64M" or
+// "1G".
+type byteSize int64
+
+func (b *byteSize) UnmarshalText(text []byte) error {
+	s := strings.ToUpper(strings.TrimSpace(string(text)))
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "B"), "I")
+	shift := 0
+	switch {
+	case strings.HasSuffix(s, "K"):
+		shift = 10
+	case strings.HasSuffix(s, "M"):
+		shift = 20
+	case strings.HasSuffix(s, "G"):
+		shift = 30
+	}
+	if shift > 0 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n <= 0 || n > 1<<(62-shift) {
+		return fmt.Errorf("must be a size such as 512K or 64M, got %q", text)
+	}
+	*b = byteSize(n << shift)
+	return nil
+}
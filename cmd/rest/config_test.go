@@ -0,0 +1,80 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestServerConfigFromEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.json")
+	file := `{"addr": ":8443", "tlsCertFile": "cert.pem", "tlsKeyFile": "key.pem",
+		"bodyLimit": "16M", "writeTimeout": "2m", "corsOrigins": ["https://hr.example.com"], "logLevel": "debug"}`
+	if err := os.WriteFile(path, []byte(file), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONFIG_FILE", path)
+	t.Setenv("READ_TIMEOUT", "10s")
+	t.Setenv("CORS_ORIGINS", "https://a.example.com, https://b.example.com")
+
+	cfg, err := serverConfigFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := defaultServerConfig()
+	want.Addr = ":8443"
+	want.TLSCertFile, want.TLSKeyFile = "cert.pem", "key.pem"
+	want.BodyLimit = 16 << 20
+	want.ReadTimeout = duration(10 * time.Second)
+	want.WriteTimeout = duration(2 * time.Minute)
+	want.CORSOrigins = []string{"https://a.example.com", "https://b.example.com"}
+	want.LogLevel = slog.LevelDebug
+	if !reflect.DeepEqual(cfg, want) {
+		t.Fatalf("got %+v\nwant %+v", cfg, want)
+	}
+}
+
+func TestServerConfigFromEnv_Invalid(t *testing.T) {
+	testCases := []struct {
+		name, env, value string
+	}{
+		{"BodyLimit", "BODY_LIMIT", "lots"},
+		{"NegativeTimeout", "WRITE_TIMEOUT", "-1s"},
+		{"LogLevel", "LOG_LEVEL", "loud"},
+		{"LogFormat", "LOG_FORMAT", "xml"},
+		{"CertWithoutKey", "TLS_CERT_FILE", "cert.pem"},
+		{"MissingFile", "CONFIG_FILE", "/nonexistent/server.json"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv(tc.env, tc.value)
+			if _, err := serverConfigFromEnv(); err == nil {
+				t.Fatalf("%s=%s: expected an error", tc.env, tc.value)
+			}
+		})
+	}
+}
+
+func TestByteSize(t *testing.T) {
+	for in, want := range map[string]byteSize{
+		"1048576": 1 << 20,
+		"512K":    512 << 10,
+		"64M":     64 << 20,
+		"64mb":    64 << 20,
+		"1GiB":    1 << 30,
+	} {
+		var b byteSize
+		if err := b.UnmarshalText([]byte(in)); err != nil || b != want {
+			t.Errorf("%q: got %d, %v; want %d", in, b, err, want)
+		}
+	}
+	for _, in := range []string{"", "0", "-5M", "M", "12T"} {
+		var b byteSize
+		if err := b.UnmarshalText([]byte(in)); err == nil {
+			t.Errorf("%q: expected an error", in)
+		}
+	}
+}
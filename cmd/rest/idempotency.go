@@ -0,0 +1,257 @@
+package main
+
+// ── Idempotency keys ─────────────────────────────────────────────────────────
+//
+// A client that retries a request it is unsure went through sends the same
+// Idempotency-Key header each time. The first successful response under a
+// key is kept for IDEMPOTENCY_TTL and replayed, with Idempotent-Replayed:
+// true, for every retry, so a certificate is issued (and a job submitted)
+// once however many times the request is sent.
+//
+//	same key, same request, first still running   409, Retry-After: 1
+//	same key, different request                   409
+//	first request failed (not 2xx, or cut off)    nothing kept; a retry runs again
+//
+// Keys are per caller: two API keys can use the same Idempotency-Key. Two
+// requests are the same when method, path, query and body are byte for byte
+// equal (multipart boundaries aside). Responses larger than
+// IDEMPOTENCY_MAX_RESPONSE are not kept; submit a large batch as a job.
+//
+// A ZIP batch is streamed: its 200 goes out before the first certificate.
+// If it breaks off, the truncated archive is not kept and a retry issues
+// the whole batch again, so retry batches safely as jobs.
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	headerIdempotencyKey      = "Idempotency-Key"
+	headerIdempotentReplayed  = "Idempotent-Replayed"
+	maxIdempotencyKeyLength   = 255
+	defaultIdempotencyMaxBody = 32 << 20
+)
+
+// idempotencyCache keeps the responses of requests sent with an
+// Idempotency-Key.
+type idempotencyCache struct {
+	store       idempotencyStore
+	ttl         time.Duration
+	maxResponse int64
+}
+
+// idempotency serves the routes wrapped in idempotent; nil ignores the
+// Idempotency-Key header.
+var idempotency *idempotencyCache
+
+// newIdempotencyCache returns a cache keeping responses in store for ttl,
+// with a janitor removing them once expired.
+func newIdempotencyCache(store idempotencyStore, ttl time.Duration, maxResponse int64) *idempotencyCache {
+	c := &idempotencyCache{store: store, ttl: ttl, maxResponse: maxResponse}
+	go c.janitor()
+	return c
+}
+
+// idempotencyFromEnv configures the cache from IDEMPOTENCY_TTL (default
+// 24h), IDEMPOTENCY_MAX_RESPONSE (default 32M) and IDEMPOTENCY_STORE
+// ("memory", the default, or "sqlite:<path>").
+func idempotencyFromEnv() (*idempotencyCache, error) {
+	ttl := 24 * time.Hour
+	if v := os.Getenv("IDEMPOTENCY_TTL"); v != "" {
+		var err error
+		if ttl, err = time.ParseDuration(v); err != nil || ttl <= 0 {
+			return nil, fmt.Errorf("IDEMPOTENCY_TTL: must be a positive duration, got %q", v)
+		}
+	}
+	maxResponse := byteSize(defaultIdempotencyMaxBody)
+	if v := os.Getenv("IDEMPOTENCY_MAX_RESPONSE"); v != "" {
+		if err := maxResponse.UnmarshalText([]byte(v)); err != nil || maxResponse <= 0 {
+			return nil, fmt.Errorf("IDEMPOTENCY_MAX_RESPONSE: must be a positive size, got %q", v)
+		}
+	}
+	var store idempotencyStore
+	switch v := os.Getenv("IDEMPOTENCY_STORE"); {
+	case v == "" || v == "memory":
+		store = newMemoryIdempotencyStore()
+	case strings.HasPrefix(v, "sqlite:"):
+		var err error
+		if store, err = openSQLiteIdempotencyStore(strings.TrimPrefix(v, "sqlite:")); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("IDEMPOTENCY_STORE: must be memory or sqlite:<path>, got %q", v)
+	}
+	return newIdempotencyCache(store, ttl, int64(maxResponse)), nil
+}
+
+// janitor removes expired responses.
+func (ic *idempotencyCache) janitor() {
+	interval := min(ic.ttl, time.Minute)
+	for range time.Tick(interval) {
+		if _, err := ic.store.DeleteExpired(time.Now()); err != nil {
+			slog.Error("remove expired idempotency keys", "err", err)
+		}
+	}
+}
+
+// idempotent is the route middleware of the routes that honour
+// Idempotency-Key. It runs before holdGeneration, so a replay does not wait
+// for a generation slot.
+func idempotent(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		key := c.Request().Header.Get(headerIdempotencyKey)
+		if idempotency == nil || key == "" {
+			return next(c)
+		}
+		if !validIdempotencyKey(key) {
+			return c.JSON(http.StatusBadRequest, errResp(fmt.Sprintf("%s must be 1 to %d printable characters", headerIdempotencyKey, maxIdempotencyKeyLength)))
+		}
+		req := c.Request()
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				return c.JSON(http.StatusRequestEntityTooLarge, errResp(err.Error()))
+			}
+			return c.JSON(http.StatusBadRequest, errResp(err.Error()))
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		fingerprint := requestFingerprint(req, body)
+
+		scoped := key
+		if p := caller(c); p != nil {
+			scoped = p.ID + "\x00" + key
+		}
+		rec, err := idempotency.store.Begin(scoped, fingerprint, time.Now().Add(idempotency.ttl))
+		if err != nil {
+			return err
+		}
+		switch {
+		case rec == nil:
+		case rec.Fingerprint != fingerprint:
+			return c.JSON(http.StatusConflict, errResp(headerIdempotencyKey+" was already used for a different request"))
+		case rec.Response == nil:
+			setRetryAfter(c, time.Second)
+			return c.JSON(http.StatusConflict, errResp("a request with this "+headerIdempotencyKey+" is still in progress"))
+		default:
+			return replay(c, rec.Response)
+		}
+
+		res := c.Response()
+		rw := &recordingWriter{ResponseWriter: res.Writer, max: idempotency.maxResponse}
+		res.Writer = rw
+		returned := false
+		defer func() {
+			// A panic in next would otherwise leave the key in progress,
+			// answering 409 until it expires.
+			if !returned {
+				res.Writer = rw.ResponseWriter
+				if err := idempotency.store.Release(scoped); err != nil {
+					slog.Error("release idempotency key", "err", err)
+				}
+			}
+		}()
+		err = next(c)
+		returned = true
+		if err != nil {
+			// Let the error handler answer now, so that its status decides
+			// below. It skips the committed response when observe calls it
+			// again, and the error is still logged.
+			c.Error(err)
+		}
+		res.Writer = rw.ResponseWriter
+
+		// An error after the status was sent, such as a ZIP batch cut off
+		// mid-stream, leaves a truncated body that must not be replayed.
+		if err != nil || res.Status < 200 || res.Status > 299 || rw.overflow {
+			if err := idempotency.store.Release(scoped); err != nil {
+				slog.Error("release idempotency key", "err", err)
+			}
+			return err
+		}
+		header := res.Header().Clone()
+		header.Del(echo.HeaderXRequestID)
+		header.Del("Retry-After")
+		stored := storedResponse{Status: res.Status, Header: header, Body: rw.body.Bytes()}
+		if err := idempotency.store.Complete(scoped, stored); err != nil {
+			slog.Error("keep idempotent response", "err", err)
+		}
+		return err
+	}
+}
+
+// replay answers with a kept response.
+func replay(c echo.Context, res *storedResponse) error {
+	h := c.Response().Header()
+	for k, v := range res.Header {
+		h[k] = v
+	}
+	h.Set(headerIdempotentReplayed, "true")
+	c.Response().WriteHeader(res.Status)
+	_, err := c.Response().Write(res.Body)
+	return err
+}
+
+func validIdempotencyKey(key string) bool {
+	if len(key) > maxIdempotencyKeyLength {
+		return false
+	}
+	for _, r := range key {
+		if r < 0x20 || r > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// requestFingerprint identifies a request by method, path, query and body.
+// The multipart boundary is left out: a client picks a new one each time it
+// builds the same form.
+func requestFingerprint(req *http.Request, body []byte) string {
+	mediaType, params, _ := mime.ParseMediaType(req.Header.Get(echo.HeaderContentType))
+	if boundary := params["boundary"]; boundary != "" {
+		body = bytes.ReplaceAll(body, []byte(boundary), nil)
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s?%s\n%s\n", req.Method, req.URL.Path, req.URL.RawQuery, mediaType)
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// recordingWriter keeps a copy of what is written, up to max bytes.
+type recordingWriter struct {
+	http.ResponseWriter
+	max      int64
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (w *recordingWriter) Write(p []byte) (int, error) {
+	if !w.overflow {
+		if int64(w.body.Len()+len(p)) > w.max {
+			w.overflow = true
+			w.body = bytes.Buffer{}
+		} else {
+			w.body.Write(p)
+		}
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Unwrap lets http.ResponseController reach the connection's writer.
+func (w *recordingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
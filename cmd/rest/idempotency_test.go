@@ -0,0 +1,231 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestIdempotencyStores(t *testing.T) {
+	sqlite, err := openSQLiteIdempotencyStore(filepath.Join(t.TempDir(), "idempotency.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stores := map[string]idempotencyStore{"Memory": newMemoryIdempotencyStore(), "SQLite": sqlite}
+	for name, s := range stores {
+		t.Run(name, func(t *testing.T) {
+			later := time.Now().Add(time.Hour)
+			if rec, err := s.Begin("k", "fp", later); err != nil || rec != nil {
+				t.Fatalf("first Begin: %v, %v", rec, err)
+			}
+			rec, err := s.Begin("k", "other", later)
+			if err != nil || rec == nil || rec.Fingerprint != "fp" || rec.Response != nil {
+				t.Fatalf("Begin while in progress: %+v, %v", rec, err)
+			}
+			res := storedResponse{Status: 201, Header: http.Header{"Content-Type": {"application/pdf"}}, Body: []byte("%PDF")}
+			if err := s.Complete("k", res); err != nil {
+				t.Fatal(err)
+			}
+			rec, err = s.Begin("k", "fp", later)
+			if err != nil || rec == nil || rec.Response == nil {
+				t.Fatalf("Begin once complete: %+v, %v", rec, err)
+			}
+			if got := rec.Response; got.Status != 201 || string(got.Body) != "%PDF" || got.Header.Get("Content-Type") != "application/pdf" {
+				t.Fatalf("kept response %+v", got)
+			}
+
+			// A released key can be reserved again.
+			s.Begin("r", "fp", later)
+			if err := s.Release("r"); err != nil {
+				t.Fatal(err)
+			}
+			if rec, _ := s.Begin("r", "fp2", later); rec != nil {
+				t.Fatalf("released key still held: %+v", rec)
+			}
+
+			// So can an expired one, once it is removed or even before.
+			s.Begin("x", "fp", time.Now().Add(-time.Second))
+			if rec, _ := s.Begin("x", "fp2", later); rec != nil {
+				t.Fatalf("expired key still held: %+v", rec)
+			}
+			s.Begin("y", "fp", time.Now().Add(-time.Second))
+			if n, err := s.DeleteExpired(time.Now()); err != nil || n != 1 {
+				t.Fatalf("DeleteExpired: %d, %v", n, err)
+			}
+		})
+	}
+}
+
+func TestIdempotent(t *testing.T) {
+	idempotency = &idempotencyCache{store: newMemoryIdempotencyStore(), ttl: time.Hour, maxResponse: 1 << 20}
+	t.Cleanup(func() { idempotency = nil })
+
+	calls := 0
+	status := http.StatusOK
+	e := echo.New()
+	e.Use(observe)
+	e.POST("/issue", func(c echo.Context) error {
+		calls++
+		return c.Blob(status, "application/pdf", []byte("certificate"))
+	}, idempotent)
+	panics := true
+	e.POST("/panic", func(c echo.Context) error {
+		if panics {
+			panic("generation failed")
+		}
+		return c.Blob(http.StatusOK, "application/pdf", []byte("certificate"))
+	}, idempotent)
+
+	post := func(key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/issue", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := post("payroll-42", `{"n": 1}`)
+	if first.Code != http.StatusOK || calls != 1 {
+		t.Fatalf("first request: status %d, %d calls", first.Code, calls)
+	}
+	retry := post("payroll-42", `{"n": 1}`)
+	if retry.Code != http.StatusOK || calls != 1 {
+		t.Fatalf("retry: status %d, %d calls", retry.Code, calls)
+	}
+	if retry.Body.String() != "certificate" || retry.Header().Get("Content-Type") != "application/pdf" {
+		t.Fatalf("retry got %q (%s)", retry.Body, retry.Header().Get("Content-Type"))
+	}
+	if retry.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatal("replay without Idempotent-Replayed")
+	}
+	if retry.Header().Get("X-Request-ID") == first.Header().Get("X-Request-ID") {
+		t.Fatal("replay kept the first request's X-Request-ID")
+	}
+
+	if rec := post("payroll-42", `{"n": 2}`); rec.Code != http.StatusConflict {
+		t.Fatalf("different body: status %d, want 409", rec.Code)
+	}
+	if rec := post("", `{"n": 1}`); rec.Code != http.StatusOK || calls != 2 {
+		t.Fatalf("no key: status %d, %d calls", rec.Code, calls)
+	}
+	if rec := post("bad\nkey", `{"n": 1}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("unprintable key: status %d, want 400", rec.Code)
+	}
+
+	// A failure is not kept.
+	status = http.StatusInternalServerError
+	post("failing", `{}`)
+	status = http.StatusOK
+	if rec := post("failing", `{}`); rec.Code != http.StatusOK || rec.Header().Get("Idempotent-Replayed") != "" {
+		t.Fatalf("retry after a failure: status %d, replayed %q", rec.Code, rec.Header().Get("Idempotent-Replayed"))
+	}
+
+	// A panic releases the key: nothing recovers in this server, and the
+	// key must not answer 409 until it expires.
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("expected the handler to panic")
+			}
+		}()
+		req := httptest.NewRequest(http.MethodPost, "/panic", strings.NewReader(`{}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Idempotency-Key", "panicking")
+		e.ServeHTTP(httptest.NewRecorder(), req)
+	}()
+	panics = false
+	req := httptest.NewRequest(http.MethodPost, "/panic", strings.NewReader(`{}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", "panicking")
+	retried := httptest.NewRecorder()
+	e.ServeHTTP(retried, req)
+	if retried.Code != http.StatusOK {
+		t.Fatalf("retry after a panic: status %d: %s", retried.Code, retried.Body)
+	}
+
+	// A request still running holds its key.
+	running := httptest.NewRequest(http.MethodPost, "/issue", nil)
+	running.Header.Set("Content-Type", "application/json")
+	idempotency.store.Begin("running", requestFingerprint(running, []byte(`{}`)), time.Now().Add(time.Hour))
+	rec := post("running", `{}`)
+	if rec.Code != http.StatusConflict || rec.Header().Get("Retry-After") != "1" {
+		t.Fatalf("in progress: status %d, Retry-After %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+}
+
+func TestRequestFingerprintMultipart(t *testing.T) {
+	form := func() (*http.Request, []byte) {
+		var buf bytes.Buffer
+		w := multipart.NewWriter(&buf)
+		w.WriteField("taxInfo", `{"payer": {}}`)
+		w.Close()
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/taxes/multipart", nil)
+		req.Header.Set("Content-Type", w.FormDataContentType())
+		return req, buf.Bytes()
+	}
+	a, b := requestFingerprint(form()), requestFingerprint(form())
+	if a != b {
+		t.Fatal("the same form with another boundary has another fingerprint")
+	}
+}
+
+// cancellingRecorder cancels its request at the first flush, as a client
+// hanging up during a download.
+type cancellingRecorder struct {
+	*httptest.ResponseRecorder
+	cancel context.CancelFunc
+}
+
+func (r cancellingRecorder) Flush() {
+	r.ResponseRecorder.Flush()
+	r.cancel()
+}
+
+func TestIdempotentBatchCutOff(t *testing.T) {
+	idempotency = &idempotencyCache{store: newMemoryIdempotencyStore(), ttl: time.Hour, maxResponse: 1 << 20}
+	t.Cleanup(func() { idempotency = nil })
+	e := newServer()
+
+	item := `{"documentDetails": {"bookNumber": "001", "documentNumber": "0042"},
+		"payer": {"taxId": "1234567890123", "name": "บริษัท ตัวอย่าง จำกัด"},
+		"payee": {"taxId": "3101234567890", "name": "นาย ก", "pnd_3": true},
+		"income40_2": {"datePaid": "31 มกราคม 2568", "amountPaid": "10,000.00", "taxWithheld": "300.00"},
+		"withholdingType": {"withholdingTax": true},
+		"certification": {"dateOfIssuance": {"day": "31", "month": "มกราคม", "year": "2568"}}}`
+	post := func(ctx context.Context, w http.ResponseWriter) {
+		req := httptest.NewRequestWithContext(ctx, http.MethodPost, "/api/v1/taxes/batch", strings.NewReader(`[`+item+`, `+item+`, `+item+`]`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Idempotency-Key", "payroll-zip")
+		e.ServeHTTP(w, req)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cut := cancellingRecorder{httptest.NewRecorder(), cancel}
+	post(ctx, cut)
+	if _, err := zip.NewReader(bytes.NewReader(cut.Body.Bytes()), int64(cut.Body.Len())); err == nil {
+		t.Fatal("the cut-off batch is a complete archive")
+	}
+
+	retry := httptest.NewRecorder()
+	post(context.Background(), retry)
+	if retry.Code != http.StatusOK || retry.Header().Get("Idempotent-Replayed") != "" {
+		t.Fatalf("retry: status %d, replayed %q", retry.Code, retry.Header().Get("Idempotent-Replayed"))
+	}
+	zr, err := zip.NewReader(bytes.NewReader(retry.Body.Bytes()), int64(retry.Body.Len()))
+	if err != nil || len(zr.File) != 4 {
+		t.Fatalf("retried archive: %v", err)
+	}
+}
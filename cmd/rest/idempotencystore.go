@@ -0,0 +1,199 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// idempotencyRecord is what is kept for an Idempotency-Key: the fingerprint
+// of the request that first used it and, once that request has succeeded,
+// its response.
+type idempotencyRecord struct {
+	Fingerprint string
+	Response    *storedResponse // nil while the first request is in progress
+	ExpiresAt   time.Time
+}
+
+type storedResponse struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"-"`
+}
+
+// idempotencyStore keeps idempotency records by key. It must be safe for
+// concurrent use.
+type idempotencyStore interface {
+	// Begin reserves key for a request with fingerprint and returns nil, or,
+	// if the key is already in use and has not expired, returns its record.
+	Begin(key, fingerprint string, expiresAt time.Time) (*idempotencyRecord, error)
+	// Complete stores the response to the request that reserved key.
+	Complete(key string, res storedResponse) error
+	// Release forgets the reservation of a request that did not succeed, so
+	// that the key can be used again.
+	Release(key string) error
+	// DeleteExpired removes the records that expired before t and reports
+	// how many there were.
+	DeleteExpired(t time.Time) (int, error)
+}
+
+// memoryIdempotencyStore keeps records in memory; they are lost on restart.
+type memoryIdempotencyStore struct {
+	mu      sync.Mutex
+	records map[string]*idempotencyRecord
+}
+
+func newMemoryIdempotencyStore() *memoryIdempotencyStore {
+	return &memoryIdempotencyStore{records: map[string]*idempotencyRecord{}}
+}
+
+func (s *memoryIdempotencyStore) Begin(key, fingerprint string, expiresAt time.Time) (*idempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if rec, ok := s.records[key]; ok && time.Now().Before(rec.ExpiresAt) {
+		copy := *rec
+		return &copy, nil
+	}
+	s.records[key] = &idempotencyRecord{Fingerprint: fingerprint, ExpiresAt: expiresAt}
+	return nil, nil
+}
+
+func (s *memoryIdempotencyStore) Complete(key string, res storedResponse) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.records[key]
+	if !ok {
+		return fmt.Errorf("idempotency key %q is not reserved", key)
+	}
+	rec.Response = &res
+	return nil
+}
+
+func (s *memoryIdempotencyStore) Release(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, key)
+	return nil
+}
+
+func (s *memoryIdempotencyStore) DeleteExpired(t time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for key, rec := range s.records {
+		if rec.ExpiresAt.Before(t) {
+			delete(s.records, key)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// sqliteIdempotencyStore keeps records in a SQLite database, so responses
+// are still replayed after a restart.
+type sqliteIdempotencyStore struct {
+	db *sql.DB
+}
+
+// openSQLiteIdempotencyStore opens, creating if needed, the database at
+// path. Reservations of requests that were in progress when the server
+// stopped are dropped, so their keys can be retried.
+func openSQLiteIdempotencyStore(path string) (*sqliteIdempotencyStore, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// One connection, as for the job store: Begin's check and reservation
+	// must not interleave.
+	db.SetMaxOpenConns(1)
+	s := &sqliteIdempotencyStore{db: db}
+	if err := s.init(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("idempotency store %s: %w", path, err)
+	}
+	return s, nil
+}
+
+func (s *sqliteIdempotencyStore) init() error {
+	_, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS idempotency_keys (
+		key         TEXT PRIMARY KEY,
+		fingerprint TEXT NOT NULL,
+		response    TEXT,
+		body        BLOB,
+		expires_at  INTEGER NOT NULL
+	)`)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`DELETE FROM idempotency_keys WHERE response IS NULL`)
+	return err
+}
+
+func (s *sqliteIdempotencyStore) Begin(key, fingerprint string, expiresAt time.Time) (*idempotencyRecord, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var rec idempotencyRecord
+	var response sql.NullString
+	var body []byte
+	var expires int64
+	err = tx.QueryRow(`SELECT fingerprint, response, body, expires_at FROM idempotency_keys WHERE key = ? AND expires_at > ?`,
+		key, time.Now().UnixNano()).Scan(&rec.Fingerprint, &response, &body, &expires)
+	switch {
+	case err == nil:
+		rec.ExpiresAt = time.Unix(0, expires)
+		if response.Valid {
+			rec.Response = &storedResponse{}
+			if err := json.Unmarshal([]byte(response.String), rec.Response); err != nil {
+				return nil, err
+			}
+			rec.Response.Body = body
+		}
+		return &rec, nil
+	case !errors.Is(err, sql.ErrNoRows):
+		return nil, err
+	}
+	_, err = tx.Exec(`INSERT INTO idempotency_keys (key, fingerprint, expires_at) VALUES (?, ?, ?)
+		ON CONFLICT(key) DO UPDATE SET fingerprint = excluded.fingerprint, response = NULL, body = NULL, expires_at = excluded.expires_at`,
+		key, fingerprint, expiresAt.UnixNano())
+	if err != nil {
+		return nil, err
+	}
+	return nil, tx.Commit()
+}
+
+func (s *sqliteIdempotencyStore) Complete(key string, res storedResponse) error {
+	data, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+	r, err := s.db.Exec(`UPDATE idempotency_keys SET response = ?, body = ? WHERE key = ?`, string(data), res.Body, key)
+	if err != nil {
+		return err
+	}
+	if n, _ := r.RowsAffected(); n == 0 {
+		return fmt.Errorf("idempotency key %q is not reserved", key)
+	}
+	return nil
+}
+
+func (s *sqliteIdempotencyStore) Release(key string) error {
+	_, err := s.db.Exec(`DELETE FROM idempotency_keys WHERE key = ?`, key)
+	return err
+}
+
+func (s *sqliteIdempotencyStore) DeleteExpired(t time.Time) (int, error) {
+	res, err := s.db.Exec(`DELETE FROM idempotency_keys WHERE expires_at < ?`, t.UnixNano())
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
@@ -0,0 +1,457 @@
+package main
+
+// ── Jobs: batches too large for one HTTP request ────────────────────────────
+//
+// POST   /api/v1/jobs             submit a batch (same body as /api/v1/taxes/batch); 202 with the job
+// POST   /api/v1/jobs?format=pdf  one merged PDF instead of the ZIP
+// GET    /api/v1/jobs/:id         status and progress; the manifest once finished
+// GET    /api/v1/jobs/:id/result  download the ZIP or PDF of a succeeded job
+// DELETE /api/v1/jobs/:id         cancel a queued or running job, or delete a finished one
+//
+// Jobs run on a pool of workers inside the server. Finished jobs and their
+// results are kept for JOB_RETENTION, then removed.
+//
+// curl -X POST http://localhost:8080/api/v1/jobs \
+//   -F 'items=@payroll.ndjson' \
+//   -F 'signature=@signature.png' \
+//   -F 'seal=@seal.png'
+// curl http://localhost:8080/api/v1/jobs/<id>
+// curl http://localhost:8080/api/v1/jobs/<id>/result -o certificates.zip
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// maxJobItems bounds one job.
+const maxJobItems = 50000
+
+type jobStatus string
+
+const (
+	jobQueued    jobStatus = "queued"
+	jobRunning   jobStatus = "running"
+	jobSucceeded jobStatus = "succeeded"
+	jobFailed    jobStatus = "failed"
+	jobCanceled  jobStatus = "canceled"
+)
+
+// job is the status of a submitted batch, as returned by GET /api/v1/jobs/:id.
+type job struct {
+	ID         string         `json:"id"`
+	Status     jobStatus      `json:"status"`
+	Format     string         `json:"format"` // zip or pdf
+	Total      int            `json:"total"`  // number of items
+	Done       int            `json:"done"`   // items processed so far
+	Issued     int            `json:"issued"`
+	Failed     int            `json:"failed"`
+	Error      string         `json:"error,omitempty"`
+	Owner      string         `json:"owner,omitempty"`    // the caller that submitted it, when auth is on
+	OwnerID    string         `json:"ownerId,omitempty"`  // and its credential, the only one that may see the job
+	Manifest   *batchManifest `json:"manifest,omitempty"` // once finished
+	CreatedAt  time.Time      `json:"createdAt"`
+	StartedAt  *time.Time     `json:"startedAt,omitempty"`
+	FinishedAt *time.Time     `json:"finishedAt,omitempty"`
+}
+
+// jobTask is a queued job with its parsed request and shared images.
+type jobTask struct {
+	id         string
+	req        *batchRequest
+	sign, seal []byte
+}
+
+var (
+	errQueueFull    = errors.New("job queue is full")
+	errShuttingDown = errors.New("server is shutting down")
+)
+
+// jobManager runs jobs on a pool of workers and removes them once their
+// retention has passed.
+type jobManager struct {
+	store     jobStore
+	queue     chan jobTask
+	retention time.Duration
+
+	// mu serialises status changes, so that a cancellation cannot race a
+	// worker picking the job up.
+	mu      sync.Mutex
+	cancels map[string]context.CancelCauseFunc // of running jobs
+	closing bool                               // set by shutdown
+	running sync.WaitGroup
+}
+
+// newJobManager starts workers workers, taking jobs from a queue of
+// queueSize, and a janitor removing jobs retention after they finished.
+func newJobManager(store jobStore, workers, queueSize int, retention time.Duration) *jobManager {
+	m := &jobManager{
+		store:     store,
+		queue:     make(chan jobTask, queueSize),
+		retention: retention,
+		cancels:   map[string]context.CancelCauseFunc{},
+	}
+	for range workers {
+		go m.work()
+	}
+	go m.janitor()
+	return m
+}
+
+// jobManagerFromEnv configures the job manager from JOB_WORKERS (default 2),
+// JOB_QUEUE (default 100), JOB_RETENTION (default 24h) and JOB_STORE
+// ("memory", the default, or "sqlite:<path>").
+func jobManagerFromEnv() (*jobManager, error) {
+	workers, err := envInt("JOB_WORKERS", 2)
+	if err != nil {
+		return nil, err
+	}
+	queueSize, err := envInt("JOB_QUEUE", 100)
+	if err != nil {
+		return nil, err
+	}
+	retention := 24 * time.Hour
+	if v := os.Getenv("JOB_RETENTION"); v != "" {
+		if retention, err = time.ParseDuration(v); err != nil || retention <= 0 {
+			return nil, fmt.Errorf("JOB_RETENTION: must be a positive duration, got %q", v)
+		}
+	}
+	var store jobStore
+	switch v := os.Getenv("JOB_STORE"); {
+	case v == "" || v == "memory":
+		store = newMemoryJobStore()
+	case strings.HasPrefix(v, "sqlite:"):
+		if store, err = openSQLiteJobStore(strings.TrimPrefix(v, "sqlite:")); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("JOB_STORE: must be memory or sqlite:<path>, got %q", v)
+	}
+	return newJobManager(store, workers, queueSize, retention), nil
+}
+
+func envInt(name string, def int) (int, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("%s: must be a positive integer, got %q", name, v)
+	}
+	return n, nil
+}
+
+// submit queues req and returns the new job.
+func (m *jobManager) submit(owner *principal, format string, req *batchRequest, sign, seal []byte) (job, error) {
+	j := job{
+		ID:        newJobID(),
+		Status:    jobQueued,
+		Format:    format,
+		Total:     len(req.items),
+		CreatedAt: time.Now().UTC(),
+	}
+	if owner != nil {
+		j.Owner, j.OwnerID = owner.Name, owner.ID
+	}
+	m.mu.Lock()
+	closing := m.closing
+	m.mu.Unlock()
+	if closing {
+		return job{}, errShuttingDown
+	}
+	if err := m.store.Save(j); err != nil {
+		return job{}, err
+	}
+	select {
+	case m.queue <- jobTask{id: j.ID, req: req, sign: sign, seal: seal}:
+		return j, nil
+	default:
+		m.store.Delete(j.ID)
+		return job{}, errQueueFull
+	}
+}
+
+// cancel stops a queued or running job; a finished job is deleted, which
+// deleted reports.
+func (m *jobManager) cancel(id string) (j job, deleted bool, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if j, err = m.store.Get(id); err != nil {
+		return job{}, false, err
+	}
+	switch j.Status {
+	case jobQueued:
+		// The worker skips it when it comes out of the queue.
+		now := time.Now().UTC()
+		j.Status, j.FinishedAt = jobCanceled, &now
+		return j, false, m.store.Save(j)
+	case jobRunning:
+		// The worker records the cancellation once issueBatch returns.
+		if cancel := m.cancels[id]; cancel != nil {
+			cancel(nil)
+		}
+		return j, false, nil
+	}
+	return j, true, m.store.Delete(id)
+}
+
+func (m *jobManager) work() {
+	for t := range m.queue {
+		m.run(t)
+	}
+}
+
+func (m *jobManager) run(t jobTask) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	j, ok := m.start(t.id, cancel)
+	if !ok {
+		return
+	}
+	defer m.running.Done()
+	defer func() {
+		m.mu.Lock()
+		delete(m.cancels, t.id)
+		m.mu.Unlock()
+	}()
+
+	progress := func(manifest batchManifest) {
+		j.Done, j.Issued, j.Failed = len(manifest.Results), manifest.Issued, manifest.Failed
+		if err := m.store.Save(j); err != nil {
+			slog.Error("save job progress", "job", j.ID, "err", err)
+		}
+	}
+	// The archive is written to a temporary file: a batch of maxJobItems
+	// certificates is too large to build in memory.
+	var manifest batchManifest
+	out, err := os.CreateTemp("", "pdf50tawi-job-*")
+	if err == nil {
+		defer os.Remove(out.Name())
+		defer out.Close()
+		// Each certificate waits for a generation slot of its own (see
+		// issueBatch), so a long job does not keep one from requests.
+		w := bufio.NewWriter(out)
+		if j.Format == "pdf" {
+			manifest, err = writeBatchPDF(ctx, w, t.req, t.sign, t.seal, progress)
+		} else {
+			manifest, err = writeBatchZip(ctx, w, t.req, t.sign, t.seal, nil, progress)
+		}
+		err = cmp.Or(err, w.Flush())
+	}
+
+	j.Done, j.Issued, j.Failed = len(manifest.Results), manifest.Issued, manifest.Failed
+	j.Manifest = &manifest
+	switch {
+	case ctx.Err() != nil:
+		j.Status = jobCanceled
+		if cause := context.Cause(ctx); errors.Is(cause, errShuttingDown) {
+			j.Error = cause.Error()
+		}
+	case err != nil:
+		j.Status, j.Error = jobFailed, err.Error()
+	case j.Format == "pdf" && manifest.Failed > 0:
+		j.Status, j.Error = jobFailed, fmt.Sprintf("%d of %d items failed; see the manifest", manifest.Failed, j.Total)
+	default:
+		_, err := out.Seek(0, io.SeekStart)
+		if err == nil {
+			err = m.store.SetResult(j.ID, out)
+		}
+		if err != nil {
+			j.Status, j.Error = jobFailed, "store result: "+err.Error()
+		} else {
+			j.Status = jobSucceeded
+		}
+	}
+	now := time.Now().UTC()
+	j.FinishedAt = &now
+	if err := m.store.Save(j); err != nil {
+		slog.Error("save job", "job", j.ID, "err", err)
+	}
+}
+
+// start marks the job running, unless it was canceled or deleted while it
+// was queued or the server is shutting down.
+func (m *jobManager) start(id string, cancel context.CancelCauseFunc) (job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closing {
+		return job{}, false
+	}
+	j, err := m.store.Get(id)
+	if err != nil || j.Status != jobQueued {
+		return job{}, false
+	}
+	now := time.Now().UTC()
+	j.Status, j.StartedAt = jobRunning, &now
+	if err := m.store.Save(j); err != nil {
+		slog.Error("save job", "job", id, "err", err)
+		return job{}, false
+	}
+	m.cancels[id] = cancel
+	m.running.Add(1)
+	return j, true
+}
+
+// shutdown stops starting jobs and waits for the running ones to finish;
+// those still running when ctx is done are canceled. Queued jobs stay
+// queued: a SQLite store marks them failed when the server starts again.
+func (m *jobManager) shutdown(ctx context.Context) error {
+	m.mu.Lock()
+	m.closing = true
+	m.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		m.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+	m.mu.Lock()
+	for _, cancel := range m.cancels {
+		cancel(errShuttingDown)
+	}
+	m.mu.Unlock()
+	<-done
+	return ctx.Err()
+}
+
+// janitor removes finished jobs once their retention has passed.
+func (m *jobManager) janitor() {
+	interval := min(m.retention, time.Minute)
+	for range time.Tick(interval) {
+		if _, err := m.store.DeleteFinishedBefore(time.Now().Add(-m.retention)); err != nil {
+			slog.Error("remove expired jobs", "err", err)
+		}
+	}
+}
+
+func newJobID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// jobs is the job manager of the server.
+var jobs *jobManager
+
+func handleSubmitJob(c echo.Context) error {
+	format := c.QueryParam("format")
+	if format == "" {
+		format = "zip"
+	}
+	if format != "zip" && format != "pdf" {
+		return c.JSON(http.StatusBadRequest, errResp("format must be zip or pdf"))
+	}
+	req, err := parseBatchRequest(c, maxJobItems)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	if err := authorizePayers(c, req.items...); err != nil {
+		return errorJSON(c, err)
+	}
+	if err := authorizeImageSources(c, req.sign, req.seal); err != nil {
+		return errorJSON(c, err)
+	}
+	// Shared images are loaded now, so a bad URL or upload is reported to
+	// the client instead of failing the job later.
+	sign, seal, err := req.sharedImages(c.Request().Context())
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	req.issuer = callerName(c)
+	j, err := jobs.submit(caller(c), format, req, sign, seal)
+	if errors.Is(err, errQueueFull) || errors.Is(err, errShuttingDown) {
+		return c.JSON(http.StatusServiceUnavailable, errResp(err.Error()))
+	}
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	c.Response().Header().Set(echo.HeaderLocation, "/api/v1/jobs/"+j.ID)
+	return c.JSON(http.StatusAccepted, j)
+}
+
+// callerJob returns the job named in the path if the caller submitted it
+// with the same credential; other callers' jobs are reported as not found.
+func callerJob(c echo.Context) (job, error) {
+	j, err := jobs.store.Get(c.Param("id"))
+	if err != nil {
+		return job{}, err
+	}
+	if p := caller(c); p != nil && p.ID != j.OwnerID {
+		return job{}, errJobNotFound
+	}
+	return j, nil
+}
+
+func handleGetJob(c echo.Context) error {
+	j, err := callerJob(c)
+	if err != nil {
+		return jobError(c, err)
+	}
+	return c.JSON(http.StatusOK, j)
+}
+
+func handleJobResult(c echo.Context) error {
+	j, err := callerJob(c)
+	if err != nil {
+		return jobError(c, err)
+	}
+	if j.Status != jobSucceeded {
+		return c.JSON(http.StatusConflict, errResp(fmt.Sprintf("job is %s; a result is available once it has succeeded", j.Status)))
+	}
+	result, err := jobs.store.Result(j.ID)
+	if err != nil {
+		return jobError(c, err)
+	}
+	defer result.Close()
+	contentType, name := "application/zip", "certificates.zip"
+	if j.Format == "pdf" {
+		contentType, name = "application/pdf", "certificates.pdf"
+	}
+	c.Response().Header().Set("Content-Disposition", "attachment; filename="+name)
+	return c.Stream(http.StatusOK, contentType, result)
+}
+
+func handleCancelJob(c echo.Context) error {
+	if _, err := callerJob(c); err != nil {
+		return jobError(c, err)
+	}
+	j, deleted, err := jobs.cancel(c.Param("id"))
+	if err != nil {
+		return jobError(c, err)
+	}
+	switch {
+	case deleted:
+		return c.NoContent(http.StatusNoContent)
+	case j.Status == jobRunning:
+		// Canceled once the worker notices; poll the job to see it.
+		return c.JSON(http.StatusAccepted, j)
+	}
+	return c.JSON(http.StatusOK, j)
+}
+
+func jobError(c echo.Context, err error) error {
+	if errors.Is(err, errJobNotFound) {
+		return c.JSON(http.StatusNotFound, errResp(err.Error()))
+	}
+	return errorJSON(c, err)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJobStores(t *testing.T) {
+	sqlite, err := openSQLiteJobStore(filepath.Join(t.TempDir(), "jobs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stores := map[string]jobStore{"Memory": newMemoryJobStore(), "SQLite": sqlite}
+	for name, s := range stores {
+		t.Run(name, func(t *testing.T) {
+			finished := testNow
+			for _, j := range []job{
+				{ID: "j1", Status: jobSucceeded, FinishedAt: &finished},
+				{ID: "j2", Status: jobRunning},
+			} {
+				if err := s.Save(j); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := s.SetResult("j1", strings.NewReader("PK result")); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.SetResult("ffff", strings.NewReader("x")); err != errJobNotFound {
+				t.Fatalf("SetResult of an unknown job: %v", err)
+			}
+			result, err := s.Result("j1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := io.ReadAll(result)
+			result.Close()
+			if err != nil || string(data) != "PK result" {
+				t.Fatalf("Result: %q, %v", data, err)
+			}
+			if _, err := s.Result("j2"); err != errJobNotFound {
+				t.Fatalf("Result of an unfinished job: %v", err)
+			}
+
+			var file string
+			if m, ok := s.(*memoryJobStore); ok {
+				file = m.results["j1"]
+				if _, err := os.Stat(file); err != nil {
+					t.Fatalf("result is not in a file: %v", err)
+				}
+			}
+			if n, err := s.DeleteFinishedBefore(testNow.Add(time.Second)); err != nil || n != 1 {
+				t.Fatalf("DeleteFinishedBefore: %d, %v", n, err)
+			}
+			if _, err := s.Get("j1"); err != errJobNotFound {
+				t.Fatalf("expired job: %v", err)
+			}
+			if _, err := s.Result("j1"); err != errJobNotFound {
+				t.Fatalf("expired result: %v", err)
+			}
+			if file != "" {
+				if _, err := os.Stat(file); !os.IsNotExist(err) {
+					t.Fatalf("result file of an expired job: %v", err)
+				}
+			}
+			if _, err := s.Get("j2"); err != nil {
+				t.Fatalf("running job: %v", err)
+			}
+		})
+	}
+}
+
+func TestJobRoutes(t *testing.T) {
+	jobs = newJobManager(newMemoryJobStore(), 1, 10, time.Hour)
+	// Two keys of the same name: a job belongs to the key, not the name.
+	a, err := newAuthenticator(authConfig{APIKeys: []apiKeyConfig{
+		{Name: "payroll", Key: "payroll-key", Payers: []string{"1234567890123"}},
+		{Name: "payroll", Key: "payroll-key-2", Payers: []string{"1234567890123"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth = a
+	t.Cleanup(func() { jobs, auth = nil, nil })
+	e := newServer()
+
+	do := func(method, target, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", key)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	taxInfo := `{"documentDetails": {"bookNumber": "001", "documentNumber": "0042"},
+		"payer": {"taxId": "1234567890123", "name": "บริษัท ตัวอย่าง จำกัด"},
+		"payee": {"taxId": "3101234567890", "name": "นาย ก", "pnd_3": true},
+		"income40_2": {"datePaid": "31 มกราคม 2568", "amountPaid": "10,000.00", "taxWithheld": "300.00"},
+		"withholdingType": {"withholdingTax": true},
+		"certification": {"dateOfIssuance": {"day": "31", "month": "มกราคม", "year": "2568"}}}`
+	submitted := do(http.MethodPost, "/api/v1/jobs", "payroll-key", `[`+taxInfo+`, `+taxInfo+`]`)
+	var j job
+	if err := json.Unmarshal(submitted.Body.Bytes(), &j); err != nil || submitted.Code != http.StatusAccepted {
+		t.Fatalf("submit: status %d, %v: %s", submitted.Code, err, submitted.Body)
+	}
+	if j.Owner != "payroll" || j.OwnerID == "" {
+		t.Fatalf("owner %q, %q", j.Owner, j.OwnerID)
+	}
+
+	for deadline := time.Now().Add(10 * time.Second); j.Status == jobQueued || j.Status == jobRunning; time.Sleep(20 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("job still %s", j.Status)
+		}
+		rec := do(http.MethodGet, "/api/v1/jobs/"+j.ID, "payroll-key", "")
+		if err := json.Unmarshal(rec.Body.Bytes(), &j); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if j.Status != jobSucceeded || j.Issued != 2 {
+		t.Fatalf("job %s, issued %d: %s", j.Status, j.Issued, j.Error)
+	}
+
+	result := do(http.MethodGet, "/api/v1/jobs/"+j.ID+"/result", "payroll-key", "")
+	if result.Code != http.StatusOK || !strings.HasPrefix(result.Body.String(), "PK") {
+		t.Fatalf("result: status %d, %d bytes", result.Code, result.Body.Len())
+	}
+	for _, target := range []string{"/api/v1/jobs/" + j.ID, "/api/v1/jobs/" + j.ID + "/result"} {
+		if rec := do(http.MethodGet, target, "payroll-key-2", ""); rec.Code != http.StatusNotFound {
+			t.Fatalf("%s with the other key: status %d", target, rec.Code)
+		}
+	}
+	if rec := do(http.MethodDelete, "/api/v1/jobs/"+j.ID, "payroll-key-2", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("delete with the other key: status %d", rec.Code)
+	}
+	if rec := do(http.MethodDelete, "/api/v1/jobs/"+j.ID, "payroll-key", ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete: status %d", rec.Code)
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// errJobNotFound is returned by a jobStore for an unknown or expired job.
+var errJobNotFound = errors.New("job not found")
+
+// jobStore keeps jobs and their results. The manager serialises the status
+// changes of a job, so a store only has to be safe for concurrent use.
+type jobStore interface {
+	// Save creates or replaces j.
+	Save(j job) error
+	Get(id string) (job, error)
+	// SetResult stores the finished archive of a job, read from r.
+	SetResult(id string, r io.Reader) error
+	// Result opens the archive stored by SetResult.
+	Result(id string) (io.ReadCloser, error)
+	Delete(id string) error
+	// DeleteFinishedBefore removes the jobs finished before t, with their
+	// results, and reports how many there were.
+	DeleteFinishedBefore(t time.Time) (int, error)
+}
+
+// memoryJobStore keeps jobs in memory and their results in temporary
+// files, so a finished batch does not hold its archive in memory until it
+// expires. Both are lost on restart.
+type memoryJobStore struct {
+	mu      sync.Mutex
+	jobs    map[string]job
+	results map[string]string // paths of the result files
+}
+
+func newMemoryJobStore() *memoryJobStore {
+	return &memoryJobStore{jobs: map[string]job{}, results: map[string]string{}}
+}
+
+func (s *memoryJobStore) Save(j job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[j.ID] = j
+	return nil
+}
+
+func (s *memoryJobStore) Get(id string) (job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[id]
+	if !ok {
+		return job{}, errJobNotFound
+	}
+	return j, nil
+}
+
+func (s *memoryJobStore) SetResult(id string, r io.Reader) error {
+	if _, err := s.Get(id); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp("", "pdf50tawi-job-*")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.jobs[id]; !ok { // deleted meanwhile
+		os.Remove(f.Name())
+		return errJobNotFound
+	}
+	if old, ok := s.results[id]; ok {
+		os.Remove(old)
+	}
+	s.results[id] = f.Name()
+	return nil
+}
+
+func (s *memoryJobStore) Result(id string) (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	path, ok := s.results[id]
+	if !ok {
+		return nil, errJobNotFound
+	}
+	// An open file can still be read on Unix once the janitor removes it.
+	return os.Open(path)
+}
+
+func (s *memoryJobStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.delete(id)
+	return nil
+}
+
+func (s *memoryJobStore) DeleteFinishedBefore(t time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for id, j := range s.jobs {
+		if j.FinishedAt != nil && j.FinishedAt.Before(t) {
+			s.delete(id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// delete removes the job id and its result file; s.mu must be held.
+func (s *memoryJobStore) delete(id string) {
+	if path, ok := s.results[id]; ok {
+		os.Remove(path)
+	}
+	delete(s.jobs, id)
+	delete(s.results, id)
+}
+
+// sqliteJobStore keeps jobs in a SQLite database, so finished jobs and
+// their results survive a restart. The job itself is stored as JSON.
+type sqliteJobStore struct {
+	db *sql.DB
+}
+
+// openSQLiteJobStore opens, creating if needed, the database at path. Jobs
+// that were queued or running when the server stopped cannot be resumed,
+// since the request is not stored; they are marked failed.
+func openSQLiteJobStore(path string) (*sqliteJobStore, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// One connection: SQLite allows a single writer, and the workers'
+	// progress updates would otherwise fail with SQLITE_BUSY.
+	db.SetMaxOpenConns(1)
+	s := &sqliteJobStore{db: db}
+	if err := s.init(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("job store %s: %w", path, err)
+	}
+	return s, nil
+}
+
+func (s *sqliteJobStore) init() error {
+	_, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS jobs (
+		id          TEXT PRIMARY KEY,
+		data        TEXT NOT NULL,
+		finished_at INTEGER,
+		result      BLOB
+	)`)
+	if err != nil {
+		return err
+	}
+	rows, err := s.db.Query(`SELECT data FROM jobs WHERE finished_at IS NULL`)
+	if err != nil {
+		return err
+	}
+	var interrupted []job
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			rows.Close()
+			return err
+		}
+		var j job
+		if err := json.Unmarshal([]byte(data), &j); err != nil {
+			rows.Close()
+			return err
+		}
+		interrupted = append(interrupted, j)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	for _, j := range interrupted {
+		j.Status, j.Error, j.FinishedAt = jobFailed, "interrupted by a server restart", &now
+		if err := s.Save(j); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sqliteJobStore) Save(j job) error {
+	data, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+	var finishedAt sql.NullInt64
+	if j.FinishedAt != nil {
+		finishedAt = sql.NullInt64{Int64: j.FinishedAt.UnixNano(), Valid: true}
+	}
+	_, err = s.db.Exec(`INSERT INTO jobs (id, data, finished_at) VALUES (?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET data = excluded.data, finished_at = excluded.finished_at`,
+		j.ID, string(data), finishedAt)
+	return err
+}
+
+func (s *sqliteJobStore) Get(id string) (job, error) {
+	var data string
+	err := s.db.QueryRow(`SELECT data FROM jobs WHERE id = ?`, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return job{}, errJobNotFound
+	}
+	if err != nil {
+		return job{}, err
+	}
+	var j job
+	return j, json.Unmarshal([]byte(data), &j)
+}
+
+func (s *sqliteJobStore) SetResult(id string, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	res, err := s.db.Exec(`UPDATE jobs SET result = ? WHERE id = ?`, data, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errJobNotFound
+	}
+	return nil
+}
+
+func (s *sqliteJobStore) Result(id string) (io.ReadCloser, error) {
+	var data []byte
+	err := s.db.QueryRow(`SELECT result FROM jobs WHERE id = ? AND result IS NOT NULL`, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errJobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (s *sqliteJobStore) Delete(id string) error {
+	_, err := s.db.Exec(`DELETE FROM jobs WHERE id = ?`, id)
+	return err
+}
+
+func (s *sqliteJobStore) DeleteFinishedBefore(t time.Time) (int, error) {
+	res, err := s.db.Exec(`DELETE FROM jobs WHERE finished_at < ?`, t.UnixNano())
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
@@ -0,0 +1,239 @@
+package main
+
+// ── Rate and concurrency limits ──────────────────────────────────────────────
+//
+// Each caller (API key or JWT subject, or client IP while auth is off) has a
+// token bucket of RATE_LIMIT requests per second and RATE_BURST at once for
+// the /api/ routes; past it a request gets 429.
+//
+// Every generation buffers a whole PDF, so at most MAX_GENERATIONS run at a
+// time across requests and jobs. Up to GENERATION_QUEUE more requests wait,
+// each for at most GENERATION_WAIT, before getting 503. Both answers carry
+// Retry-After. Batches and jobs take a slot per certificate, only while it
+// is generated: not while its images load or the client reads.
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/time/rate"
+)
+
+var (
+	rejectedRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "pdf50tawi_rejected_requests_total",
+		Help: "Requests turned away by the rate limit (rate_limited) or a full generation queue (busy).",
+	}, []string{"reason"})
+	generationsRunning = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "pdf50tawi_generations_running",
+		Help: "Generations holding a slot, jobs included.",
+	})
+	generationsWaiting = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "pdf50tawi_generations_waiting",
+		Help: "Requests queued for a generation slot.",
+	})
+)
+
+// rateLimiter keeps a token bucket per caller. Buckets left idle for
+// rateIdle are dropped.
+type rateLimiter struct {
+	limit rate.Limit
+	burst int
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+const rateIdle = 10 * time.Minute
+
+// rateLimits limits the /api/ routes; nil when RATE_LIMIT is not set.
+var rateLimits *rateLimiter
+
+func newRateLimiter(perSecond float64, burst int) *rateLimiter {
+	return &rateLimiter{limit: rate.Limit(perSecond), burst: burst, buckets: map[string]*bucket{}}
+}
+
+// allow takes a token from key's bucket. When there is none it reports how
+// long until there will be.
+func (l *rateLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.lastSweep) > rateIdle {
+		for k, b := range l.buckets {
+			if now.Sub(b.lastSeen) > rateIdle {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+	b := l.buckets[key]
+	if b == nil {
+		b = &bucket{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.buckets[key] = b
+	}
+	b.lastSeen = now
+	r := b.limiter.ReserveN(now, 1)
+	if delay := r.DelayFrom(now); delay > 0 {
+		r.CancelAt(now)
+		return false, delay
+	}
+	return true, 0
+}
+
+// limitRate applies rateLimits to the /api/ routes. It runs after
+// requireAuth, so that an authenticated caller is limited by credential:
+// two API keys sharing a name have a limit each.
+func limitRate(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if rateLimits == nil || !strings.HasPrefix(c.Request().URL.Path, "/api/") {
+			return next(c)
+		}
+		key := "ip:" + c.RealIP()
+		if p := caller(c); p != nil {
+			key = "caller:" + p.ID
+		}
+		if ok, wait := rateLimits.allow(key, time.Now()); !ok {
+			rejectedRequests.WithLabelValues("rate_limited").Inc()
+			setRetryAfter(c, wait)
+			return c.JSON(http.StatusTooManyRequests, errResp("rate limit exceeded"))
+		}
+		return next(c)
+	}
+}
+
+// generationLimiter is a semaphore of generation slots with a bounded
+// queue of requests waiting for one.
+type generationLimiter struct {
+	slots    chan struct{}
+	maxQueue int64
+	wait     time.Duration
+	waiting  atomic.Int64
+}
+
+var errBusy = errors.New("too many certificates are being generated, try again later")
+
+// busyRetryAfter is what a request turned away for lack of a slot is told:
+// a few generations' time.
+const busyRetryAfter = 5 * time.Second
+
+// generations bounds concurrent generations; nil means no bound.
+var generations *generationLimiter
+
+func newGenerationLimiter(slots, maxQueue int, wait time.Duration) *generationLimiter {
+	return &generationLimiter{slots: make(chan struct{}, slots), maxQueue: int64(maxQueue), wait: wait}
+}
+
+// acquire takes a slot for a request: at once if one is free, otherwise
+// after queueing for at most the configured wait. It fails with errBusy
+// when the queue is full or the wait runs out.
+func (g *generationLimiter) acquire(ctx context.Context) (release func(), err error) {
+	select {
+	case g.slots <- struct{}{}:
+		generationsRunning.Inc()
+		return g.release, nil
+	default:
+	}
+	if g.waiting.Add(1) > g.maxQueue {
+		g.waiting.Add(-1)
+		return nil, errBusy
+	}
+	generationsWaiting.Inc()
+	defer func() {
+		g.waiting.Add(-1)
+		generationsWaiting.Dec()
+	}()
+	timer := time.NewTimer(g.wait)
+	defer timer.Stop()
+	select {
+	case g.slots <- struct{}{}:
+		generationsRunning.Inc()
+		return g.release, nil
+	case <-timer.C:
+		return nil, errBusy
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (g *generationLimiter) release() {
+	<-g.slots
+	generationsRunning.Dec()
+}
+
+// holdGeneration is the route middleware of the routes that generate: the
+// handler runs holding a slot of generations.
+func holdGeneration(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if generations == nil {
+			return next(c)
+		}
+		release, err := generations.acquire(c.Request().Context())
+		if err != nil {
+			return generationUnavailable(c, err)
+		}
+		defer release()
+		return next(c)
+	}
+}
+
+// generationUnavailable answers 503 to a request that got no slot.
+func generationUnavailable(c echo.Context, err error) error {
+	if errors.Is(err, errBusy) {
+		rejectedRequests.WithLabelValues("busy").Inc()
+		setRetryAfter(c, busyRetryAfter)
+	}
+	return c.JSON(http.StatusServiceUnavailable, errResp(err.Error()))
+}
+
+// batchGenerationSlots returns how a batch request takes a slot for each
+// certificate: the first queues as any request does, and may be turned
+// away with errBusy; once admitted, the batch waits its turn for the rest.
+func batchGenerationSlots() func(ctx context.Context) (release func(), err error) {
+	admitted := false
+	return func(ctx context.Context) (func(), error) {
+		if admitted || generations == nil {
+			return waitGeneration(ctx)
+		}
+		release, err := generations.acquire(ctx)
+		admitted = err == nil
+		return release, err
+	}
+}
+
+// waitGeneration takes a slot for one certificate of a job or an admitted
+// batch, waiting as long as it takes: the job queue already bounds how
+// many wait.
+func waitGeneration(ctx context.Context) (release func(), err error) {
+	if generations == nil {
+		return func() {}, nil
+	}
+	select {
+	case generations.slots <- struct{}{}:
+		generationsRunning.Inc()
+		return generations.release, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// setRetryAfter sets Retry-After to d in whole seconds, rounded up.
+func setRetryAfter(c echo.Context, d time.Duration) {
+	secs := int(math.Ceil(d.Seconds()))
+	c.Response().Header().Set("Retry-After", strconv.Itoa(max(secs, 1)))
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AnuchitO/pdf50tawi"
+)
+
+func TestRateLimiter(t *testing.T) {
+	l := newRateLimiter(2, 3)
+	now := testNow
+	for i := range 3 {
+		if ok, _ := l.allow("acme", now); !ok {
+			t.Fatalf("request %d within the burst was refused", i)
+		}
+	}
+	ok, wait := l.allow("acme", now)
+	if ok || wait <= 0 || wait > 500*time.Millisecond {
+		t.Fatalf("request over the burst: ok %v, wait %v", ok, wait)
+	}
+	if ok, _ := l.allow("other", now); !ok {
+		t.Fatal("another caller shares the bucket")
+	}
+	if ok, _ := l.allow("acme", now.Add(wait)); !ok {
+		t.Fatal("the bucket did not refill after the advertised wait")
+	}
+
+	// Idle buckets are dropped.
+	l.allow("fresh", now.Add(2*rateIdle))
+	if _, ok := l.buckets["acme"]; ok {
+		t.Fatal("idle bucket was kept")
+	}
+}
+
+func TestLimitRate(t *testing.T) {
+	rateLimits = newRateLimiter(0.001, 1)
+	t.Cleanup(func() { rateLimits = nil })
+	e := newServer()
+
+	post := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/taxes/validate", strings.NewReader(`{"taxInfo": {}}`))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := post(); rec.Code != http.StatusOK {
+		t.Fatalf("first request: status %d", rec.Code)
+	}
+	rec := post()
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("second request: status %d, want 429", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Fatal("429 without Retry-After")
+	}
+
+	// Only /api/ is limited.
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("/healthz: status %d", rec.Code)
+	}
+
+	// Two API keys with the same name have a limit each.
+	a, err := newAuthenticator(authConfig{APIKeys: []apiKeyConfig{
+		{Name: "payroll", Key: "key-1", Payers: []string{"*"}},
+		{Name: "payroll", Key: "key-2", Payers: []string{"*"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth = a
+	t.Cleanup(func() { auth = nil })
+	e = newServer()
+	for _, key := range []string{"key-1", "key-2"} {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/taxes/validate", strings.NewReader(`{"taxInfo": {}}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", key)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("first request with %s: status %d", key, rec.Code)
+		}
+	}
+}
+
+func TestGenerationLimiter(t *testing.T) {
+	g := newGenerationLimiter(1, 1, 20*time.Millisecond)
+	ctx := context.Background()
+	release, err := g.acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The only slot is taken: one request may wait, and times out.
+	if _, err := g.acquire(ctx); err != errBusy {
+		t.Fatalf("waiting past GENERATION_WAIT: %v, want errBusy", err)
+	}
+
+	// A waiting request gets the slot once it is released...
+	g.wait = time.Second
+	got := make(chan error, 1)
+	go func() {
+		r, err := g.acquire(ctx)
+		if err == nil {
+			r()
+		}
+		got <- err
+	}()
+	for g.waiting.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	// ...while a second one finds the queue full.
+	if _, err := g.acquire(ctx); err != errBusy {
+		t.Fatalf("queue full: %v, want errBusy", err)
+	}
+	release()
+	if err := <-got; err != nil {
+		t.Fatalf("queued request: %v", err)
+	}
+}
+
+func TestHoldGeneration(t *testing.T) {
+	generations = newGenerationLimiter(1, 1, time.Millisecond)
+	t.Cleanup(func() { generations = nil })
+	release, err := generations.acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/taxes", strings.NewReader(`{"taxInfo": {}}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	newServer().ServeHTTP(rec, req)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status %d, want 503", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "5" {
+		t.Fatalf("Retry-After %q, want 5", got)
+	}
+}
+
+// flushRecorder notes at each flush whether a generation slot is held.
+type flushRecorder struct {
+	*httptest.ResponseRecorder
+	held *[]int
+}
+
+func (r flushRecorder) Flush() {
+	*r.held = append(*r.held, len(generations.slots))
+	r.ResponseRecorder.Flush()
+}
+
+func TestBatchGenerationSlots(t *testing.T) {
+	generations = newGenerationLimiter(1, 0, time.Millisecond)
+	t.Cleanup(func() { generations = nil })
+	e := newServer()
+
+	item := `{"documentDetails": {"bookNumber": "001", "documentNumber": "0042"},
+		"payer": {"taxId": "1234567890123", "name": "บริษัท ตัวอย่าง จำกัด"},
+		"payee": {"taxId": "3101234567890", "name": "นาย ก", "pnd_3": true},
+		"income40_2": {"datePaid": "31 มกราคม 2568", "amountPaid": "10,000.00", "taxWithheld": "300.00"},
+		"withholdingType": {"withholdingTax": true},
+		"certification": {"dateOfIssuance": {"day": "31", "month": "มกราคม", "year": "2568"}}}`
+	post := func(w http.ResponseWriter) {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/taxes/batch", strings.NewReader(`[`+item+`, `+item+`]`))
+		req.Header.Set("Content-Type", "application/json")
+		e.ServeHTTP(w, req)
+	}
+
+	// Busy before the first certificate: 503, not a broken archive.
+	release, err := generations.acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	busy := httptest.NewRecorder()
+	post(busy)
+	release()
+	if busy.Code != http.StatusServiceUnavailable || busy.Header().Get("Retry-After") != "5" || busy.Header().Get("Content-Disposition") != "" {
+		t.Fatalf("busy batch: status %d, headers %v", busy.Code, busy.Header())
+	}
+
+	// The slot is released before each certificate is sent.
+	var held []int
+	rec := flushRecorder{httptest.NewRecorder(), &held}
+	post(rec)
+	if rec.Code != http.StatusOK || len(held) != 2 || held[0] != 0 || held[1] != 0 {
+		t.Fatalf("batch: status %d, slots held at each flush %v", rec.Code, held)
+	}
+
+	// So it is for a job, between certificates.
+	req := &batchRequest{items: make([]pdf50tawi.TaxInfo, 3)}
+	if err := json.Unmarshal([]byte(item), &req.items[0]); err != nil {
+		t.Fatal(err)
+	}
+	req.items[1], req.items[2] = req.items[0], req.items[0]
+	manifest, err := issueBatch(context.Background(), req, nil, nil, false,
+		func(*batchItemResult, pdf50tawi.TaxInfo, []byte) error {
+			if n := len(generations.slots); n != 0 {
+				t.Errorf("%d slots held while the certificate is written", n)
+			}
+			return nil
+		}, nil)
+	if err != nil || manifest.Issued != 3 {
+		t.Fatalf("job batch: %+v, %v", manifest, err)
+	}
+}
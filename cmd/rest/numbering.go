@@ -0,0 +1,128 @@
+package main
+
+// ── Automatic numbering ──────────────────────────────────────────────────────
+//
+// With NUMBERING_DOCUMENT_FORMAT or NUMBERING_BOOK_FORMAT set, a certificate
+// issued with an empty เลขที่ or เล่มที่ gets the next number of its payer's
+// sequence for the year (see pdf50tawi.Numbering), e.g.
+//
+//	NUMBERING_BOOK_FORMAT={yyyy}  NUMBERING_DOCUMENT_FORMAT={seq:05}   เล่มที่ 2568 เลขที่ 00042
+//
+// Numbers are taken once a certificate has passed validation and its
+// images have loaded. The single-certificate routes return them in
+// X-Book-Number and X-Document-Number; batch manifests carry the document
+// number of each item. Previews are never numbered.
+//
+// NUMBERING_STORE is "memory" (the default; sequences restart with the
+// server) or "sqlite:<path>", which several servers may share.
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/AnuchitO/pdf50tawi"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	headerBookNumber     = "X-Book-Number"
+	headerDocumentNumber = "X-Document-Number"
+)
+
+// numbering fills in empty numbers; nil unless a format is set.
+var numbering *pdf50tawi.Numbering
+
+// numberingFromEnv configures numbering from NUMBERING_BOOK_FORMAT,
+// NUMBERING_DOCUMENT_FORMAT and NUMBERING_STORE. It returns nil when
+// neither format is set.
+func numberingFromEnv() (*pdf50tawi.Numbering, error) {
+	n := &pdf50tawi.Numbering{
+		BookFormat:     os.Getenv("NUMBERING_BOOK_FORMAT"),
+		DocumentFormat: os.Getenv("NUMBERING_DOCUMENT_FORMAT"),
+	}
+	if n.BookFormat == "" && n.DocumentFormat == "" {
+		return nil, nil
+	}
+	if err := n.Check(); err != nil {
+		return nil, fmt.Errorf("NUMBERING_*_FORMAT: %w", err)
+	}
+	switch v := os.Getenv("NUMBERING_STORE"); {
+	case v == "" || v == "memory":
+		n.Store = pdf50tawi.NewMemorySequenceStore()
+	case strings.HasPrefix(v, "sqlite:"):
+		store, err := openSQLiteSequenceStore(strings.TrimPrefix(v, "sqlite:"))
+		if err != nil {
+			return nil, err
+		}
+		n.Store = store
+	default:
+		return nil, fmt.Errorf("NUMBERING_STORE: must be memory or sqlite:<path>, got %q", v)
+	}
+	return n, nil
+}
+
+// assignNumbers fills in the empty numbers of taxInfo when numbering is
+// enabled.
+func assignNumbers(ctx context.Context, taxInfo *pdf50tawi.TaxInfo) error {
+	if numbering == nil {
+		return nil
+	}
+	_, err := numbering.Assign(ctx, taxInfo)
+	return err
+}
+
+// assignResponseNumbers fills in the empty numbers of the certificate c
+// answers with, and reports those it assigned in the response headers.
+func assignResponseNumbers(c echo.Context, taxInfo *pdf50tawi.TaxInfo) error {
+	if numbering == nil {
+		return nil
+	}
+	assigned, err := numbering.Assign(c.Request().Context(), taxInfo)
+	if err != nil || !assigned {
+		return err
+	}
+	for name, v := range map[string]string{
+		headerBookNumber:     taxInfo.DocumentDetails.BookNumber,
+		headerDocumentNumber: taxInfo.DocumentDetails.DocumentNumber,
+	} {
+		if v != "" {
+			c.Response().Header().Set(name, v)
+		}
+	}
+	return nil
+}
+
+// sqliteSequenceStore keeps the sequences in a SQLite database. Each number
+// is taken in a single statement, so servers sharing the file never hand
+// out the same one.
+type sqliteSequenceStore struct {
+	db *sql.DB
+}
+
+func openSQLiteSequenceStore(path string) (*sqliteSequenceStore, error) {
+	// busy_timeout: other servers may be writing to the same file.
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS sequences (
+		key   TEXT PRIMARY KEY,
+		value INTEGER NOT NULL
+	)`)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("numbering store %s: %w", path, err)
+	}
+	return &sqliteSequenceStore{db: db}, nil
+}
+
+func (s *sqliteSequenceStore) Next(ctx context.Context, key string) (int64, error) {
+	var n int64
+	err := s.db.QueryRowContext(ctx, `INSERT INTO sequences (key, value) VALUES (?, 1)
+		ON CONFLICT(key) DO UPDATE SET value = value + 1 RETURNING value`, key).Scan(&n)
+	return n, err
+}
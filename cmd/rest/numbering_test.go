@@ -0,0 +1,127 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/AnuchitO/pdf50tawi"
+)
+
+func TestSQLiteSequenceStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "numbering.db")
+	// Two stores on one file stand for two servers.
+	a, err := openSQLiteSequenceStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := openSQLiteSequenceStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const perStore = 50
+	var mu sync.Mutex
+	seen := map[int64]bool{}
+	var wg sync.WaitGroup
+	for _, s := range []*sqliteSequenceStore{a, b} {
+		for range perStore {
+			wg.Go(func() {
+				n, err := s.Next(context.Background(), "0105551234567/2568")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				if seen[n] {
+					t.Errorf("number %d handed out twice", n)
+				}
+				seen[n] = true
+			})
+		}
+	}
+	wg.Wait()
+	for n := int64(1); n <= 2*perStore; n++ {
+		if !seen[n] {
+			t.Errorf("number %d skipped", n)
+		}
+	}
+	if n, _ := a.Next(context.Background(), "0105551234567/2569"); n != 1 {
+		t.Fatalf("a new year starts at %d, want 1", n)
+	}
+}
+
+func TestNumberingRoutes(t *testing.T) {
+	numbering = &pdf50tawi.Numbering{BookFormat: "{yyyy}", DocumentFormat: "{seq:05}", Store: pdf50tawi.NewMemorySequenceStore()}
+	t.Cleanup(func() { numbering = nil })
+	e := newServer()
+
+	taxInfo := `{"payer": {"taxId": "0105551234567", "name": "บริษัท ตัวอย่าง จำกัด"},
+		"payee": {"taxId": "3101234567890", "name": "นาย ก", "pnd_3": true},
+		"withholdingType": {"withholdingTax": true},
+		"certification": {"dateOfIssuance": {"day": "31", "month": "มกราคม", "year": "2568"}}}`
+	post := func(target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := post("/api/v1/taxes", `{"taxInfo": `+taxInfo+`}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("issue: status %d: %s", rec.Code, rec.Body)
+	}
+	if book, doc := rec.Header().Get("X-Book-Number"), rec.Header().Get("X-Document-Number"); book != "2568" || doc != "00001" {
+		t.Fatalf("numbers %q / %q, want 2568 / 00001", book, doc)
+	}
+
+	// Previews take no number, nor does a merged batch that fails: its
+	// valid items are not numbered either.
+	if rec := post("/api/v1/taxes/preview", `{"taxInfo": `+taxInfo+`}`); rec.Code != http.StatusOK {
+		t.Fatalf("preview: status %d", rec.Code)
+	}
+	rec = post("/api/v1/taxes/batch?format=pdf", `[`+taxInfo+`, `+taxInfo+`, {"payer": {"taxId": "0105551234567"}}]`)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("batch: status %d", rec.Code)
+	}
+	var failed batchManifest
+	if err := json.Unmarshal(rec.Body.Bytes(), &failed); err != nil || failed.Failed != 1 || len(failed.Results) != 3 || failed.Results[0].DocumentNumber != "" {
+		t.Fatalf("failed batch manifest %+v, %v", failed, err)
+	}
+	rec = post("/api/v1/taxes/batch?format=pdf", `[`+taxInfo+`, `+strings.Replace(taxInfo, `"payer": {`, `"documentDetails": {"documentNumber": "A-1"}, "payer": {`, 1)+`]`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("batch: status %d: %s", rec.Code, rec.Body)
+	}
+	rec = post("/api/v1/taxes/batch", `[`+taxInfo+`]`)
+	manifest := readZipManifest(t, rec.Body.Bytes())
+	if got := manifest.Results[0].DocumentNumber; got != "00003" {
+		t.Fatalf("manifest document number %q, want 00003 (00002 went to the merged batch)", got)
+	}
+}
+
+func readZipManifest(t *testing.T, data []byte) batchManifest {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := zr.Open("manifest.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var m batchManifest
+	if err := json.NewDecoder(f).Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
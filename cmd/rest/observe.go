@@ -0,0 +1,210 @@
+package main
+
+// ── Observability: request IDs, access logs and metrics ─────────────────────
+//
+// GET /metrics  Prometheus metrics
+//
+// Every response carries an X-Request-ID header: the client's own, when it
+// sends a usable one, or a new random id. The same id is in the JSON log
+// line written for the request, so a failure reported by a client can be
+// found in the logs.
+//
+//	pdf50tawi_http_requests_total{method,route,status}       requests answered
+//	pdf50tawi_http_request_duration_seconds{method,route}    time to answer them
+//	pdf50tawi_generation_duration_seconds{operation}         time to fill one certificate
+//	pdf50tawi_pdf_size_bytes{operation}                      size of each PDF produced
+//	pdf50tawi_validation_failures_total{operation,code}      validation issues by rule (pdf50tawi.Issue*)
+//	pdf50tawi_image_fetch_errors_total{reason}               image URLs that could not be used
+//
+// limits.go adds the requests it turns away and the generation slots in use.
+//
+// operation is issue, preview, batch (jobs included), validate or void.
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AnuchitO/pdf50tawi"
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	opIssue    = "issue"
+	opPreview  = "preview"
+	opBatch    = "batch"
+	opValidate = "validate"
+	opVoid     = "void"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "pdf50tawi_http_requests_total",
+		Help: "HTTP requests answered, by route and status.",
+	}, []string{"method", "route", "status"})
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "pdf50tawi_http_request_duration_seconds",
+		Help:    "Time to answer an HTTP request, by route.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+	generationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "pdf50tawi_generation_duration_seconds",
+		Help:    "Time to fill one certificate.",
+		Buckets: []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"operation"})
+	pdfSize = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "pdf50tawi_pdf_size_bytes",
+		Help:    "Size of each certificate PDF produced.",
+		Buckets: prometheus.ExponentialBuckets(16<<10, 2, 10), // 16 KiB to 8 MiB
+	}, []string{"operation"})
+	validationFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "pdf50tawi_validation_failures_total",
+		Help: "Validation issues found, by rule code.",
+	}, []string{"operation", "code"})
+	imageFetchErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "pdf50tawi_image_fetch_errors_total",
+		Help: "Image URLs that could not be fetched or used, by reason.",
+	}, []string{"reason"})
+)
+
+var handleMetrics = echo.WrapHandler(promhttp.Handler())
+
+// validateTaxInfo is pdf50tawi.ValidateTaxInfo, counting the issues it
+// finds.
+func validateTaxInfo(op string, taxInfo pdf50tawi.TaxInfo) error {
+	err := pdf50tawi.ValidateTaxInfo(taxInfo)
+	var ve *pdf50tawi.ValidationError
+	if errors.As(err, &ve) {
+		for _, issue := range ve.Issues {
+			validationFailures.WithLabelValues(op, issue.Code).Inc()
+		}
+	}
+	return err
+}
+
+// issuePDF is pdf50tawi.IssueWHTCertificatePDF, recording how long it took
+// and how large the PDF is.
+func issuePDF(op string, w io.Writer, taxInfo pdf50tawi.TaxInfo, sign, seal io.Reader, opts ...pdf50tawi.Option) error {
+	start := time.Now()
+	cw := &countingWriter{w: w}
+	if err := pdf50tawi.IssueWHTCertificatePDF(cw, taxInfo, sign, seal, opts...); err != nil {
+		return err
+	}
+	generationDuration.WithLabelValues(op).Observe(time.Since(start).Seconds())
+	pdfSize.WithLabelValues(op).Observe(float64(cw.n))
+	return nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// countFetchError counts an image URL that fetchImage could not use.
+func countFetchError(err error) {
+	var netErr net.Error
+	reason := "other"
+	switch {
+	case errors.Is(err, pdf50tawi.ErrForbiddenURL):
+		reason = "forbidden"
+	case errors.Is(err, pdf50tawi.ErrImageTooLarge):
+		reason = "too_large"
+	case errors.Is(err, pdf50tawi.ErrUnsupportedImage):
+		reason = "unsupported"
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		reason = "timeout"
+	case errors.Is(err, context.Canceled):
+		return // the client went away
+	}
+	imageFetchErrors.WithLabelValues(reason).Inc()
+}
+
+// observe gives each request an id, logs it once answered and counts it.
+// Health checks and scrapes are logged at debug level only.
+func observe(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		start := time.Now()
+		id := c.Request().Header.Get(echo.HeaderXRequestID)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		c.Response().Header().Set(echo.HeaderXRequestID, id)
+
+		err := next(c)
+		if err != nil {
+			// Let the error handler write the response now, so its status
+			// is the one recorded.
+			c.Error(err)
+		}
+		elapsed := time.Since(start)
+		req, res := c.Request(), c.Response()
+		route := c.Path()
+		if route == "" {
+			route = "unmatched"
+		}
+		httpRequests.WithLabelValues(req.Method, route, strconv.Itoa(res.Status)).Inc()
+		httpDuration.WithLabelValues(req.Method, route).Observe(elapsed.Seconds())
+
+		level := slog.LevelInfo
+		switch {
+		case res.Status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case route == "/healthz" || route == "/readyz" || route == "/metrics":
+			level = slog.LevelDebug
+		}
+		attrs := []slog.Attr{
+			slog.String("requestId", id),
+			slog.String("method", req.Method),
+			slog.String("route", route),
+			slog.String("path", req.URL.Path),
+			slog.Int("status", res.Status),
+			slog.Float64("durationMs", float64(elapsed.Microseconds())/1000),
+			slog.Int64("bytes", res.Size),
+			slog.String("remoteIp", c.RealIP()),
+		}
+		if p := caller(c); p != nil {
+			attrs = append(attrs, slog.String("caller", p.Name))
+		}
+		if err != nil {
+			attrs = append(attrs, slog.String("error", err.Error()))
+		}
+		slog.LogAttrs(req.Context(), level, "request", attrs...)
+		return nil
+	}
+}
+
+// validRequestID accepts a client's request id if it is short and printable,
+// so it cannot break the log line or the response header.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, r := range id {
+		if r < 0x21 || r > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/AnuchitO/pdf50tawi"
+)
+
+func TestRequestID(t *testing.T) {
+	e := newServer()
+	testCases := []struct {
+		name, sent string
+		echoed     bool
+	}{
+		{"Generated", "", false},
+		{"Echoed", "payroll-2568-01-0042", true},
+		{"Unprintable", "bad\x01id", false},
+		{"TooLong", strings.Repeat("x", 200), false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+			if tc.sent != "" {
+				req.Header.Set("X-Request-ID", tc.sent)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			got := rec.Header().Get("X-Request-ID")
+			if got == "" {
+				t.Fatal("no X-Request-ID in the response")
+			}
+			if (got == tc.sent) != tc.echoed {
+				t.Fatalf("X-Request-ID %q for %q, echoed want %v", got, tc.sent, tc.echoed)
+			}
+		})
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	e := newServer()
+	body := `{"taxInfo": {"payer": {"taxId": "123", "name": "บริษัท ตัวอย่าง จำกัด"}, "payee": {"name": "นาย ก", "pnd_53": true}, "withholdingType": {"oneTime": true}}}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/taxes/validate", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	e.ServeHTTP(httptest.NewRecorder(), req)
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/nowhere", nil))
+	countFetchError(pdf50tawi.ErrForbiddenURL)
+	countFetchError(errors.New("unexpected status 404"))
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("/metrics: status %d", rec.Code)
+	}
+	for _, want := range []string{
+		`pdf50tawi_http_requests_total{method="POST",route="/api/v1/taxes/validate",status="200"}`,
+		`pdf50tawi_http_requests_total{method="GET",route="unmatched",status="404"}`,
+		`pdf50tawi_validation_failures_total{code="tax_id_format",operation="validate"}`,
+		`pdf50tawi_image_fetch_errors_total{reason="forbidden"}`,
+		`pdf50tawi_image_fetch_errors_total{reason="other"}`,
+	} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("/metrics has no %s", want)
+		}
+	}
+}
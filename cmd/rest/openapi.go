@@ -0,0 +1,96 @@
+package main
+
+// ── OpenAPI: the machine-readable contract of this server ───────────────────
+//
+// GET /openapi.json  OpenAPI 3.1 document of every route
+// GET /docs          Swagger UI page for it
+//
+// openapi.json is written by hand next to the handlers; the TaxInfo schema
+// and its definitions are copied in from schema/taxinfo.schema.json when the
+// document is served, so the two cannot drift apart. openapi_test.go checks
+// that every route is documented.
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/AnuchitO/pdf50tawi"
+	"github.com/labstack/echo/v4"
+)
+
+//go:embed openapi.json
+var openAPIBase []byte
+
+//go:embed docs.html
+var docsPage []byte
+
+// openAPISpec is the served document, built once.
+var openAPISpec = sync.OnceValues(buildOpenAPISpec)
+
+// buildOpenAPISpec adds the TaxInfo JSON Schema to openapi.json: TaxInfo and
+// each of its $defs become components/schemas entries, with the $refs
+// between them rewritten to match.
+func buildOpenAPISpec() ([]byte, error) {
+	var spec map[string]any
+	if err := json.Unmarshal(openAPIBase, &spec); err != nil {
+		return nil, fmt.Errorf("openapi.json: %w", err)
+	}
+	var taxInfo map[string]any
+	if err := json.Unmarshal(pdf50tawi.TaxInfoSchema(), &taxInfo); err != nil {
+		return nil, fmt.Errorf("TaxInfo schema: %w", err)
+	}
+
+	components, _ := spec["components"].(map[string]any)
+	schemas, _ := components["schemas"].(map[string]any)
+	if schemas == nil {
+		return nil, fmt.Errorf("openapi.json: missing components/schemas")
+	}
+	defs, _ := taxInfo["$defs"].(map[string]any)
+	delete(taxInfo, "$defs")
+	delete(taxInfo, "$schema")
+	delete(taxInfo, "$id")
+	defs["TaxInfo"] = taxInfo
+	for name, def := range defs {
+		if _, ok := schemas[name]; ok {
+			return nil, fmt.Errorf("openapi.json: schema %s is already defined by the TaxInfo schema", name)
+		}
+		schemas[name] = rewriteRefs(def)
+	}
+	return json.Marshal(spec)
+}
+
+// rewriteRefs points the "#/$defs/X" references of v at
+// "#/components/schemas/X".
+func rewriteRefs(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, child := range v {
+			if ref, ok := child.(string); ok && k == "$ref" {
+				v[k] = strings.Replace(ref, "#/$defs/", "#/components/schemas/", 1)
+				continue
+			}
+			v[k] = rewriteRefs(child)
+		}
+	case []any:
+		for i, child := range v {
+			v[i] = rewriteRefs(child)
+		}
+	}
+	return v
+}
+
+func handleOpenAPI(c echo.Context) error {
+	spec, err := openAPISpec()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, errResp(err.Error()))
+	}
+	return c.Blob(http.StatusOK, echo.MIMEApplicationJSON, spec)
+}
+
+func handleDocs(c echo.Context) error {
+	return c.HTMLBlob(http.StatusOK, docsPage)
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/AnuchitO/pdf50tawi"
+)
+
+func loadOpenAPISpec(t *testing.T) map[string]any {
+	t.Helper()
+	data, err := openAPISpec()
+	if err != nil {
+		t.Fatalf("build spec: %v", err)
+	}
+	var spec map[string]any
+	if err := json.Unmarshal(data, &spec); err != nil {
+		t.Fatalf("spec is not JSON: %v", err)
+	}
+	return spec
+}
+
+// TestOpenAPIDocumentsEveryRoute keeps openapi.json and newServer in step:
+// every route is documented and every documented operation is routed.
+func TestOpenAPIDocumentsEveryRoute(t *testing.T) {
+	spec := loadOpenAPISpec(t)
+	param := regexp.MustCompile(`:(\w+)`)
+
+	routed := map[string]bool{}
+	for _, r := range newServer().Routes() {
+		routed[r.Method+" "+param.ReplaceAllString(r.Path, "{$1}")] = true
+	}
+	documented := map[string]bool{}
+	for path, item := range spec["paths"].(map[string]any) {
+		for method := range item.(map[string]any) {
+			if method == "parameters" {
+				continue
+			}
+			documented[strings.ToUpper(method)+" "+path] = true
+		}
+	}
+
+	for _, op := range sortedKeys(routed) {
+		if !documented[op] {
+			t.Errorf("route %s is not in openapi.json", op)
+		}
+	}
+	for _, op := range sortedKeys(documented) {
+		if !routed[op] {
+			t.Errorf("openapi.json documents %s, which is not routed", op)
+		}
+	}
+}
+
+func TestOpenAPIRefsResolve(t *testing.T) {
+	spec := loadOpenAPISpec(t)
+	if _, ok := resolvePointer(spec, "#/components/schemas/TaxInfo"); !ok {
+		t.Fatal("TaxInfo schema is missing")
+	}
+	walkJSON(spec, func(key string, v any) {
+		ref, ok := v.(string)
+		if key != "$ref" || !ok {
+			return
+		}
+		if _, ok := resolvePointer(spec, ref); !ok {
+			t.Errorf("unresolved $ref %s", ref)
+		}
+	})
+}
+
+// TestOpenAPIExamplesAreValid checks that every TaxInfo in an example
+// payload decodes without unknown keys and passes validation.
+func TestOpenAPIExamplesAreValid(t *testing.T) {
+	spec := loadOpenAPISpec(t)
+	var examples []any
+	walkJSON(spec, func(key string, v any) {
+		if key == "example" || key == "value" {
+			examples = append(examples, v)
+		}
+	})
+	var taxInfos []any
+	for _, ex := range examples {
+		walkJSON(ex, func(key string, v any) {
+			switch v := v.(type) {
+			case map[string]any:
+				if key == "taxInfo" {
+					taxInfos = append(taxInfos, v)
+				}
+			case []any:
+				if key == "items" {
+					taxInfos = append(taxInfos, v...)
+				}
+			}
+		})
+	}
+	if len(taxInfos) == 0 {
+		t.Fatal("no TaxInfo examples found")
+	}
+	for i, v := range taxInfos {
+		data, _ := json.Marshal(v)
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		var taxInfo pdf50tawi.TaxInfo
+		if err := dec.Decode(&taxInfo); err != nil {
+			t.Errorf("example %d: %v", i, err)
+			continue
+		}
+		if err := pdf50tawi.ValidateTaxInfo(taxInfo); err != nil {
+			t.Errorf("example %d: %v", i, err)
+		}
+	}
+}
+
+func TestOpenAPIHandlers(t *testing.T) {
+	e := newServer()
+	for path, contentType := range map[string]string{
+		"/openapi.json": "application/json",
+		"/docs":         "text/html",
+	} {
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: status %d", path, rec.Code)
+		}
+		if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, contentType) {
+			t.Errorf("%s: Content-Type %q, want %s", path, ct, contentType)
+		}
+	}
+}
+
+// walkJSON calls fn with every key and value below v; array elements get
+// the key of their array.
+func walkJSON(v any, fn func(key string, v any)) {
+	var walk func(key string, v any)
+	walk = func(key string, v any) {
+		fn(key, v)
+		switch v := v.(type) {
+		case map[string]any:
+			for k, child := range v {
+				walk(k, child)
+			}
+		case []any:
+			for _, child := range v {
+				walk(key, child)
+			}
+		}
+	}
+	walk("", v)
+}
+
+// resolvePointer looks up a local reference such as "#/components/schemas/X".
+func resolvePointer(doc map[string]any, ref string) (any, bool) {
+	if !strings.HasPrefix(ref, "#/") {
+		return nil, false
+	}
+	var cur any = doc
+	for _, part := range strings.Split(ref[2:], "/") {
+		part = strings.NewReplacer("~1", "/", "~0", "~").Replace(part)
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if cur, ok = m[part]; !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,144 @@
+package main
+
+// ── Payer assets: a payer's signature and seal, stored once ─────────────────
+//
+// PUT    /api/v1/payers/:taxId/assets/:kind  store the image (raw body, or multipart part "image")
+// GET    /api/v1/payers/:taxId/assets/:kind  the stored image as PNG
+// DELETE /api/v1/payers/:taxId/assets/:kind  remove it
+//
+// kind is "signature" or "seal". Images are normalised on upload: re-encoded
+// as PNG, without metadata, and scaled down to fit maxPayerAssetSize.
+// Issuance requests then refer to them through the payer of the TaxInfo:
+//
+//	"certification": {"payerSignatureImage": {"sourceType": "payer", "value": "signature"}}
+//
+// curl -X PUT http://localhost:8080/api/v1/payers/0105551234567/assets/seal \
+//   -H 'Content-Type: image/png' \
+//   --data-binary @seal.png
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/AnuchitO/pdf50tawi"
+	"github.com/labstack/echo/v4"
+)
+
+// maxPayerAssetSize bounds the width and height of a stored image; the
+// signature and seal boxes are about 2.5 cm wide, so this is ample at print
+// resolution.
+const maxPayerAssetSize = 1024
+
+// payerAssets stores the payers' signatures and seals. It is nil unless
+// ASSET_DIR is set.
+var payerAssets payerAssetStore
+
+// payerAssetInfo describes a stored image.
+type payerAssetInfo struct {
+	TaxID  string `json:"taxId"`
+	Kind   string `json:"kind"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Bytes  int    `json:"bytes"`
+}
+
+// payerAssetParams checks the path of a payer asset route and the caller's
+// right to the payer.
+func payerAssetParams(c echo.Context) (taxID, kind string, err error) {
+	if payerAssets == nil {
+		return "", "", &apiError{http.StatusNotImplemented, "payer assets are not enabled on this server (set ASSET_DIR)"}
+	}
+	taxID = strings.ReplaceAll(c.Param("taxId"), " ", "")
+	if len(taxID) != 13 || strings.Trim(taxID, "0123456789") != "" {
+		return "", "", badRequest("taxId must be 13 digits")
+	}
+	kind = c.Param("kind")
+	if kind != pdf50tawi.PayerAssetSignature && kind != pdf50tawi.PayerAssetSeal {
+		return "", "", &apiError{http.StatusNotFound, "kind must be signature or seal"}
+	}
+	if err := authorizePayer(c, taxID); err != nil {
+		return "", "", err
+	}
+	return taxID, kind, nil
+}
+
+func handlePutPayerAsset(c echo.Context) error {
+	taxID, kind, err := payerAssetParams(c)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+
+	var img io.Reader = c.Request().Body
+	mediaType, _, _ := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+	if mediaType == echo.MIMEMultipartForm {
+		form, err := c.MultipartForm()
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, errResp("parse multipart form: "+err.Error()))
+		}
+		defer form.RemoveAll()
+		files := form.File["image"]
+		if len(files) == 0 {
+			return c.JSON(http.StatusBadRequest, errResp("missing 'image' file part"))
+		}
+		f, err := files[0].Open()
+		if err != nil {
+			return errorJSON(c, err)
+		}
+		defer f.Close()
+		img = f
+	}
+
+	data, err := pdf50tawi.NormalizeImage(img, pdf50tawi.DefaultImageLimits, maxPayerAssetSize, maxPayerAssetSize)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, errResp(err.Error()))
+	}
+	created, err := payerAssets.PutPayerAsset(taxID, kind, data)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	info := payerAssetInfo{TaxID: taxID, Kind: kind, Bytes: len(data)}
+	if cfg, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+		info.Width, info.Height = cfg.Width, cfg.Height
+	}
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+		c.Response().Header().Set(echo.HeaderLocation, c.Request().URL.Path)
+	}
+	return c.JSON(status, info)
+}
+
+func handleGetPayerAsset(c echo.Context) error {
+	taxID, kind, err := payerAssetParams(c)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	data, err := payerAssets.PayerAsset(taxID, kind)
+	if err != nil {
+		return payerAssetError(c, err)
+	}
+	return c.Blob(http.StatusOK, "image/png", data)
+}
+
+func handleDeletePayerAsset(c echo.Context) error {
+	taxID, kind, err := payerAssetParams(c)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	if err := payerAssets.DeletePayerAsset(taxID, kind); err != nil {
+		return payerAssetError(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func payerAssetError(c echo.Context, err error) error {
+	if errors.Is(err, errAssetNotFound) {
+		return c.JSON(http.StatusNotFound, errResp(err.Error()))
+	}
+	return errorJSON(c, err)
+}
@@ -0,0 +1,208 @@
+package main
+
+// ── Certificate registry ─────────────────────────────────────────────────────
+//
+// GET /api/v1/certificates           issued certificates, newest first
+//     ?payerTaxId=&payeeTaxId=&taxYear=&documentNumber=&limit=&offset=
+// GET /api/v1/certificates/:id       one certificate's record, with its TaxInfo
+// GET /api/v1/certificates/:id/pdf   the PDF as issued; stamped ยกเลิก once void
+//                                    (?copy=original for the PDF as issued)
+//
+// With REGISTRY_STORE set, every certificate issued by /api/v1/taxes, the
+// strategy routes, batches and jobs is recorded with its TaxInfo, the
+// SHA-256 of its PDF, the template version, the caller and the time. The
+// single-certificate routes answer with its id in X-Certificate-ID; batch
+// manifests carry it per item. Previews are drafts and are not recorded.
+//
+// A caller limited to some payers sees only their certificates, and must
+// name the payer when listing. Certificates are voided and reissued through
+// reissue.go.
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AnuchitO/pdf50tawi"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	headerCertificateID = "X-Certificate-ID"
+	defaultListLimit    = 100
+	maxListLimit        = 1000
+)
+
+// registry records issued certificates; nil unless REGISTRY_STORE is set.
+var registry registryStore
+
+// registryFromEnv opens the store named by REGISTRY_STORE: "sqlite:<path>"
+// or "dir:<path>". It returns nil when the variable is not set.
+func registryFromEnv() (registryStore, error) {
+	switch v := os.Getenv("REGISTRY_STORE"); {
+	case v == "":
+		return nil, nil
+	case strings.HasPrefix(v, "sqlite:"):
+		return openSQLiteRegistryStore(strings.TrimPrefix(v, "sqlite:"))
+	case strings.HasPrefix(v, "dir:"):
+		return openDirRegistryStore(strings.TrimPrefix(v, "dir:"))
+	default:
+		return nil, fmt.Errorf("REGISTRY_STORE: must be sqlite:<path> or dir:<path>, got %q", v)
+	}
+}
+
+// registerCertificate records pdf, issued from taxInfo by issuer, in the
+// registry. Without a registry it does nothing and returns a zero record.
+func registerCertificate(issuer string, taxInfo pdf50tawi.TaxInfo, pdf []byte) (certificateRecord, error) {
+	if registry == nil {
+		return certificateRecord{}, nil
+	}
+	r := newCertificateRecord(issuer, taxInfo, pdf)
+	if err := registry.Add(r, pdf); err != nil {
+		return certificateRecord{}, fmt.Errorf("register certificate: %w", err)
+	}
+	return r, nil
+}
+
+// newCertificateRecord returns the record of pdf, issued from taxInfo by
+// issuer, under a new id.
+func newCertificateRecord(issuer string, taxInfo pdf50tawi.TaxInfo, pdf []byte) certificateRecord {
+	// Image sources may hold whole base64 images; like the embedded
+	// metadata, the record keeps what is printed.
+	taxInfo.Certification.PayerSignatureImage = nil
+	taxInfo.Certification.CompanySealImage = nil
+
+	now := time.Now().UTC()
+	sum := sha256.Sum256(pdf)
+	return certificateRecord{
+		ID:              newCertificateID(),
+		PayerTaxID:      strings.ReplaceAll(taxInfo.Payer.TaxID, " ", ""),
+		PayeeTaxID:      strings.ReplaceAll(taxInfo.Payee.TaxID, " ", ""),
+		TaxYear:         taxInfo.Certification.DateOfIssuance.BuddhistYear(now),
+		BookNumber:      taxInfo.DocumentDetails.BookNumber,
+		DocumentNumber:  taxInfo.DocumentDetails.DocumentNumber,
+		PDFSHA256:       hex.EncodeToString(sum[:]),
+		PDFSize:         len(pdf),
+		TemplateVersion: pdf50tawi.TemplateVersion(),
+		Issuer:          issuer,
+		IssuedAt:        now,
+		TaxInfo:         taxInfo,
+	}
+}
+
+func handleListCertificates(c echo.Context) error {
+	if registry == nil {
+		return errorJSON(c, errNoRegistry)
+	}
+	q := certificateQuery{
+		PayerTaxID:     strings.ReplaceAll(c.QueryParam("payerTaxId"), " ", ""),
+		PayeeTaxID:     strings.ReplaceAll(c.QueryParam("payeeTaxId"), " ", ""),
+		TaxYear:        c.QueryParam("taxYear"),
+		DocumentNumber: c.QueryParam("documentNumber"),
+	}
+	var err error
+	if q.Limit, err = queryInt(c, "limit", defaultListLimit, 1, maxListLimit); err != nil {
+		return errorJSON(c, err)
+	}
+	if q.Offset, err = queryInt(c, "offset", 0, 0, -1); err != nil {
+		return errorJSON(c, err)
+	}
+	if p := caller(c); p != nil && !p.mayIssueFor(q.PayerTaxID) {
+		if q.PayerTaxID == "" {
+			return c.JSON(http.StatusForbidden, errResp("payerTaxId is required to check this credential's payers"))
+		}
+		return c.JSON(http.StatusForbidden, errResp(fmt.Sprintf("not allowed to list certificates of payer %q", q.PayerTaxID)))
+	}
+	records, err := registry.Find(q)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	if records == nil {
+		records = []certificateRecord{}
+	}
+	return c.JSON(http.StatusOK, map[string]any{"certificates": records, "limit": q.Limit, "offset": q.Offset})
+}
+
+func handleGetCertificate(c echo.Context) error {
+	r, err := callerCertificate(c)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, r)
+}
+
+func handleCertificatePDF(c echo.Context) error {
+	r, err := callerCertificate(c)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	read := registry.PDF
+	if r.Void != nil && c.QueryParam("copy") != "original" {
+		read = registry.VoidPDF
+	}
+	pdf, err := read(r.ID)
+	if err != nil {
+		return errorJSON(c, registryError(err))
+	}
+	c.Response().Header().Set("Content-Disposition", "attachment; filename=certificate-"+r.ID+".pdf")
+	return c.Blob(http.StatusOK, "application/pdf", pdf)
+}
+
+func newCertificateID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+var errNoRegistry = &apiError{http.StatusNotImplemented, "the certificate registry is not enabled on this server (set REGISTRY_STORE)"}
+
+// callerCertificate returns the certificate named in the path if the caller
+// may act for its payer; other payers' certificates are reported as not
+// found.
+func callerCertificate(c echo.Context) (certificateRecord, error) {
+	if registry == nil {
+		return certificateRecord{}, errNoRegistry
+	}
+	r, err := registry.Get(c.Param("id"))
+	if err != nil {
+		return certificateRecord{}, registryError(err)
+	}
+	if p := caller(c); p != nil && !p.mayIssueFor(r.PayerTaxID) {
+		return certificateRecord{}, registryError(errCertificateNotFound)
+	}
+	return r, nil
+}
+
+func registryError(err error) error {
+	switch {
+	case errors.Is(err, errCertificateNotFound):
+		return &apiError{http.StatusNotFound, err.Error()}
+	case errors.Is(err, errCertificateVoided):
+		return &apiError{http.StatusConflict, err.Error()}
+	}
+	return err
+}
+
+// queryInt reads the integer query parameter name, def when absent, within
+// [lo, hi]; hi < 0 means no upper bound.
+func queryInt(c echo.Context, name string, def, lo, hi int) (int, error) {
+	v := c.QueryParam(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < lo || (hi >= 0 && n > hi) {
+		if hi < 0 {
+			return 0, badRequest(fmt.Sprintf("%s must be an integer of at least %d", name, lo))
+		}
+		return 0, badRequest(fmt.Sprintf("%s must be an integer from %d to %d", name, lo, hi))
+	}
+	return n, nil
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AnuchitO/pdf50tawi"
+)
+
+func TestRegistryStores(t *testing.T) {
+	dir, err := openDirRegistryStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlite, err := openSQLiteRegistryStore(filepath.Join(t.TempDir(), "registry.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stores := map[string]registryStore{"Dir": dir, "SQLite": sqlite}
+	// A replacement each store fails to add: the directory store refuses
+	// an id that is not hex, SQLite one that already exists.
+	unaddable := map[string]string{"Dir": "zz", "SQLite": "a1"}
+	for name, s := range stores {
+		t.Run(name, func(t *testing.T) {
+			records := []certificateRecord{
+				{ID: "a1", PayerTaxID: "1111111111111", PayeeTaxID: "3333333333333", TaxYear: "2567", DocumentNumber: "0001", IssuedAt: testNow},
+				{ID: "a2", PayerTaxID: "1111111111111", PayeeTaxID: "4444444444444", TaxYear: "2568", DocumentNumber: "0002", IssuedAt: testNow.Add(time.Minute)},
+				{ID: "a3", PayerTaxID: "2222222222222", PayeeTaxID: "3333333333333", TaxYear: "2568", DocumentNumber: "0001", IssuedAt: testNow.Add(2 * time.Minute)},
+			}
+			for _, r := range records {
+				r.TaxInfo.Payee.Name = "นาย " + r.ID
+				if err := s.Add(r, []byte("%PDF "+r.ID)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			r, err := s.Get("a2")
+			if err != nil || r.PayeeTaxID != "4444444444444" || r.TaxInfo.Payee.Name != "นาย a2" || !r.IssuedAt.Equal(records[1].IssuedAt) {
+				t.Fatalf("Get: %+v, %v", r, err)
+			}
+			if pdf, err := s.PDF("a3"); err != nil || string(pdf) != "%PDF a3" {
+				t.Fatalf("PDF: %q, %v", pdf, err)
+			}
+			if _, err := s.Get("ffff"); err != errCertificateNotFound {
+				t.Fatalf("unknown id: %v", err)
+			}
+
+			ids := func(q certificateQuery) string {
+				found, err := s.Find(q)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var ids []string
+				for _, r := range found {
+					ids = append(ids, r.ID)
+				}
+				return strings.Join(ids, ",")
+			}
+			for _, tc := range []struct {
+				q    certificateQuery
+				want string
+			}{
+				{certificateQuery{}, "a3,a2,a1"},
+				{certificateQuery{PayerTaxID: "1111111111111"}, "a2,a1"},
+				{certificateQuery{PayeeTaxID: "3333333333333"}, "a3,a1"},
+				{certificateQuery{TaxYear: "2568"}, "a3,a2"},
+				{certificateQuery{DocumentNumber: "0001", TaxYear: "2567"}, "a1"},
+				{certificateQuery{Limit: 1, Offset: 1}, "a2"},
+				{certificateQuery{Offset: 5}, ""},
+			} {
+				if got := ids(tc.q); got != tc.want {
+					t.Errorf("Find(%+v) = %s, want %s", tc.q, got, tc.want)
+				}
+			}
+
+			v := certificateVoid{Reason: "ผิด", VoidedAt: testNow, PDFSHA256: "ab", PDFSize: 9}
+			if err := s.Void("a1", v, []byte("%PDF void")); err != nil {
+				t.Fatalf("Void: %v", err)
+			}
+			if err := s.Void("a1", v, nil); err != errCertificateVoided {
+				t.Fatalf("second Void: %v", err)
+			}
+			if err := s.Void("ffff", v, nil); err != errCertificateNotFound {
+				t.Fatalf("Void of an unknown id: %v", err)
+			}
+			r, err = s.Get("a1")
+			if err != nil || r.Void == nil || r.Void.Reason != "ผิด" || r.ReplacedBy != "" || r.TaxInfo.Payee.Name != "นาย a1" {
+				t.Fatalf("voided record: %+v, %v", r, err)
+			}
+			if pdf, err := s.VoidPDF("a1"); err != nil || string(pdf) != "%PDF void" {
+				t.Fatalf("VoidPDF: %q, %v", pdf, err)
+			}
+			if pdf, err := s.PDF("a1"); err != nil || string(pdf) != "%PDF a1" {
+				t.Fatalf("PDF of a void certificate: %q, %v", pdf, err)
+			}
+			if _, err := s.VoidPDF("a2"); err != errCertificateNotFound {
+				t.Fatalf("VoidPDF of a valid certificate: %v", err)
+			}
+
+			// A replacement that cannot be added leaves the original valid.
+			bad := certificateRecord{ID: unaddable[name], Replaces: "a3", IssuedAt: testNow}
+			if err := s.Replace("a3", v, []byte("%PDF void"), bad, []byte("%PDF bad")); err == nil {
+				t.Fatal("Replace with a replacement that cannot be added: no error")
+			}
+			if r, err := s.Get("a3"); err != nil || r.Void != nil || r.ReplacedBy != "" {
+				t.Fatalf("original after a failed Replace: %+v, %v", r, err)
+			}
+			if got := ids(certificateQuery{}); got != "a3,a2,a1" {
+				t.Fatalf("certificates after a failed Replace: %s", got)
+			}
+
+			a4 := certificateRecord{ID: "a4", PayerTaxID: "2222222222222", Replaces: "a3", IssuedAt: testNow.Add(3 * time.Minute)}
+			if err := s.Replace("a3", v, []byte("%PDF void"), a4, []byte("%PDF a4")); err != nil {
+				t.Fatalf("Replace: %v", err)
+			}
+			if r, err := s.Get("a3"); err != nil || r.Void == nil || r.ReplacedBy != "a4" {
+				t.Fatalf("replaced record: %+v, %v", r, err)
+			}
+			if r, err := s.Get("a4"); err != nil || r.Replaces != "a3" {
+				t.Fatalf("replacement: %+v, %v", r, err)
+			}
+			a5 := certificateRecord{ID: "a5", Replaces: "a3", IssuedAt: testNow}
+			if err := s.Replace("a3", v, nil, a5, nil); err != errCertificateVoided {
+				t.Fatalf("second Replace: %v", err)
+			}
+			if _, err := s.Get("a5"); err != errCertificateNotFound {
+				t.Fatalf("replacement of a failed Replace: %v", err)
+			}
+		})
+	}
+}
+
+// TestSQLiteRegistryShared voids the same certificates through two servers
+// sharing one database: each is voided once, and neither finds it locked.
+func TestSQLiteRegistryShared(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registry.db")
+	var stores [2]*sqliteRegistryStore
+	for i := range stores {
+		s, err := openSQLiteRegistryStore(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { s.db.Close() })
+		stores[i] = s
+	}
+	const n = 10
+	for i := range n {
+		if err := stores[0].Add(certificateRecord{ID: fmt.Sprintf("%04x", i), IssuedAt: testNow}, []byte("%PDF")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	var voided atomic.Int32
+	for _, s := range stores {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range n {
+				switch err := s.Void(fmt.Sprintf("%04x", i), certificateVoid{Reason: "ผิด"}, []byte("%PDF void")); err {
+				case nil:
+					voided.Add(1)
+				case errCertificateVoided:
+				default:
+					t.Errorf("Void: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if voided.Load() != n {
+		t.Fatalf("%d Voids succeeded, want %d", voided.Load(), n)
+	}
+}
+
+func TestRegistryRoutes(t *testing.T) {
+	var err error
+	if registry, err = openDirRegistryStore(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { registry = nil })
+	a, err := newAuthenticator(authConfig{APIKeys: []apiKeyConfig{
+		{Name: "acme", Key: "acme-key", Payers: []string{"1234567890123"}},
+		{Name: "other", Key: "other-key", Payers: []string{"0105559876543"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth = a
+	t.Cleanup(func() { auth = nil })
+	e := newServer()
+
+	do := func(method, target, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", key)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	taxInfo := `{"documentDetails": {"bookNumber": "001", "documentNumber": "0042"},
+		"payer": {"taxId": "1 2345 67890 12 3", "name": "บริษัท ตัวอย่าง จำกัด"},
+		"payee": {"taxId": "3101234567890", "name": "นาย ก", "pnd_3": true},
+		"income40_2": {"datePaid": "31 มกราคม 2568", "amountPaid": "10,000.00", "taxWithheld": "300.00"},
+		"withholdingType": {"withholdingTax": true},
+		"certification": {"dateOfIssuance": {"day": "31", "month": "มกราคม", "year": "2568"}}}`
+	issued := do(http.MethodPost, "/api/v1/taxes", "acme-key", `{"taxInfo": `+taxInfo+`}`)
+	if issued.Code != http.StatusOK {
+		t.Fatalf("issue: status %d: %s", issued.Code, issued.Body)
+	}
+	id := issued.Header().Get("X-Certificate-ID")
+	if id == "" {
+		t.Fatal("no X-Certificate-ID")
+	}
+	// A ค.ศ. year is recorded as พ.ศ., so the list finds both.
+	batch := do(http.MethodPost, "/api/v1/taxes/batch?format=pdf", "acme-key", `[`+strings.Replace(taxInfo, `"year": "2568"`, `"year": "2025"`, 1)+`]`)
+	if batch.Code != http.StatusOK {
+		t.Fatalf("batch: status %d: %s", batch.Code, batch.Body)
+	}
+
+	list := do(http.MethodGet, "/api/v1/certificates?payerTaxId=1234567890123&taxYear=2568&documentNumber=0042", "acme-key", "")
+	var listed struct {
+		Certificates []certificateRecord `json:"certificates"`
+	}
+	if err := json.Unmarshal(list.Body.Bytes(), &listed); err != nil || list.Code != http.StatusOK {
+		t.Fatalf("list: status %d, %v: %s", list.Code, err, list.Body)
+	}
+	if len(listed.Certificates) != 2 {
+		t.Fatalf("listed %d certificates, want 2", len(listed.Certificates))
+	}
+	r := listed.Certificates[1] // oldest last
+	if r.ID != id || r.Issuer != "acme" || r.PayerTaxID != "1234567890123" || r.TemplateVersion != pdf50tawi.TemplateVersion() {
+		t.Fatalf("record %+v", r)
+	}
+
+	pdf := do(http.MethodGet, "/api/v1/certificates/"+id+"/pdf", "acme-key", "")
+	sum := sha256.Sum256(pdf.Body.Bytes())
+	if pdf.Code != http.StatusOK || hex.EncodeToString(sum[:]) != r.PDFSHA256 || pdf.Body.String() != issued.Body.String() {
+		t.Fatalf("pdf: status %d, hash does not match the record", pdf.Code)
+	}
+
+	for _, tc := range []struct {
+		name, target, key string
+		want              int
+	}{
+		{"Get", "/api/v1/certificates/" + id, "acme-key", http.StatusOK},
+		{"OtherPayerGet", "/api/v1/certificates/" + id, "other-key", http.StatusNotFound},
+		{"OtherPayerPDF", "/api/v1/certificates/" + id + "/pdf", "other-key", http.StatusNotFound},
+		{"OtherPayerList", "/api/v1/certificates?payerTaxId=1234567890123", "other-key", http.StatusForbidden},
+		{"ListWithoutPayer", "/api/v1/certificates", "acme-key", http.StatusForbidden},
+		{"BadLimit", "/api/v1/certificates?payerTaxId=1234567890123&limit=0", "acme-key", http.StatusBadRequest},
+		{"Unknown", "/api/v1/certificates/0000", "acme-key", http.StatusNotFound},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if rec := do(http.MethodGet, tc.target, tc.key, ""); rec.Code != tc.want {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tc.want, rec.Body)
+			}
+		})
+	}
+}
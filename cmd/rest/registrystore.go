@@ -0,0 +1,500 @@
+package main
+
+import (
+	"cmp"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AnuchitO/pdf50tawi"
+)
+
+// errCertificateNotFound is returned by a registryStore for an unknown id.
+var errCertificateNotFound = errors.New("certificate not found")
+
+// errCertificateVoided is returned by registryStore.Void for a certificate
+// that is already void.
+var errCertificateVoided = errors.New("certificate is already void")
+
+// certificateRecord is the registry entry of one issued certificate. The
+// tax IDs are stored without spaces.
+type certificateRecord struct {
+	ID              string            `json:"id"`
+	PayerTaxID      string            `json:"payerTaxId"`
+	PayeeTaxID      string            `json:"payeeTaxId"`
+	TaxYear         string            `json:"taxYear"` // Buddhist Era, e.g. "2568"
+	BookNumber      string            `json:"bookNumber,omitempty"`
+	DocumentNumber  string            `json:"documentNumber,omitempty"`
+	PDFSHA256       string            `json:"pdfSha256"`
+	PDFSize         int               `json:"pdfSize"`
+	TemplateVersion string            `json:"templateVersion"`
+	Issuer          string            `json:"issuer,omitempty"` // the caller, when auth is on
+	IssuedAt        time.Time         `json:"issuedAt"`
+	TaxInfo         pdf50tawi.TaxInfo `json:"taxInfo"`
+
+	Void       *certificateVoid `json:"void,omitempty"`
+	Replaces   string           `json:"replaces,omitempty"`   // id of the certificate this one was issued in place of
+	ReplacedBy string           `json:"replacedBy,omitempty"` // id of the certificate issued in place of this one
+}
+
+// certificateVoid records the cancellation of a certificate and its copy
+// stamped ยกเลิก.
+type certificateVoid struct {
+	Reason    string    `json:"reason"`
+	VoidedAt  time.Time `json:"voidedAt"`
+	VoidedBy  string    `json:"voidedBy,omitempty"`
+	PDFSHA256 string    `json:"pdfSha256"`
+	PDFSize   int       `json:"pdfSize"`
+}
+
+// certificateQuery selects records; empty fields match everything. Results
+// are newest first.
+type certificateQuery struct {
+	PayerTaxID     string
+	PayeeTaxID     string
+	TaxYear        string
+	DocumentNumber string
+	Limit, Offset  int
+}
+
+func (q certificateQuery) matches(r certificateRecord) bool {
+	return (q.PayerTaxID == "" || q.PayerTaxID == r.PayerTaxID) &&
+		(q.PayeeTaxID == "" || q.PayeeTaxID == r.PayeeTaxID) &&
+		(q.TaxYear == "" || q.TaxYear == r.TaxYear) &&
+		(q.DocumentNumber == "" || q.DocumentNumber == r.DocumentNumber)
+}
+
+// registryStore keeps the issued certificates and their PDFs. It must be
+// safe for concurrent use.
+type registryStore interface {
+	Add(r certificateRecord, pdf []byte) error
+	Get(id string) (certificateRecord, error)
+	PDF(id string) ([]byte, error)
+	Find(q certificateQuery) ([]certificateRecord, error)
+
+	// Void marks the certificate id void with v and keeps pdf, its stamped
+	// copy. It fails with errCertificateVoided if the certificate is
+	// already void, so only one of two concurrent calls succeeds.
+	Void(id string, v certificateVoid, pdf []byte) error
+	// Replace voids the certificate id as Void does, links it to r and
+	// adds r with rPDF, all or nothing: if it fails, id stays valid and
+	// can be reissued again.
+	Replace(id string, v certificateVoid, pdf []byte, r certificateRecord, rPDF []byte) error
+	// VoidPDF returns the stamped copy of a void certificate.
+	VoidPDF(id string) ([]byte, error)
+}
+
+// dirRegistryStore keeps each certificate as <id>.json and <id>.pdf in a
+// directory, and the stamped copy of a void one as <id>.void.pdf. Find
+// reads every record, so it suits a modest number of certificates; use the
+// SQLite store beyond that. Voiding is serialised within the process only,
+// so the directory must not be shared between servers. Replace adds the
+// replacement before it voids the original, and removes it again if
+// voiding fails.
+type dirRegistryStore struct {
+	dir string
+	mu  *sync.Mutex // serialises Void
+}
+
+func openDirRegistryStore(dir string) (dirRegistryStore, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return dirRegistryStore{}, fmt.Errorf("registry %s: %w", dir, err)
+	}
+	return dirRegistryStore{dir: dir, mu: new(sync.Mutex)}, nil
+}
+
+// path returns the file of id with ext. Ids are generated hex strings;
+// anything else is refused so that the path cannot leave dir.
+func (s dirRegistryStore) path(id, ext string) (string, error) {
+	if id == "" || strings.Trim(id, "0123456789abcdef") != "" {
+		return "", errCertificateNotFound
+	}
+	return filepath.Join(s.dir, id+ext), nil
+}
+
+func (s dirRegistryStore) Add(r certificateRecord, pdf []byte) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	// The PDF goes first: a record is listed once its JSON file exists.
+	for _, f := range []struct {
+		ext  string
+		data []byte
+	}{{".pdf", pdf}, {".json", data}} {
+		path, err := s.path(r.ID, f.ext)
+		if err != nil {
+			return err
+		}
+		if err := writeFileAtomic(path, f.data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s dirRegistryStore) Get(id string) (certificateRecord, error) {
+	path, err := s.path(id, ".json")
+	if err != nil {
+		return certificateRecord{}, err
+	}
+	return readCertificateRecord(path)
+}
+
+func (s dirRegistryStore) PDF(id string) ([]byte, error) {
+	return s.readPDF(id, ".pdf")
+}
+
+func (s dirRegistryStore) VoidPDF(id string) ([]byte, error) {
+	return s.readPDF(id, ".void.pdf")
+}
+
+func (s dirRegistryStore) readPDF(id, ext string) ([]byte, error) {
+	path, err := s.path(id, ext)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, errCertificateNotFound
+	}
+	return data, err
+}
+
+func (s dirRegistryStore) Void(id string, v certificateVoid, pdf []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.void(id, v, "", pdf)
+}
+
+func (s dirRegistryStore) Replace(id string, v certificateVoid, pdf []byte, r certificateRecord, rPDF []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	original, err := s.Get(id)
+	if err != nil {
+		return err
+	}
+	if original.Void != nil {
+		return errCertificateVoided
+	}
+	if err := s.Add(r, rPDF); err != nil {
+		s.remove(r.ID)
+		return err
+	}
+	if err := s.void(id, v, r.ID, pdf); err != nil {
+		s.remove(r.ID)
+		return err
+	}
+	return nil
+}
+
+// remove deletes the files of a certificate added by a failed Replace.
+func (s dirRegistryStore) remove(id string) {
+	for _, ext := range []string{".json", ".pdf"} {
+		if path, err := s.path(id, ext); err == nil {
+			os.Remove(path)
+		}
+	}
+}
+
+// void does the work of Void and Replace; s.mu must be held.
+func (s dirRegistryStore) void(id string, v certificateVoid, replacedBy string, pdf []byte) error {
+	r, err := s.Get(id)
+	if err != nil {
+		return err
+	}
+	if r.Void != nil {
+		return errCertificateVoided
+	}
+	r.Void = &v
+	r.ReplacedBy = replacedBy
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	// As in Add, the PDF goes first: the record says where to find it.
+	pdfPath, _ := s.path(id, ".void.pdf")
+	if err := writeFileAtomic(pdfPath, pdf); err != nil {
+		return err
+	}
+	jsonPath, _ := s.path(id, ".json")
+	return writeFileAtomic(jsonPath, data)
+}
+
+func (s dirRegistryStore) Find(q certificateQuery) ([]certificateRecord, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var records []certificateRecord
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".json" {
+			continue
+		}
+		r, err := readCertificateRecord(filepath.Join(s.dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if q.matches(r) {
+			records = append(records, r)
+		}
+	}
+	slices.SortFunc(records, func(a, b certificateRecord) int {
+		if c := b.IssuedAt.Compare(a.IssuedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(b.ID, a.ID)
+	})
+	if q.Offset >= len(records) {
+		return nil, nil
+	}
+	records = records[q.Offset:]
+	if q.Limit > 0 && len(records) > q.Limit {
+		records = records[:q.Limit]
+	}
+	return records, nil
+}
+
+func readCertificateRecord(path string) (certificateRecord, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return certificateRecord{}, errCertificateNotFound
+	}
+	if err != nil {
+		return certificateRecord{}, err
+	}
+	var r certificateRecord
+	if err := json.Unmarshal(data, &r); err != nil {
+		return certificateRecord{}, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	return r, nil
+}
+
+// writeFileAtomic writes data to path through a temporary file, so a reader
+// never sees half a file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// sqliteRegistryStore keeps the registry in a SQLite database, with the
+// queried fields in indexed columns and the record itself as JSON.
+type sqliteRegistryStore struct {
+	db *sql.DB
+}
+
+func openSQLiteRegistryStore(path string) (*sqliteRegistryStore, error) {
+	// busy_timeout: other servers may be writing to the same file. The
+	// transactions are writes, so they take the write lock when they begin
+	// rather than fail to upgrade a read lock another server also holds.
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)&_txlock=immediate")
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	s := &sqliteRegistryStore{db: db}
+	if err := s.init(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("registry %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// init creates the tables. The stamped copies of void certificates have a
+// table of their own, so that registries created before voiding existed
+// need no migration.
+func (s *sqliteRegistryStore) init() error {
+	_, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS certificates (
+		id              TEXT PRIMARY KEY,
+		payer_tax_id    TEXT NOT NULL,
+		payee_tax_id    TEXT NOT NULL,
+		tax_year        TEXT NOT NULL,
+		document_number TEXT NOT NULL,
+		issued_at       INTEGER NOT NULL,
+		data            TEXT NOT NULL,
+		pdf             BLOB NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS certificates_payer ON certificates (payer_tax_id, tax_year);
+	CREATE INDEX IF NOT EXISTS certificates_payee ON certificates (payee_tax_id, tax_year);
+	CREATE INDEX IF NOT EXISTS certificates_document ON certificates (document_number);
+	CREATE TABLE IF NOT EXISTS void_pdfs (
+		id  TEXT PRIMARY KEY REFERENCES certificates (id),
+		pdf BLOB NOT NULL
+	)`)
+	return err
+}
+
+func (s *sqliteRegistryStore) Add(r certificateRecord, pdf []byte) error {
+	return insertCertificate(s.db, r, pdf)
+}
+
+// sqlExecer is a *sql.DB or a *sql.Tx.
+type sqlExecer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+func insertCertificate(db sqlExecer, r certificateRecord, pdf []byte) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`INSERT INTO certificates (id, payer_tax_id, payee_tax_id, tax_year, document_number, issued_at, data, pdf)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.ID, r.PayerTaxID, r.PayeeTaxID, r.TaxYear, r.DocumentNumber, r.IssuedAt.UnixNano(), string(data), pdf)
+	return err
+}
+
+func (s *sqliteRegistryStore) Get(id string) (certificateRecord, error) {
+	var data string
+	err := s.db.QueryRow(`SELECT data FROM certificates WHERE id = ?`, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return certificateRecord{}, errCertificateNotFound
+	}
+	if err != nil {
+		return certificateRecord{}, err
+	}
+	var r certificateRecord
+	return r, json.Unmarshal([]byte(data), &r)
+}
+
+func (s *sqliteRegistryStore) PDF(id string) ([]byte, error) {
+	var pdf []byte
+	err := s.db.QueryRow(`SELECT pdf FROM certificates WHERE id = ?`, id).Scan(&pdf)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errCertificateNotFound
+	}
+	return pdf, err
+}
+
+func (s *sqliteRegistryStore) VoidPDF(id string) ([]byte, error) {
+	var pdf []byte
+	err := s.db.QueryRow(`SELECT pdf FROM void_pdfs WHERE id = ?`, id).Scan(&pdf)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errCertificateNotFound
+	}
+	return pdf, err
+}
+
+func (s *sqliteRegistryStore) Void(id string, v certificateVoid, pdf []byte) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := voidCertificateTx(tx, id, v, "", pdf); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Replace voids and adds in one transaction.
+func (s *sqliteRegistryStore) Replace(id string, v certificateVoid, pdf []byte, r certificateRecord, rPDF []byte) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := voidCertificateTx(tx, id, v, r.ID, pdf); err != nil {
+		return err
+	}
+	if err := insertCertificate(tx, r, rPDF); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// voidCertificateTx does the work of Void and Replace within tx.
+func voidCertificateTx(tx *sql.Tx, id string, v certificateVoid, replacedBy string, pdf []byte) error {
+	var old string
+	err := tx.QueryRow(`SELECT data FROM certificates WHERE id = ?`, id).Scan(&old)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errCertificateNotFound
+	}
+	if err != nil {
+		return err
+	}
+	var r certificateRecord
+	if err := json.Unmarshal([]byte(old), &r); err != nil {
+		return err
+	}
+	if r.Void != nil {
+		return errCertificateVoided
+	}
+	r.Void = &v
+	r.ReplacedBy = replacedBy
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	// Matching the old data makes the update conditional, also for another
+	// server sharing the file.
+	res, err := tx.Exec(`UPDATE certificates SET data = ? WHERE id = ? AND data = ?`, string(data), id, old)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n != 1 {
+		return cmp.Or(err, errCertificateVoided)
+	}
+	_, err = tx.Exec(`INSERT INTO void_pdfs (id, pdf) VALUES (?, ?)`, id, pdf)
+	return err
+}
+
+func (s *sqliteRegistryStore) Find(q certificateQuery) ([]certificateRecord, error) {
+	query := `SELECT data FROM certificates WHERE 1 = 1`
+	var args []any
+	for _, f := range []struct{ column, value string }{
+		{"payer_tax_id", q.PayerTaxID},
+		{"payee_tax_id", q.PayeeTaxID},
+		{"tax_year", q.TaxYear},
+		{"document_number", q.DocumentNumber},
+	} {
+		if f.value != "" {
+			query += " AND " + f.column + " = ?"
+			args = append(args, f.value)
+		}
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = -1 // no limit
+	}
+	query += ` ORDER BY issued_at DESC, id DESC LIMIT ? OFFSET ?`
+	args = append(args, limit, q.Offset)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var records []certificateRecord
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var r certificateRecord
+		if err := json.Unmarshal([]byte(data), &r); err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
@@ -0,0 +1,185 @@
+package main
+
+// ── Void and reissue ─────────────────────────────────────────────────────────
+//
+// POST /api/v1/certificates/:id/void     {"reason": "..."}                  cancel a certificate
+// POST /api/v1/certificates/:id/reissue  {"reason": "...", "taxInfo": {...}} cancel it and issue the corrected one
+//
+// A certificate with a mistake is not changed: it is voided, and a
+// corrected certificate is issued under a new document number. Voiding
+// keeps the record and the PDF as issued, and adds a copy stamped ยกเลิก
+// with the reason and date, which GET /api/v1/certificates/:id/pdf returns
+// from then on. The copy is drawn from the recorded TaxInfo, which has no
+// images, so it carries no signature or seal.
+//
+// Reissue takes the corrected TaxInfo as POST /api/v1/taxes does, in JSON;
+// its images may come from base64, url, asset or payer sources. The payer
+// must stay the same. An empty documentNumber is filled in by numbering.go;
+// otherwise it must differ from the original's. The response is the new
+// PDF, whose metadata (pdf50tawi.WithReplaces) names the certificate it
+// replaces, with the new id in X-Certificate-ID. In the registry the
+// original's replacedBy and the replacement's replaces link the two.
+//
+// curl -X POST http://localhost:8080/api/v1/certificates/3f2a.../reissue \
+//   -H 'Content-Type: application/json' \
+//   -d '{"reason": "ชื่อผู้ถูกหักภาษีไม่ถูกต้อง", "taxInfo": {...}}' \
+//   -o certificate.pdf
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/AnuchitO/pdf50tawi"
+	"github.com/labstack/echo/v4"
+)
+
+// maxVoidReason bounds the reason, which is printed under the stamp.
+const maxVoidReason = 200
+
+// reissueBody is the JSON body of /void and /reissue; /void reads only the
+// reason.
+type reissueBody struct {
+	Reason  string            `json:"reason"`
+	TaxInfo pdf50tawi.TaxInfo `json:"taxInfo"`
+}
+
+func handleVoidCertificate(c echo.Context) error {
+	original, body, err := parseReissueRequest(c)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	v, stamped, err := voidCertificate(c, original, body.Reason)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	if err := registry.Void(original.ID, v, stamped); err != nil {
+		return errorJSON(c, registryError(err))
+	}
+	original.Void = &v
+	return c.JSON(http.StatusOK, original)
+}
+
+func handleReissueCertificate(c echo.Context) error {
+	original, body, err := parseReissueRequest(c)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	taxInfo := body.TaxInfo
+	if err := authorizePayers(c, taxInfo); err != nil {
+		return errorJSON(c, err)
+	}
+	if err := validateTaxInfo(opIssue, taxInfo); err != nil {
+		return c.JSON(http.StatusBadRequest, errResp(err.Error()))
+	}
+	req := &certificateRequest{TaxInfo: taxInfo}
+	sign, seal, err := req.images(c.Request().Context())
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	// The replacement is checked before it takes a number, so a refused
+	// one uses none up; a documentNumber left to numbering is checked
+	// again once it is assigned.
+	toNumber := numbering != nil && numbering.DocumentFormat != "" && taxInfo.DocumentDetails.DocumentNumber == ""
+	if err := checkReplacement(original.TaxInfo, taxInfo, toNumber); err != nil {
+		return errorJSON(c, err)
+	}
+	if err := assignResponseNumbers(c, &taxInfo); err != nil {
+		return errorJSON(c, err)
+	}
+	if toNumber {
+		if err := checkReplacement(original.TaxInfo, taxInfo, false); err != nil {
+			return errorJSON(c, err)
+		}
+	}
+
+	replaces := pdf50tawi.ReplacesCertificate(original.TaxInfo, body.Reason)
+	replaces.ID = original.ID
+	var buf bytes.Buffer
+	if err := issuePDF(opIssue, &buf, taxInfo, sign, seal, pdf50tawi.WithReplaces(replaces)); err != nil {
+		return c.JSON(http.StatusInternalServerError, errResp("generate certificate: "+err.Error()))
+	}
+	v, stamped, err := voidCertificate(c, original, body.Reason)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+
+	// Replace voids the original and records the replacement together,
+	// so of two reissues of one certificate the loser gets 409 and
+	// records nothing, and a failure leaves the original to reissue again.
+	r := newCertificateRecord(callerName(c), taxInfo, buf.Bytes())
+	r.Replaces = original.ID
+	if err := registry.Replace(original.ID, v, stamped, r, buf.Bytes()); err != nil {
+		return errorJSON(c, registryError(err))
+	}
+	c.Response().Header().Set(headerCertificateID, r.ID)
+	c.Response().Header().Set("Content-Disposition", "attachment; filename=certificate.pdf")
+	return c.Stream(http.StatusOK, "application/pdf", &buf)
+}
+
+// checkReplacement is pdf50tawi.CheckReplacement as a 400 response. With
+// toNumber, the empty documentNumber that numbering is to fill in passes.
+func checkReplacement(original, replacement pdf50tawi.TaxInfo, toNumber bool) error {
+	err := pdf50tawi.CheckReplacement(original, replacement)
+	switch {
+	case err == nil, toNumber && errors.Is(err, pdf50tawi.ErrSameDocumentNumber):
+		return nil
+	case errors.Is(err, pdf50tawi.ErrSameDocumentNumber) && numbering == nil:
+		return badRequest(err.Error() + ": give a new documentNumber, or set NUMBERING_DOCUMENT_FORMAT to have one assigned")
+	}
+	return badRequest(err.Error())
+}
+
+// parseReissueRequest returns the certificate named in the path, which must
+// not be void yet, and the request body with a valid reason.
+func parseReissueRequest(c echo.Context) (certificateRecord, reissueBody, error) {
+	original, err := callerCertificate(c)
+	if err != nil {
+		return certificateRecord{}, reissueBody{}, err
+	}
+	if original.Void != nil {
+		return certificateRecord{}, reissueBody{}, registryError(errCertificateVoided)
+	}
+	mediaType, _, _ := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+	if mediaType != echo.MIMEApplicationJSON {
+		return certificateRecord{}, reissueBody{}, &apiError{http.StatusUnsupportedMediaType, "Content-Type must be application/json"}
+	}
+	var body reissueBody
+	if err := json.NewDecoder(c.Request().Body).Decode(&body); err != nil {
+		return certificateRecord{}, reissueBody{}, badRequest("invalid JSON body: " + err.Error())
+	}
+	body.Reason = strings.TrimSpace(body.Reason)
+	if body.Reason == "" {
+		return certificateRecord{}, reissueBody{}, badRequest("reason is required")
+	}
+	if utf8.RuneCountInString(body.Reason) > maxVoidReason {
+		return certificateRecord{}, reissueBody{}, badRequest("reason must be at most 200 characters")
+	}
+	return original, body, nil
+}
+
+// voidCertificate renders the copy of original stamped ยกเลิก for reason
+// and returns it with the void to record.
+func voidCertificate(c echo.Context, original certificateRecord, reason string) (certificateVoid, []byte, error) {
+	now := time.Now()
+	stamp := pdf50tawi.VoidWatermark(reason, pdf50tawi.ThaiDate(now.In(pdf50tawi.Thailand)))
+	var buf bytes.Buffer
+	if err := issuePDF(opVoid, &buf, original.TaxInfo, nil, nil, pdf50tawi.WithWatermark(stamp), pdf50tawi.WithMetadata()); err != nil {
+		return certificateVoid{}, nil, err
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	return certificateVoid{
+		Reason:    reason,
+		VoidedAt:  now.UTC(),
+		VoidedBy:  callerName(c),
+		PDFSHA256: hex.EncodeToString(sum[:]),
+		PDFSize:   buf.Len(),
+	}, buf.Bytes(), nil
+}
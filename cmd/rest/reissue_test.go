@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/AnuchitO/pdf50tawi"
+)
+
+func TestReissueRoutes(t *testing.T) {
+	store, err := openDirRegistryStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry = store
+	numbering = &pdf50tawi.Numbering{DocumentFormat: "{seq:04}", Store: pdf50tawi.NewMemorySequenceStore()}
+	a, err := newAuthenticator(authConfig{APIKeys: []apiKeyConfig{
+		{Name: "acme", Key: "acme-key", Payers: []string{"1234567890123"}},
+		{Name: "other", Key: "other-key", Payers: []string{"0105559876543"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth = a
+	t.Cleanup(func() { registry, numbering, auth = nil, nil, nil })
+	e := newServer()
+
+	do := func(method, target, key, contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("X-API-Key", key)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	post := func(target, body string) *httptest.ResponseRecorder {
+		return do(http.MethodPost, target, "acme-key", "application/json", body)
+	}
+	get := func(t *testing.T, id string) certificateRecord {
+		t.Helper()
+		rec := do(http.MethodGet, "/api/v1/certificates/"+id, "acme-key", "", "")
+		var r certificateRecord
+		if err := json.Unmarshal(rec.Body.Bytes(), &r); err != nil || rec.Code != http.StatusOK {
+			t.Fatalf("get %s: status %d, %v", id, rec.Code, err)
+		}
+		return r
+	}
+
+	taxInfo := `{"payer": {"taxId": "1234567890123", "name": "บริษัท ตัวอย่าง จำกัด"},
+		"payee": {"taxId": "3101234567890", "name": "นาย ก", "pnd_3": true},
+		"withholdingType": {"withholdingTax": true},
+		"certification": {"dateOfIssuance": {"day": "31", "month": "มกราคม", "year": "2568"}}}`
+	issued := post("/api/v1/taxes", `{"taxInfo": `+taxInfo+`}`)
+	if issued.Code != http.StatusOK {
+		t.Fatalf("issue: status %d: %s", issued.Code, issued.Body)
+	}
+	id := issued.Header().Get("X-Certificate-ID")
+	corrected := strings.Replace(taxInfo, "นาย ก", "นาย ข", 1)
+
+	for _, tc := range []struct {
+		name, target, key, contentType, body string
+		want                                 int
+	}{
+		{"OtherPayer", "/void", "other-key", "application/json", `{"reason": "ผิด"}`, http.StatusNotFound},
+		{"NoReason", "/void", "acme-key", "application/json", `{"reason": " "}`, http.StatusBadRequest},
+		{"NotJSON", "/void", "acme-key", "text/plain", `ผิด`, http.StatusUnsupportedMediaType},
+		{"SameNumber", "/reissue", "acme-key", "application/json",
+			`{"reason": "ผิด", "taxInfo": ` + strings.Replace(corrected, `"payer": {`, `"documentDetails": {"documentNumber": "0001"}, "payer": {`, 1) + `}`, http.StatusBadRequest},
+		{"ChangedPayer", "/reissue", "acme-key", "application/json",
+			`{"reason": "ผิด", "taxInfo": ` + strings.Replace(corrected, "1234567890123", "0105559876543", 1) + `}`, http.StatusForbidden},
+		// Refused by CheckReplacement, before numbering: the reissue
+		// below still gets 0002.
+		{"ChangedPayerTaxID10Digit", "/reissue", "acme-key", "application/json",
+			`{"reason": "ผิด", "taxInfo": ` + strings.Replace(corrected, `"taxId": "1234567890123"`, `"taxId": "1234567890123", "taxId10Digit": "1234567890"`, 1) + `}`, http.StatusBadRequest},
+		{"Invalid", "/reissue", "acme-key", "application/json", `{"reason": "ผิด", "taxInfo": {"payer": {"taxId": "1234567890123"}}}`, http.StatusBadRequest},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := do(http.MethodPost, "/api/v1/certificates/"+id+tc.target, tc.key, tc.contentType, tc.body)
+			if rec.Code != tc.want {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tc.want, rec.Body)
+			}
+		})
+	}
+	if get(t, id).Void != nil {
+		t.Fatal("a refused request voided the certificate")
+	}
+
+	// A registry that fails to record the replacement leaves the
+	// original valid, to be reissued again.
+	registry = failingRegistry{store}
+	numbered := strings.Replace(corrected, `"payer": {`, `"documentDetails": {"documentNumber": "0100"}, "payer": {`, 1)
+	if rec := post("/api/v1/certificates/"+id+"/reissue", `{"reason": "ชื่อผิด", "taxInfo": `+numbered+`}`); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("reissue with a failing registry: status %d: %s", rec.Code, rec.Body)
+	}
+	registry = store
+	if get(t, id).Void != nil {
+		t.Fatal("a failed reissue voided the certificate")
+	}
+
+	reissued := post("/api/v1/certificates/"+id+"/reissue", `{"reason": "ชื่อผิด", "taxInfo": `+corrected+`}`)
+	if reissued.Code != http.StatusOK {
+		t.Fatalf("reissue: status %d: %s", reissued.Code, reissued.Body)
+	}
+	newID := reissued.Header().Get("X-Certificate-ID")
+	if doc := reissued.Header().Get("X-Document-Number"); newID == "" || newID == id || doc != "0002" {
+		t.Fatalf("replacement %q numbered %q", newID, doc)
+	}
+	m, err := pdf50tawi.ReadMetadata(bytes.NewReader(reissued.Body.Bytes()), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (pdf50tawi.Replaces{ID: id, DocumentNumber: "0001", Reason: "ชื่อผิด"}); m.Replaces == nil || *m.Replaces != want {
+		t.Fatalf("metadata replaces %+v, want %+v", m.Replaces, want)
+	}
+
+	original, replacement := get(t, id), get(t, newID)
+	if original.Void == nil || original.Void.Reason != "ชื่อผิด" || original.Void.VoidedBy != "acme" || original.ReplacedBy != newID {
+		t.Fatalf("original %+v, void %+v", original, original.Void)
+	}
+	if replacement.Replaces != id || replacement.Void != nil || replacement.TaxInfo.Payee.Name != "นาย ข" {
+		t.Fatalf("replacement %+v", replacement)
+	}
+
+	stamped := do(http.MethodGet, "/api/v1/certificates/"+id+"/pdf", "acme-key", "", "")
+	if stamped.Code != http.StatusOK || stamped.Body.String() == issued.Body.String() || stamped.Body.Len() != original.Void.PDFSize {
+		t.Fatalf("stamped copy: status %d, %d bytes", stamped.Code, stamped.Body.Len())
+	}
+	asIssued := do(http.MethodGet, "/api/v1/certificates/"+id+"/pdf?copy=original", "acme-key", "", "")
+	if asIssued.Body.String() != issued.Body.String() {
+		t.Fatal("?copy=original is not the PDF as issued")
+	}
+
+	if rec := post("/api/v1/certificates/"+id+"/reissue", `{"reason": "ชื่อผิด", "taxInfo": `+corrected+`}`); rec.Code != http.StatusConflict {
+		t.Fatalf("reissue of a void certificate: status %d", rec.Code)
+	}
+	if rec := post("/api/v1/certificates/"+id+"/void", `{"reason": "ชื่อผิด"}`); rec.Code != http.StatusConflict {
+		t.Fatalf("void of a void certificate: status %d", rec.Code)
+	}
+
+	voided := post("/api/v1/certificates/"+newID+"/void", `{"reason": "ออกซ้ำ"}`)
+	var r certificateRecord
+	if err := json.Unmarshal(voided.Body.Bytes(), &r); err != nil || voided.Code != http.StatusOK {
+		t.Fatalf("void: status %d, %v", voided.Code, err)
+	}
+	if r.Void == nil || r.Void.Reason != "ออกซ้ำ" || r.ReplacedBy != "" || r.Replaces != id {
+		t.Fatalf("voided %+v", r)
+	}
+}
+
+// failingRegistry cannot record new certificates.
+type failingRegistry struct{ registryStore }
+
+func (failingRegistry) Add(certificateRecord, []byte) error {
+	return errors.New("disk full")
+}
+
+func (failingRegistry) Replace(string, certificateVoid, []byte, certificateRecord, []byte) error {
+	return errors.New("disk full")
+}
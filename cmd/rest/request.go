@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"github.com/AnuchitO/pdf50tawi"
+	"github.com/labstack/echo/v4"
+)
+
+// requestBody is the JSON body of /api/v1/taxes, /validate and /preview.
+// The Strategy B image fields are still accepted, so preview requests
+// written for the original preview endpoint keep working; they stand in for
+// certification image sources of type base64.
+type requestBody struct {
+	TaxInfo         pdf50tawi.TaxInfo `json:"taxInfo"`
+	SignatureBase64 string            `json:"signatureBase64,omitempty"`
+	SealBase64      string            `json:"sealBase64,omitempty"`
+}
+
+// certificateRequest is a parsed request body: JSON, or multipart/form-data
+// with the TaxInfo JSON in the taxInfo field.
+type certificateRequest struct {
+	TaxInfo pdf50tawi.TaxInfo
+	form    *multipart.Form // holds the upload parts; nil for JSON
+}
+
+// apiError is an error response with its HTTP status.
+type apiError struct {
+	status int
+	msg    string
+}
+
+func (e *apiError) Error() string { return e.msg }
+
+func badRequest(msg string) *apiError { return &apiError{http.StatusBadRequest, msg} }
+
+// errorJSON writes err as the JSON error envelope; errors that are not an
+// *apiError are server errors.
+func errorJSON(c echo.Context, err error) error {
+	var ae *apiError
+	if errors.As(err, &ae) {
+		return c.JSON(ae.status, errResp(ae.msg))
+	}
+	return c.JSON(http.StatusInternalServerError, errResp(err.Error()))
+}
+
+// parseRequest reads the body of c. The caller must Close the request.
+func parseRequest(c echo.Context) (*certificateRequest, error) {
+	mediaType, _, _ := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+	switch mediaType {
+	case echo.MIMEMultipartForm:
+		form, err := c.MultipartForm()
+		if err != nil {
+			return nil, badRequest("parse multipart form: " + err.Error())
+		}
+		taxInfo, err := parseTaxInfoFromForm(form)
+		if err != nil {
+			form.RemoveAll()
+			return nil, badRequest(err.Error())
+		}
+		return &certificateRequest{TaxInfo: taxInfo, form: form}, nil
+	case echo.MIMEApplicationJSON:
+		var body requestBody
+		if err := json.NewDecoder(c.Request().Body).Decode(&body); err != nil {
+			return nil, badRequest("invalid JSON body: " + err.Error())
+		}
+		cert := &body.TaxInfo.Certification
+		if cert.PayerSignatureImage == nil && body.SignatureBase64 != "" {
+			cert.PayerSignatureImage = &pdf50tawi.ImageSource{SourceType: pdf50tawi.ImageSourceBase64, Value: body.SignatureBase64}
+		}
+		if cert.CompanySealImage == nil && body.SealBase64 != "" {
+			cert.CompanySealImage = &pdf50tawi.ImageSource{SourceType: pdf50tawi.ImageSourceBase64, Value: body.SealBase64}
+		}
+		return &certificateRequest{TaxInfo: body.TaxInfo}, nil
+	}
+	return nil, &apiError{http.StatusUnsupportedMediaType, "Content-Type must be application/json or multipart/form-data"}
+}
+
+// Close removes the temporary files of uploaded parts.
+func (r *certificateRequest) Close() {
+	if r.form != nil {
+		r.form.RemoveAll()
+	}
+}
+
+// images loads the signature and seal the certification refers to.
+func (r *certificateRequest) images(ctx context.Context) (sign, seal io.Reader, err error) {
+	cert := r.TaxInfo.Certification
+	if sign, err = resolveImage(ctx, cert.PayerSignatureImage, r.upload(), r.TaxInfo.Payer.TaxID); err != nil {
+		return nil, nil, badRequest("certification.payerSignatureImage: " + err.Error())
+	}
+	if seal, err = resolveImage(ctx, cert.CompanySealImage, r.upload(), r.TaxInfo.Payer.TaxID); err != nil {
+		return nil, nil, badRequest("certification.companySealImage: " + err.Error())
+	}
+	return sign, seal, nil
+}
+
+// uploadFunc returns the image uploaded in the named multipart part, or nil
+// when there is no such part.
+type uploadFunc func(part string) (io.Reader, error)
+
+// upload returns the uploaded parts of a multipart request, nil for JSON.
+func (r *certificateRequest) upload() uploadFunc {
+	if r.form == nil {
+		return nil
+	}
+	return func(part string) (io.Reader, error) { return readFormFile(r.form, part) }
+}
+
+// resolveImage loads the image src refers to; a nil src means no image.
+// Upload sources are looked up with upload, which is nil when the request
+// had no multipart body, and payer sources under payerTaxID.
+func resolveImage(ctx context.Context, src *pdf50tawi.ImageSource, upload uploadFunc, payerTaxID string) (io.Reader, error) {
+	if src == nil {
+		return nil, nil
+	}
+	switch src.SourceType {
+	case pdf50tawi.ImageSourceUpload:
+		if upload == nil {
+			return nil, errors.New("upload sources need a multipart/form-data request")
+		}
+		img, err := upload(src.Value)
+		if err == nil && img == nil {
+			err = fmt.Errorf("missing file part '%s'", src.Value)
+		}
+		return img, err
+	case pdf50tawi.ImageSourceBase64:
+		return decodeBase64Image(src.Value)
+	case pdf50tawi.ImageSourceURL:
+		return fetchImage(ctx, src.Value)
+	case pdf50tawi.ImageSourceAsset:
+		if assets == nil {
+			return nil, errors.New("asset sources are not enabled on this server (set ASSET_DIR)")
+		}
+		img, err := assets.Open(src.Value)
+		if err != nil {
+			return nil, fmt.Errorf("asset %q: %w", src.Value, err)
+		}
+		return pdf50tawi.CheckImage(img, pdf50tawi.DefaultImageLimits)
+	case pdf50tawi.ImageSourcePayer:
+		if payerAssets == nil {
+			return nil, errors.New("payer sources are not enabled on this server (set ASSET_DIR)")
+		}
+		taxID := strings.ReplaceAll(payerTaxID, " ", "")
+		if taxID == "" {
+			return nil, errors.New("payer.taxId is required for payer sources")
+		}
+		data, err := payerAssets.PayerAsset(taxID, src.Value)
+		if errors.Is(err, errAssetNotFound) {
+			return nil, fmt.Errorf("no %s stored for payer %s", src.Value, taxID)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return bytes.NewReader(data), nil
+	}
+	return nil, fmt.Errorf("unknown sourceType %q", src.SourceType)
+}
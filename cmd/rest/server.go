@@ -0,0 +1,139 @@
+package main
+
+// ── Serving, shutdown and health ─────────────────────────────────────────────
+//
+// GET /healthz  200 while the process is up (liveness)
+// GET /readyz   200 once the template and font load, 503 while shutting down (readiness)
+//
+// On SIGTERM or SIGINT /readyz starts answering 503. After SHUTDOWN_DELAY
+// the server stops accepting connections and waits up to SHUTDOWN_TIMEOUT
+// for the requests in flight and the running jobs to finish; jobs still
+// running then are canceled.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/AnuchitO/pdf50tawi"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// shuttingDown is set once the server has been asked to stop.
+var shuttingDown atomic.Bool
+
+// serve runs the server until it receives SIGTERM or SIGINT, then shuts it
+// down gracefully.
+func serve(cfg serverConfig) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	srv := &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           newServer(),
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       time.Duration(cfg.ReadTimeout),
+		WriteTimeout:      time.Duration(cfg.WriteTimeout),
+		IdleTimeout:       time.Duration(cfg.IdleTimeout),
+	}
+	errc := make(chan error, 1)
+	go func() {
+		if cfg.TLSCertFile != "" {
+			errc <- srv.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+		} else {
+			errc <- srv.ListenAndServe()
+		}
+	}()
+	slog.Info("server started", "addr", cfg.Addr, "tls", cfg.TLSCertFile != "")
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	stop() // a second signal kills the process
+	shuttingDown.Store(true)
+	slog.Info("shutting down", "delay", time.Duration(cfg.ShutdownDelay).String(), "timeout", time.Duration(cfg.ShutdownTimeout).String())
+	time.Sleep(time.Duration(cfg.ShutdownDelay))
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ShutdownTimeout))
+	defer cancel()
+	var errs []error
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		errs = append(errs, fmt.Errorf("drain requests: %w", err))
+	}
+	if jobs != nil {
+		if err := jobs.shutdown(shutdownCtx); err != nil {
+			errs = append(errs, fmt.Errorf("drain jobs: %w", err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	slog.Info("server stopped")
+	return nil
+}
+
+// serverMiddleware returns the middleware that config asks for: CORS for
+// the listed origins and the body limit.
+func serverMiddleware() []echo.MiddlewareFunc {
+	var mw []echo.MiddlewareFunc
+	if len(config.CORSOrigins) > 0 {
+		mw = append(mw, middleware.CORSWithConfig(middleware.CORSConfig{
+			AllowOrigins: config.CORSOrigins,
+			AllowMethods: []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete},
+			AllowHeaders: []string{echo.HeaderAuthorization, echo.HeaderContentType, "X-API-Key", echo.HeaderXRequestID, headerIdempotencyKey},
+			ExposeHeaders: []string{
+				echo.HeaderContentDisposition, echo.HeaderLocation,
+				echo.HeaderXRequestID, echo.HeaderRetryAfter, headerIdempotentReplayed,
+				headerCertificateID, headerBookNumber, headerDocumentNumber,
+			},
+		}))
+	}
+	if config.BodyLimit > 0 {
+		mw = append(mw, limitBody(int64(config.BodyLimit)))
+	}
+	return mw
+}
+
+// limitBody answers 413 to a request declaring a body larger than n bytes,
+// and cuts off a chunked body once it passes n.
+func limitBody(n int64) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			if req.ContentLength > n {
+				return c.JSON(http.StatusRequestEntityTooLarge, errResp(fmt.Sprintf("request body is larger than %d bytes", n)))
+			}
+			req.Body = http.MaxBytesReader(c.Response(), req.Body, n)
+			return next(c)
+		}
+	}
+}
+
+type healthResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+func handleHealthz(c echo.Context) error {
+	return c.JSON(http.StatusOK, healthResponse{Status: "ok"})
+}
+
+func handleReadyz(c echo.Context) error {
+	if shuttingDown.Load() {
+		return c.JSON(http.StatusServiceUnavailable, healthResponse{Status: "unavailable", Error: "shutting down"})
+	}
+	if err := pdf50tawi.CheckResources(); err != nil {
+		return c.JSON(http.StatusServiceUnavailable, healthResponse{Status: "unavailable", Error: err.Error()})
+	}
+	return c.JSON(http.StatusOK, healthResponse{Status: "ready"})
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHealthEndpoints(t *testing.T) {
+	e := newServer()
+	get := func(path string) int {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code
+	}
+	if code := get("/healthz"); code != http.StatusOK {
+		t.Fatalf("/healthz: status %d", code)
+	}
+	if code := get("/readyz"); code != http.StatusOK {
+		t.Fatalf("/readyz: status %d", code)
+	}
+
+	shuttingDown.Store(true)
+	t.Cleanup(func() { shuttingDown.Store(false) })
+	if code := get("/readyz"); code != http.StatusServiceUnavailable {
+		t.Fatalf("/readyz while shutting down: status %d, want 503", code)
+	}
+	if code := get("/healthz"); code != http.StatusOK {
+		t.Fatalf("/healthz while shutting down: status %d", code)
+	}
+}
+
+func TestServerMiddleware(t *testing.T) {
+	config = serverConfig{BodyLimit: 64, CORSOrigins: []string{"https://hr.example.com"}}
+	t.Cleanup(func() { config = serverConfig{} })
+	e := newServer()
+
+	body := `{"taxInfo": {"payer": {"taxId": "1234567890123", "name": "บริษัท ตัวอย่าง จำกัด"}}}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/taxes/validate", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("oversized body: status %d, want 413", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodOptions, "/api/v1/taxes", nil)
+	req.Header.Set("Origin", "https://hr.example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://hr.example.com" {
+		t.Fatalf("preflight: Access-Control-Allow-Origin %q (status %d)", got, rec.Code)
+	}
+	// Header names are case-insensitive; echo sends X-Request-Id.
+	allowed := strings.ToLower(rec.Header().Get("Access-Control-Allow-Headers"))
+	for _, h := range []string{"X-Request-ID", "Idempotency-Key"} {
+		if !strings.Contains(allowed, strings.ToLower(h)) {
+			t.Errorf("preflight: Access-Control-Allow-Headers %q lacks %s", allowed, h)
+		}
+	}
+
+	// A browser script reads only the response headers it is exposed.
+	req = httptest.NewRequest(http.MethodGet, "/healthz", nil)
+	req.Header.Set("Origin", "https://hr.example.com")
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	exposed := strings.ToLower(rec.Header().Get("Access-Control-Expose-Headers"))
+	for _, h := range []string{"Content-Disposition", "Location", "X-Request-ID", "Retry-After", "Idempotent-Replayed", "X-Certificate-ID", "X-Book-Number", "X-Document-Number"} {
+		if !strings.Contains(exposed, strings.ToLower(h)) {
+			t.Errorf("Access-Control-Expose-Headers %q lacks %s", exposed, h)
+		}
+	}
+}
+
+func TestJobManagerShutdown(t *testing.T) {
+	m := newJobManager(newMemoryJobStore(), 1, 10, time.Hour)
+
+	// A running job that only stops once it is canceled.
+	jobCtx, cancel := context.WithCancelCause(context.Background())
+	m.mu.Lock()
+	m.cancels["stuck"] = cancel
+	m.running.Add(1)
+	m.mu.Unlock()
+	go func() {
+		<-jobCtx.Done()
+		m.running.Done()
+	}()
+
+	ctx, cancelShutdown := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancelShutdown()
+	if err := m.shutdown(ctx); err == nil {
+		t.Fatal("expected the deadline error for a job outliving the timeout")
+	}
+	if cause := context.Cause(jobCtx); cause != errShuttingDown {
+		t.Fatalf("job canceled with %v, want errShuttingDown", cause)
+	}
+	if _, err := m.submit(nil, "zip", &batchRequest{}, nil, nil); err != errShuttingDown {
+		t.Fatalf("submit after shutdown: %v, want errShuttingDown", err)
+	}
+}
@@ -0,0 +1,95 @@
+package pdf50tawi
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// buddhistEraOffset converts between พ.ศ. and ค.ศ. years.
+const buddhistEraOffset = 543
+
+// Thailand is the time zone of Thai dates (UTC+7, no daylight saving).
+// Convert a time to it before ThaiDate, e.g. ThaiDate(time.Now().In(Thailand)),
+// so a server running in UTC does not print yesterday's date.
+var Thailand = time.FixedZone("ICT", 7*60*60)
+
+// thaiMonths lists the full and abbreviated Thai month names, January first.
+var thaiMonths = [12][2]string{
+	{"มกราคม", "ม.ค."},
+	{"กุมภาพันธ์", "ก.พ."},
+	{"มีนาคม", "มี.ค."},
+	{"เมษายน", "เม.ย."},
+	{"พฤษภาคม", "พ.ค."},
+	{"มิถุนายน", "มิ.ย."},
+	{"กรกฎาคม", "ก.ค."},
+	{"สิงหาคม", "ส.ค."},
+	{"กันยายน", "ก.ย."},
+	{"ตุลาคม", "ต.ค."},
+	{"พฤศจิกายน", "พ.ย."},
+	{"ธันวาคม", "ธ.ค."},
+}
+
+// Time interprets the date of issuance as a calendar date in UTC.
+//
+// Month may be a full or abbreviated Thai month name ("ธันวาคม", "ธ.ค.") or a
+// number. Years from 2400 onwards are read as พ.ศ. and converted to ค.ศ.
+func (d DateOfIssuance) Time() (time.Time, error) {
+	day, err := strconv.Atoi(strings.TrimSpace(d.Day))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid day %q", d.Day)
+	}
+	month, err := parseMonth(d.Month)
+	if err != nil {
+		return time.Time{}, err
+	}
+	year, err := strconv.Atoi(strings.TrimSpace(d.Year))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid year %q", d.Year)
+	}
+	if year >= 2400 {
+		year -= buddhistEraOffset
+	}
+
+	t := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	if t.Day() != day || t.Month() != month {
+		return time.Time{}, fmt.Errorf("invalid date %s %s %s", d.Day, d.Month, d.Year)
+	}
+	return t, nil
+}
+
+// BuddhistYear returns the พ.ศ. year of the date, e.g. "2568". A year
+// before 2400 is read as ค.ศ. and converted; without a year it is the year
+// of now in Thailand.
+func (d DateOfIssuance) BuddhistYear(now time.Time) string {
+	if y, err := strconv.Atoi(strings.TrimSpace(d.Year)); err == nil && y > 0 {
+		if y < 2400 {
+			y += buddhistEraOffset
+		}
+		return strconv.Itoa(y)
+	}
+	return strconv.Itoa(now.In(Thailand).Year() + buddhistEraOffset)
+}
+
+func parseMonth(s string) (time.Month, error) {
+	s = strings.TrimSpace(s)
+	if n, err := strconv.Atoi(s); err == nil {
+		if n < 1 || n > 12 {
+			return 0, fmt.Errorf("invalid month %q", s)
+		}
+		return time.Month(n), nil
+	}
+	compact := strings.ReplaceAll(s, " ", "")
+	for i, names := range thaiMonths {
+		if compact == names[0] || compact == names[1] || compact == strings.TrimSuffix(names[1], ".") {
+			return time.Month(i + 1), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid month %q", s)
+}
+
+// ThaiDate formats t as a Thai date with a พ.ศ. year, e.g. "5 กุมภาพันธ์ 2568".
+func ThaiDate(t time.Time) string {
+	return fmt.Sprintf("%d %s %d", t.Day(), thaiMonths[t.Month()-1][0], t.Year()+buddhistEraOffset)
+}
@@ -0,0 +1,59 @@
+package pdf50tawi
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDateOfIssuanceTime(t *testing.T) {
+	testCases := []struct {
+		name    string
+		date    DateOfIssuance
+		want    string
+		wantErr bool
+	}{
+		{"ThaiFullMonthBE", DateOfIssuance{Day: "22", Month: "ธันวาคม", Year: "2568"}, "2025-12-22", false},
+		{"ThaiAbbrevMonth", DateOfIssuance{Day: "1", Month: "ม.ค.", Year: "2568"}, "2025-01-01", false},
+		{"ThaiAbbrevNoTrailingDot", DateOfIssuance{Day: "3", Month: "มี.ค", Year: "2568"}, "2025-03-03", false},
+		{"NumericMonthCE", DateOfIssuance{Day: "26", Month: "09", Year: "2025"}, "2025-09-26", false},
+		{"Spaces", DateOfIssuance{Day: " 5 ", Month: " 5 ", Year: " 2568 "}, "2025-05-05", false},
+
+		{"Empty", DateOfIssuance{}, "", true},
+		{"UnknownMonth", DateOfIssuance{Day: "1", Month: "Foo", Year: "2568"}, "", true},
+		{"MonthOutOfRange", DateOfIssuance{Day: "1", Month: "13", Year: "2568"}, "", true},
+		{"DayOutOfRange", DateOfIssuance{Day: "31", Month: "กุมภาพันธ์", Year: "2568"}, "", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := tc.date.Time()
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got.Format("2006-01-02") != tc.want {
+				t.Fatalf("got %s, want %s", got.Format("2006-01-02"), tc.want)
+			}
+		})
+	}
+}
+
+func TestDateOfIssuanceBuddhistYear(t *testing.T) {
+	now := time.Date(2025, 12, 31, 18, 0, 0, 0, time.UTC) // 1 January 2569 in Thailand
+	for year, want := range map[string]string{"2568": "2568", " 2568 ": "2568", "2025": "2568", "": "2569", "พ.ศ.": "2569"} {
+		if got := (DateOfIssuance{Year: year}).BuddhistYear(now); got != want {
+			t.Errorf("BuddhistYear(%q) = %q, want %q", year, got, want)
+		}
+	}
+}
+
+func TestThaiDate(t *testing.T) {
+	if got := ThaiDate(time.Date(2025, time.February, 5, 0, 0, 0, 0, time.UTC)); got != "5 กุมภาพันธ์ 2568" {
+		t.Fatalf("got %q", got)
+	}
+}
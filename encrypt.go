@@ -0,0 +1,90 @@
+package pdf50tawi
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+)
+
+// Encryption protects the certificate with AES-256 so it can be emailed
+// without exposing the payee's national ID (PDPA).
+//
+// Opening the file requires the user password. Printing is allowed; editing,
+// copying and form filling are restricted unless the owner password is given.
+type Encryption struct {
+	// UserPassword is required to open the document.
+	// Ignored when UserPasswordRule is set.
+	UserPassword string
+
+	// UserPasswordRule derives the user password from the certificate data,
+	// e.g. PayeeTaxIDSuffix(4) for "the last 4 digits of the payee tax ID".
+	UserPasswordRule PasswordRule
+
+	// OwnerPassword lifts the editing restrictions. When empty a random
+	// password is generated, so nobody can lift them.
+	OwnerPassword string
+}
+
+// PasswordRule derives a password from the certificate being issued.
+type PasswordRule func(TaxInfo) (string, error)
+
+// WithEncryption encrypts the issued certificate with AES-256.
+func WithEncryption(e Encryption) Option {
+	return func(o *issueOptions) { o.encryption = &e }
+}
+
+// PayeeTaxIDSuffix returns a rule that uses the last n digits of Payee.TaxID
+// (spaces ignored) as the password.
+func PayeeTaxIDSuffix(n int) PasswordRule {
+	return func(t TaxInfo) (string, error) {
+		digits := stripSpaces(t.Payee.TaxID)
+		if n <= 0 || !isDigitsLen(digits, len(digits)) || len(digits) < n {
+			return "", fmt.Errorf("payee.taxId must have at least %d digits to derive a password", n)
+		}
+		return digits[len(digits)-n:], nil
+	}
+}
+
+// passwords resolves the user and owner passwords for taxInfo.
+func (e Encryption) passwords(taxInfo TaxInfo) (user, owner string, err error) {
+	user = e.UserPassword
+	if e.UserPasswordRule != nil {
+		if user, err = e.UserPasswordRule(taxInfo); err != nil {
+			return "", "", fmt.Errorf("derive user password: %w", err)
+		}
+	}
+	if user == "" {
+		return "", "", errors.New("encryption requires a user password")
+	}
+
+	owner = e.OwnerPassword
+	if owner == "" {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return "", "", fmt.Errorf("generate owner password: %w", err)
+		}
+		owner = hex.EncodeToString(b)
+	}
+	return user, owner, nil
+}
+
+// encryptPDF writes an AES-256 encrypted copy of pdf to out.
+func encryptPDF(pdf []byte, out io.Writer, user, owner string) error {
+	conf := pdfcpuConfig()
+	conf.UserPW = user
+	conf.OwnerPW = owner
+	conf.EncryptUsingAES = true
+	conf.EncryptKeyLength = 256
+	conf.Permissions = model.PermissionsPrint
+
+	if err := api.Encrypt(bytes.NewReader(pdf), out, conf); err != nil {
+		return fmt.Errorf("encrypt certificate: %w", err)
+	}
+	return nil
+}
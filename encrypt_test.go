@@ -0,0 +1,79 @@
+package pdf50tawi
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+)
+
+func TestIssueWHTCertificatePDFWithEncryption(t *testing.T) {
+	var out bytes.Buffer
+	enc := Encryption{UserPasswordRule: PayeeTaxIDSuffix(4), OwnerPassword: "owner-secret"}
+	if err := IssueWHTCertificatePDF(&out, sampleTaxInfo(), nil, nil, WithEncryption(enc)); err != nil {
+		t.Fatalf("IssueWHTCertificatePDF error: %v", err)
+	}
+	if !bytes.Contains(out.Bytes(), []byte("/Encrypt")) {
+		t.Fatal("expected an /Encrypt dictionary in the output")
+	}
+
+	t.Run("opens with derived user password", func(t *testing.T) {
+		conf := pdfcpuConfig()
+		conf.UserPW = "0987" // last 4 digits of sampleTaxInfo().Payee.TaxID
+		if err := api.Decrypt(bytes.NewReader(out.Bytes()), io.Discard, conf); err != nil {
+			t.Fatalf("decrypt with user password: %v", err)
+		}
+	})
+
+	t.Run("rejects wrong password", func(t *testing.T) {
+		conf := pdfcpuConfig()
+		conf.UserPW = "1111"
+		if err := api.Decrypt(bytes.NewReader(out.Bytes()), io.Discard, conf); err == nil {
+			t.Fatal("expected decrypt to fail with the wrong password")
+		}
+	})
+}
+
+func TestIssueWHTCertificatePDFWithEncryptionRequiresPassword(t *testing.T) {
+	err := IssueWHTCertificatePDF(io.Discard, sampleTaxInfo(), nil, nil, WithEncryption(Encryption{}))
+	if err == nil {
+		t.Fatal("expected an error when no user password is configured")
+	}
+}
+
+func TestPayeeTaxIDSuffix(t *testing.T) {
+	testCases := []struct {
+		name    string
+		taxID   string
+		n       int
+		want    string
+		wantErr bool
+	}{
+		{"Last4", "9876543210987", 4, "0987", false},
+		{"WithSpaces", "9 8765 43210 98 7", 6, "210987", false},
+		{"WholeID", "9876543210987", 13, "9876543210987", false},
+		{"TooShort", "123", 4, "", true},
+		{"Empty", "", 4, "", true},
+		{"NonDigits", "98765432109a7", 4, "", true},
+		{"ZeroLength", "9876543210987", 0, "", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := PayeeTaxIDSuffix(tc.n)(TaxInfo{Payee: Payee{TaxID: tc.taxID}})
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tc.want {
+				t.Fatalf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -1,6 +1,9 @@
 package pdf50tawi
 
-import "io"
+import (
+	"fmt"
+	"io"
+)
 
 // Anchor represents a reference point on a PDF page for positioning text and images.
 type Anchor int
@@ -38,3 +41,32 @@ type ImageField struct {
 	Diagonal int
 	OnTop    bool
 }
+
+var anchorNames = [...]string{"TopLeft", "TopCenter", "TopRight", "Left", "Center", "Right", "BottomLeft", "BottomCenter", "BottomRight"}
+
+// String returns the anchor name, e.g. "TopLeft".
+func (a Anchor) String() string {
+	if a < 0 || int(a) >= len(anchorNames) {
+		return fmt.Sprintf("Anchor(%d)", int(a))
+	}
+	return anchorNames[a]
+}
+
+// MarshalText encodes the anchor by name, so JSON reads "TopLeft" not 0.
+func (a Anchor) MarshalText() ([]byte, error) {
+	if a < 0 || int(a) >= len(anchorNames) {
+		return nil, fmt.Errorf("invalid anchor %d", int(a))
+	}
+	return []byte(anchorNames[a]), nil
+}
+
+// UnmarshalText decodes an anchor name such as "TopLeft".
+func (a *Anchor) UnmarshalText(text []byte) error {
+	for i, name := range anchorNames {
+		if name == string(text) {
+			*a = Anchor(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown anchor %q", text)
+}
@@ -137,6 +137,6 @@ curl -X POST http://localhost:8080/api/v1/taxes \
     }
   }
 }' \
-  -F "signatureImage=@cmd/demo-cli/demo-signature-1280x720-rectangle.png" \
-  -F "companySeal=@cmd/demo-cli/demo-logo-1024x1024-square.png" \
+  -F "signatureImage=@.demo/demo-signature-1280x720-rectangle.png" \
+  -F "companySeal=@.demo/demo-logo-1024x1024-square.png" \
   --output output.pdf
\ No newline at end of file
@@ -2,6 +2,7 @@ package pdf50tawi
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"image"
 	"image/color"
@@ -9,6 +10,8 @@ import (
 	"io"
 	"net/http"
 	"os"
+
+	"golang.org/x/image/draw"
 )
 
 // emptyPNG is a 1×1 transparent PNG computed once at package init.
@@ -58,7 +61,8 @@ func LoadImageFromMultiPartFile(r *http.Request, field string) (io.Reader, error
 	return bytes.NewReader(buf.Bytes()), nil
 }
 
-// LoadImageFromURL fetches a PNG image from the given URL.
+// LoadImageFromURL fetches a PNG image from the given URL. It applies no
+// restrictions; use ImageFetcher for URLs supplied by clients.
 func LoadImageFromURL(url string) (io.Reader, error) {
 	resp, err := http.Get(url) //nolint:noctx
 	if err != nil {
@@ -100,3 +104,120 @@ func LoadImageFromRequest(req *http.Request) (io.Reader, error) {
 	}
 	return bytes.NewReader(buf.Bytes()), nil
 }
+
+// ImageLimits bounds the images CheckImage accepts. A zero field means no
+// limit.
+type ImageLimits struct {
+	MaxBytes  int64
+	MaxWidth  int
+	MaxHeight int
+}
+
+// DefaultImageLimits is generous for a scanned signature or seal.
+var DefaultImageLimits = ImageLimits{MaxBytes: 5 << 20, MaxWidth: 4096, MaxHeight: 4096}
+
+var (
+	// ErrUnsupportedImage is returned by CheckImage for anything but PNG
+	// and JPEG.
+	ErrUnsupportedImage = errors.New("unsupported image format, want PNG or JPEG")
+	// ErrImageTooLarge is returned by CheckImage for an image over its
+	// ImageLimits.
+	ErrImageTooLarge = errors.New("image too large")
+)
+
+// CheckImage reads the image from r and checks that it is a PNG or JPEG
+// within limits, so a bad upload can be rejected up front instead of
+// failing or rendering blank later. It returns a reader over the same bytes,
+// or nil when r is nil: images are optional.
+func CheckImage(r io.Reader, limits ImageLimits) (io.Reader, error) {
+	if r == nil {
+		return nil, nil
+	}
+	src := r
+	if limits.MaxBytes > 0 {
+		src = io.LimitReader(r, limits.MaxBytes+1)
+	}
+	data, err := io.ReadAll(src)
+	if err != nil {
+		return nil, err
+	}
+	if limits.MaxBytes > 0 && int64(len(data)) > limits.MaxBytes {
+		return nil, fmt.Errorf("%w: more than %d bytes", ErrImageTooLarge, limits.MaxBytes)
+	}
+
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || (format != "png" && format != "jpeg") {
+		if len(data) == 0 {
+			return nil, fmt.Errorf("%w: empty file", ErrUnsupportedImage)
+		}
+		return nil, fmt.Errorf("%w: got %s", ErrUnsupportedImage, http.DetectContentType(data))
+	}
+	if (limits.MaxWidth > 0 && cfg.Width > limits.MaxWidth) || (limits.MaxHeight > 0 && cfg.Height > limits.MaxHeight) {
+		return nil, fmt.Errorf("%w: %d×%d pixels, at most %d×%d", ErrImageTooLarge, cfg.Width, cfg.Height, limits.MaxWidth, limits.MaxHeight)
+	}
+	return bytes.NewReader(data), nil
+}
+
+// NormalizeImage decodes a PNG or JPEG image, as accepted by CheckImage with
+// limits, and re-encodes it as PNG scaled down to fit within maxWidth ×
+// maxHeight pixels (a zero bound means none). Metadata is dropped and smaller
+// images are not enlarged, so images stored for later use are uniform.
+func NormalizeImage(r io.Reader, limits ImageLimits, maxWidth, maxHeight int) ([]byte, error) {
+	checked, err := CheckImage(r, limits)
+	if err != nil {
+		return nil, err
+	}
+	if checked == nil {
+		return nil, fmt.Errorf("%w: no image", ErrUnsupportedImage)
+	}
+	img, _, err := image.Decode(checked)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedImage, err)
+	}
+
+	b := img.Bounds()
+	scale := 1.0
+	if maxWidth > 0 && b.Dx() > maxWidth {
+		scale = float64(maxWidth) / float64(b.Dx())
+	}
+	if maxHeight > 0 && float64(b.Dy())*scale > float64(maxHeight) {
+		scale = float64(maxHeight) / float64(b.Dy())
+	}
+	if scale < 1 {
+		w, h := max(1, int(float64(b.Dx())*scale+0.5)), max(1, int(float64(b.Dy())*scale+0.5))
+		dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+		draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+		img = dst
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Source types of ImageSource.
+const (
+	ImageSourceUpload = "upload" // Value names a multipart part of the request
+	ImageSourceBase64 = "base64" // Value is the base64-encoded image
+	ImageSourceURL    = "url"    // Value is a URL the server fetches
+	ImageSourceAsset  = "asset"  // Value is the id of an image stored on the server
+	ImageSourcePayer  = "payer"  // Value is PayerAssetSignature or PayerAssetSeal, stored on the server for the payer's tax ID
+)
+
+// Kinds of image the REST API stores per payer, the values of an
+// ImageSourcePayer source.
+const (
+	PayerAssetSignature = "signature"
+	PayerAssetSeal      = "seal"
+)
+
+// withoutImageSources returns t with the certification image sources removed.
+// They say how the images were supplied, not what the certificate shows, so
+// they are left out of the verification hash and the embedded metadata.
+func (t TaxInfo) withoutImageSources() TaxInfo {
+	t.Certification.PayerSignatureImage = nil
+	t.Certification.CompanySealImage = nil
+	return t
+}
@@ -0,0 +1,186 @@
+package pdf50tawi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenURL is returned by ImageFetcher for a URL it refuses to fetch:
+// a scheme other than http or https, a host outside AllowedHosts or an
+// address on a private network.
+var ErrForbiddenURL = errors.New("image URL not allowed")
+
+// ImageFetcher downloads signature and seal images from URLs supplied by
+// clients. Unlike LoadImageFromURL it guards against server-side request
+// forgery: hosts can be allow-listed, private and loopback addresses are
+// refused after DNS resolution (so a public name pointing at 127.0.0.1 is
+// caught too), redirects are limited and re-checked, and the response must
+// be a PNG or JPEG within Limits.
+//
+// The zero value is ready to use with the defaults noted on each field.
+type ImageFetcher struct {
+	// AllowedHosts limits fetching to these host names. "*.example.com"
+	// matches any subdomain of example.com. Empty allows any public host.
+	AllowedHosts []string
+	// AllowPrivate permits loopback, private and link-local addresses, for
+	// development against a local file server.
+	AllowPrivate bool
+	// MaxRedirects is the number of redirects followed (default 3; a
+	// negative value follows none).
+	MaxRedirects int
+	// Timeout bounds the whole request, including reading the body
+	// (default 10s).
+	Timeout time.Duration
+	// Limits bounds the downloaded image (default DefaultImageLimits).
+	Limits ImageLimits
+}
+
+const (
+	defaultFetchRedirects = 3
+	defaultFetchTimeout   = 10 * time.Second
+)
+
+// Fetch downloads the image at rawURL and returns it as checked by
+// CheckImage.
+func (f *ImageFetcher) Fetch(ctx context.Context, rawURL string) (io.Reader, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrForbiddenURL, err)
+	}
+	if err := f.checkURL(u); err != nil {
+		return nil, err
+	}
+
+	timeout := f.Timeout
+	if timeout <= 0 {
+		timeout = defaultFetchTimeout
+	}
+	limits := f.Limits
+	if limits == (ImageLimits{}) {
+		limits = DefaultImageLimits
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	client := f.client(timeout)
+	defer client.CloseIdleConnections()
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d fetching %s", resp.StatusCode, u.Redacted())
+	}
+	if limits.MaxBytes > 0 && resp.ContentLength > limits.MaxBytes {
+		return nil, fmt.Errorf("%w: more than %d bytes", ErrImageTooLarge, limits.MaxBytes)
+	}
+	return CheckImage(resp.Body, limits)
+}
+
+// client returns an HTTP client that checks every address it dials and
+// every redirect it follows. It is built for one Fetch and keeps no
+// connections open after it.
+func (f *ImageFetcher) client(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		// Control runs after DNS resolution with the address actually
+		// dialled, so every IP a host resolves to is checked.
+		Control: func(_, address string, _ syscall.RawConn) error {
+			if f.AllowPrivate {
+				return nil
+			}
+			ap, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return fmt.Errorf("%w: %v", ErrForbiddenURL, err)
+			}
+			if isPrivateAddr(ap.Addr()) {
+				return fmt.Errorf("%w: %s is a private address", ErrForbiddenURL, ap.Addr())
+			}
+			return nil
+		},
+	}
+	maxRedirects := f.MaxRedirects
+	if maxRedirects == 0 {
+		maxRedirects = defaultFetchRedirects
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			// No Proxy: a proxy would dial on our behalf, past the checks.
+			DialContext:           dialer.DialContext,
+			DisableKeepAlives:     true,
+			TLSHandshakeTimeout:   timeout,
+			ResponseHeaderTimeout: timeout,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > maxRedirects {
+				return fmt.Errorf("%w: more than %d redirects", ErrForbiddenURL, max(maxRedirects, 0))
+			}
+			return f.checkURL(req.URL)
+		},
+	}
+}
+
+// checkURL enforces the scheme and AllowedHosts.
+func (f *ImageFetcher) checkURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%w: scheme must be http or https", ErrForbiddenURL)
+	}
+	host := strings.ToLower(u.Hostname())
+	if host == "" {
+		return fmt.Errorf("%w: missing host", ErrForbiddenURL)
+	}
+	if len(f.AllowedHosts) == 0 {
+		return nil
+	}
+	for _, allowed := range f.AllowedHosts {
+		allowed = strings.ToLower(allowed)
+		if host == allowed || (strings.HasPrefix(allowed, "*.") && strings.HasSuffix(host, allowed[1:])) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: host %s is not allowed", ErrForbiddenURL, host)
+}
+
+// reservedPrefixes are IPv4 ranges that netip has no predicate for.
+var reservedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),     // "this network" (RFC 1122), dials the local host
+	netip.MustParsePrefix("100.64.0.0/10"), // shared address space (RFC 6598): carrier-grade NAT and some cloud metadata services
+}
+
+// nat64Prefix is the well-known NAT64 prefix 64:ff9b::/96 (RFC 6052), whose
+// addresses reach the IPv4 address in their last four bytes.
+var nat64Prefix = netip.MustParsePrefix("64:ff9b::/96")
+
+// isPrivateAddr reports whether addr is not a public unicast address.
+func isPrivateAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if nat64Prefix.Contains(addr) {
+		b := addr.As16()
+		addr = netip.AddrFrom4([4]byte(b[12:]))
+	}
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return true
+	}
+	for _, p := range reservedPrefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
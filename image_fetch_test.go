@@ -0,0 +1,154 @@
+package pdf50tawi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newImageServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	var pngData bytes.Buffer
+	if err := png.Encode(&pngData, image.NewRGBA(image.Rect(0, 0, 20, 10))); err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sign.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(pngData.Bytes())
+	})
+	mux.HandleFunc("/page.html", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html><body>not an image</body></html>"))
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/sign.png", http.StatusFound)
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestImageFetcher(t *testing.T) {
+	srv := newImageServer(t)
+	ctx := context.Background()
+
+	testCases := []struct {
+		name    string
+		fetcher ImageFetcher
+		path    string
+		wantErr error
+	}{
+		{"LoopbackRefused", ImageFetcher{}, "/sign.png", ErrForbiddenURL},
+		{"AllowPrivate", ImageFetcher{AllowPrivate: true}, "/sign.png", nil},
+		{"Redirect", ImageFetcher{AllowPrivate: true}, "/redirect", nil},
+		{"NoRedirects", ImageFetcher{AllowPrivate: true, MaxRedirects: -1}, "/redirect", ErrForbiddenURL},
+		{"RedirectLoop", ImageFetcher{AllowPrivate: true}, "/loop", ErrForbiddenURL},
+		{"HostNotAllowed", ImageFetcher{AllowPrivate: true, AllowedHosts: []string{"cdn.example.com"}}, "/sign.png", ErrForbiddenURL},
+		{"HostAllowed", ImageFetcher{AllowPrivate: true, AllowedHosts: []string{"127.0.0.1"}}, "/sign.png", nil},
+		{"NotAnImage", ImageFetcher{AllowPrivate: true}, "/page.html", ErrUnsupportedImage},
+		{"TooLarge", ImageFetcher{AllowPrivate: true, Limits: ImageLimits{MaxBytes: 10}}, "/sign.png", ErrImageTooLarge},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := tc.fetcher.Fetch(ctx, srv.URL+tc.path)
+			if tc.wantErr != nil {
+				if !errors.Is(err, tc.wantErr) {
+					t.Fatalf("expected %v, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if data, _ := io.ReadAll(r); len(data) == 0 {
+				t.Fatal("expected image data")
+			}
+		})
+	}
+}
+
+func TestImageFetcherClosesConnections(t *testing.T) {
+	var open atomic.Int32
+	srv := httptest.NewUnstartedServer(newImageServer(t).Config.Handler)
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		switch state {
+		case http.StateNew:
+			open.Add(1)
+		case http.StateClosed, http.StateHijacked:
+			open.Add(-1)
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+	f := ImageFetcher{AllowPrivate: true}
+	for range 3 {
+		if _, err := f.Fetch(context.Background(), srv.URL+"/sign.png"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for deadline := time.Now().Add(2 * time.Second); open.Load() > 0; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d connections still open after Fetch", open.Load())
+		}
+	}
+}
+
+func TestImageFetcherCheckURL(t *testing.T) {
+	f := ImageFetcher{AllowedHosts: []string{"*.example.com"}}
+	for rawURL, allowed := range map[string]bool{
+		"https://cdn.example.com/a.png":     true,
+		"https://a.b.example.com/a.png":     true,
+		"https://example.com/a.png":         false,
+		"https://evilexample.com/a.png":     false,
+		"ftp://cdn.example.com/a.png":       false,
+		"file:///etc/passwd":                false,
+		"https://cdn.example.com.evil.io/a": false,
+	} {
+		u, _ := url.Parse(rawURL)
+		err := f.checkURL(u)
+		if forbidden := errors.Is(err, ErrForbiddenURL); forbidden == allowed {
+			t.Errorf("%s: allowed %v, got %v", rawURL, allowed, err)
+		}
+	}
+}
+
+func TestIsPrivateAddr(t *testing.T) {
+	for addr, private := range map[string]bool{
+		"127.0.0.1":          true,
+		"10.1.2.3":           true,
+		"172.16.0.1":         true,
+		"192.168.1.1":        true,
+		"169.254.169.254":    true,
+		"100.100.100.200":    true,
+		"0.0.0.0":            true,
+		"0.1.2.3":            true, // 0.0.0.0/8
+		"100.64.0.1":         true, // carrier-grade NAT
+		"100.127.255.254":    true,
+		"100.128.0.1":        false,
+		"64:ff9b::7f00:1":    true,  // NAT64 of 127.0.0.1
+		"64:ff9b::a9fe:a9fe": true,  // NAT64 of 169.254.169.254
+		"64:ff9b::808:808":   false, // NAT64 of 8.8.8.8
+		"::1":                true,
+		"fd00::1":            true,
+		"::ffff:10.0.0.1":    true,
+		"8.8.8.8":            false,
+		"2606:4700::1111":    false,
+	} {
+		if got := isPrivateAddr(netip.MustParseAddr(addr)); got != private {
+			t.Errorf("isPrivateAddr(%s) = %v, want %v", addr, got, private)
+		}
+	}
+}
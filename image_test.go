@@ -2,8 +2,13 @@ package pdf50tawi
 
 import (
 	"bytes"
+	"errors"
 	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
 	"image/png"
+	"io"
 	"testing"
 )
 
@@ -54,3 +59,95 @@ func TestTinyEmptyPNGConsistency(t *testing.T) {
 		t.Fatal("expected identical PNG data from multiple calls")
 	}
 }
+
+func TestCheckImage(t *testing.T) {
+	var pngData bytes.Buffer
+	if err := png.Encode(&pngData, image.NewRGBA(image.Rect(0, 0, 20, 10))); err != nil {
+		t.Fatal(err)
+	}
+	var jpegData bytes.Buffer
+	if err := jpeg.Encode(&jpegData, image.NewRGBA(image.Rect(0, 0, 20, 10)), nil); err != nil {
+		t.Fatal(err)
+	}
+	var gifData bytes.Buffer
+	if err := gif.Encode(&gifData, image.NewPaletted(image.Rect(0, 0, 20, 10), color.Palette{color.White}), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name    string
+		data    []byte
+		limits  ImageLimits
+		wantErr error
+	}{
+		{"PNG", pngData.Bytes(), DefaultImageLimits, nil},
+		{"JPEG", jpegData.Bytes(), DefaultImageLimits, nil},
+		{"NoLimits", pngData.Bytes(), ImageLimits{}, nil},
+		{"GIF", gifData.Bytes(), DefaultImageLimits, ErrUnsupportedImage},
+		{"Text", []byte("not an image"), DefaultImageLimits, ErrUnsupportedImage},
+		{"Empty", nil, DefaultImageLimits, ErrUnsupportedImage},
+		{"TooManyBytes", pngData.Bytes(), ImageLimits{MaxBytes: 10}, ErrImageTooLarge},
+		{"TooWide", pngData.Bytes(), ImageLimits{MaxWidth: 19}, ErrImageTooLarge},
+		{"TooTall", pngData.Bytes(), ImageLimits{MaxHeight: 9}, ErrImageTooLarge},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := CheckImage(bytes.NewReader(tc.data), tc.limits)
+			if tc.wantErr != nil {
+				if !errors.Is(err, tc.wantErr) {
+					t.Fatalf("expected %v, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got, _ := io.ReadAll(r)
+			if !bytes.Equal(got, tc.data) {
+				t.Fatal("expected the image bytes to be returned unchanged")
+			}
+		})
+	}
+
+	if r, err := CheckImage(nil, DefaultImageLimits); r != nil || err != nil {
+		t.Fatalf("expected nil for a missing image, got %v, %v", r, err)
+	}
+}
+
+func TestNormalizeImage(t *testing.T) {
+	var jpegData bytes.Buffer
+	if err := jpeg.Encode(&jpegData, image.NewRGBA(image.Rect(0, 0, 400, 100)), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name       string
+		maxW, maxH int
+		wantW      int
+		wantH      int
+	}{
+		{"FitsAlready", 1024, 1024, 400, 100},
+		{"NoBounds", 0, 0, 400, 100},
+		{"ScaledToWidth", 200, 1024, 200, 50},
+		{"ScaledToHeight", 1024, 20, 80, 20},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := NormalizeImage(bytes.NewReader(jpegData.Bytes()), DefaultImageLimits, tc.maxW, tc.maxH)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+			if err != nil || format != "png" {
+				t.Fatalf("expected a PNG, got %q, %v", format, err)
+			}
+			if cfg.Width != tc.wantW || cfg.Height != tc.wantH {
+				t.Fatalf("got %d×%d, want %d×%d", cfg.Width, cfg.Height, tc.wantW, tc.wantH)
+			}
+		})
+	}
+
+	if _, err := NormalizeImage(bytes.NewReader([]byte("not an image")), DefaultImageLimits, 0, 0); !errors.Is(err, ErrUnsupportedImage) {
+		t.Fatalf("expected ErrUnsupportedImage, got %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package pdf50tawi
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// LayoutField is where one TaxInfo field, or one digit of a tax ID, is drawn
+// on the form.
+type LayoutField struct {
+	// Field is the JSON path of the TaxInfo field, e.g. "payee.name".
+	// Tax ID digits are indexed: "payee.taxId[0]" … "payee.taxId[12]".
+	// The images are "signature" and "seal".
+	Field string `json:"field"`
+
+	Anchor Anchor  `json:"anchor"`
+	Dx     float64 `json:"dx"`
+	Dy     float64 `json:"dy"`
+
+	// FontSize is set for text, Scale for images.
+	FontSize int     `json:"fontSize,omitempty"`
+	Scale    float64 `json:"scale,omitempty"`
+}
+
+// Layout returns the position of every field on the form, in the order of
+// TaxInfo, followed by the signature and seal. Positions use the same
+// anchor-relative coordinates as TextField and ImageField.
+func Layout() []LayoutField {
+	var layout []LayoutField
+	forEachLeaf(reflect.TypeOf(TaxInfo{}), "", nil, func(path string, index []int) {
+		var t TaxInfo
+		v := reflect.ValueOf(&t).Elem().FieldByIndex(index)
+		if v.Kind() == reflect.Bool {
+			v.SetBool(true)
+		} else {
+			v.SetString("1111111111111") // long enough to place every tax ID digit
+		}
+		fields := TextFieldsFromTaxInfo(t)
+		for i, f := range fields {
+			name := path
+			if len(fields) > 1 {
+				name += "[" + strconv.Itoa(i) + "]"
+			}
+			layout = append(layout, LayoutField{Field: name, Anchor: f.Position, Dx: f.Dx, Dy: f.Dy, FontSize: f.FontSize})
+		}
+	})
+
+	images := CertificateImageFields(nil, nil)
+	for i, name := range []string{"signature", "seal"} {
+		img := images[i]
+		layout = append(layout, LayoutField{Field: name, Anchor: img.Pos, Dx: img.Dx, Dy: img.Dy, Scale: img.Scale})
+	}
+	return layout
+}
+
+// forEachLeaf calls fn with the JSON path and field index of every string and
+// bool field of the struct type t.
+func forEachLeaf(t reflect.Type, prefix string, index []int, fn func(path string, index []int)) {
+	for i := range t.NumField() {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		idx := append(append([]int(nil), index...), i)
+		switch f.Type.Kind() {
+		case reflect.Struct:
+			forEachLeaf(f.Type, name, idx, fn)
+		case reflect.String, reflect.Bool:
+			fn(name, idx)
+		}
+	}
+}
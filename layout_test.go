@@ -0,0 +1,58 @@
+package pdf50tawi
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestLayout(t *testing.T) {
+	layout := Layout()
+	byField := make(map[string]LayoutField, len(layout))
+	for _, f := range layout {
+		if _, dup := byField[f.Field]; dup {
+			t.Errorf("duplicate layout field %q", f.Field)
+		}
+		byField[f.Field] = f
+	}
+
+	name, ok := byField["payer.name"]
+	if !ok || name.Anchor != TopLeft || name.Dx != 58 || name.Dy != -110 || name.FontSize != 14 {
+		t.Errorf("payer.name = %+v, ok=%v", name, ok)
+	}
+	if _, ok := byField["payee.pnd_53"]; !ok {
+		t.Error("missing checkmark field payee.pnd_53")
+	}
+	if _, ok := byField["signature"]; !ok {
+		t.Error("missing signature")
+	}
+
+	digits := map[string]int{}
+	for _, f := range layout {
+		if base, _, ok := strings.Cut(f.Field, "["); ok {
+			digits[base]++
+		}
+	}
+	for field, want := range map[string]int{"payer.taxId": 13, "payee.taxId": 13, "payer.taxId10Digit": 10, "payee.taxId10Digit": 10} {
+		if digits[field] != want {
+			t.Errorf("%s: got %d digit positions, want %d", field, digits[field], want)
+		}
+	}
+}
+
+func TestAnchorJSON(t *testing.T) {
+	data, err := json.Marshal(LayoutField{Field: "x", Anchor: BottomRight})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"anchor":"BottomRight"`) {
+		t.Fatalf("unexpected JSON %s", data)
+	}
+	var f LayoutField
+	if err := json.Unmarshal(data, &f); err != nil || f.Anchor != BottomRight {
+		t.Fatalf("round trip: %+v, %v", f, err)
+	}
+	if err := json.Unmarshal([]byte(`{"anchor":"Middle"}`), &f); err == nil {
+		t.Fatal("expected an error for an unknown anchor")
+	}
+}
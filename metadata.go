@@ -0,0 +1,162 @@
+package pdf50tawi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// Document information keys written by WithMetadata.
+const (
+	metadataKeyVersion  = "Pdf50tawiVersion"
+	metadataKeyTemplate = "Pdf50tawiTemplate"
+	metadataKeyTaxInfo  = "Pdf50tawiTaxInfo"
+	metadataKeyReplaces = "Pdf50tawiReplaces"
+)
+
+// metadataVersion is bumped whenever the embedded metadata changes shape.
+const metadataVersion = "1"
+
+// ErrNoMetadata is returned by ReadMetadata for a PDF issued without
+// WithMetadata.
+var ErrNoMetadata = errors.New("no pdf50tawi metadata in PDF")
+
+// Metadata is the machine-readable copy of a certificate embedded by
+// WithMetadata.
+type Metadata struct {
+	// Version is the metadata format version.
+	Version string `json:"version"`
+
+	// Template is the TemplateVersion of the form the certificate was
+	// filled on.
+	Template string `json:"template"`
+
+	TaxInfo TaxInfo `json:"taxInfo"`
+
+	// Replaces is the cancelled certificate this one was issued in place
+	// of (WithReplaces), nil for an original.
+	Replaces *Replaces `json:"replaces,omitempty"`
+}
+
+// WithMetadata embeds the TaxInfo as JSON, together with the template
+// version, in the document information dictionary so the data can be read
+// back from the PDF with ReadMetadata. Combined with WithEncryption the
+// metadata is encrypted along with the rest of the document.
+func WithMetadata() Option {
+	return func(o *issueOptions) { o.metadata = true }
+}
+
+// metadataProperties returns the document information entries for taxInfo
+// and, for a replacement, the certificate it replaces.
+func metadataProperties(taxInfo TaxInfo, replaces *Replaces) (map[string]string, error) {
+	data, err := json.Marshal(taxInfo.withoutImageSources())
+	if err != nil {
+		return nil, fmt.Errorf("encode metadata: %w", err)
+	}
+	props := map[string]string{
+		metadataKeyVersion:  metadataVersion,
+		metadataKeyTemplate: TemplateVersion(),
+		metadataKeyTaxInfo:  string(data),
+	}
+	if replaces != nil {
+		data, err := json.Marshal(replaces)
+		if err != nil {
+			return nil, fmt.Errorf("encode metadata: %w", err)
+		}
+		props[metadataKeyReplaces] = string(data)
+	}
+	return props, nil
+}
+
+// addProperties writes pdf to out with props added to its document
+// information dictionary.
+func addProperties(pdf []byte, out io.Writer, props map[string]string) error {
+	if err := api.AddProperties(bytes.NewReader(pdf), out, props, pdfcpuConfig()); err != nil {
+		return fmt.Errorf("embed metadata: %w", err)
+	}
+	return nil
+}
+
+// insertProperties adds props to a document information dictionary in key
+// order.
+func insertProperties(info types.Dict, props map[string]string) error {
+	keys := make([]string, 0, len(props))
+	for k := range props {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s, err := types.EscapedUTF16String(props[k])
+		if err != nil {
+			return fmt.Errorf("embed metadata: %s: %w", k, err)
+		}
+		info[k] = types.StringLiteral(*s)
+	}
+	return nil
+}
+
+// ReadMetadata reads the metadata embedded by WithMetadata from a
+// certificate. password opens an encrypted certificate and is ignored
+// otherwise. A PDF without metadata yields ErrNoMetadata.
+func ReadMetadata(r io.ReadSeeker, password string) (Metadata, error) {
+	conf := pdfcpuConfig()
+	conf.UserPW = password
+	conf.OwnerPW = password
+	ctx, err := api.ReadContext(r, conf)
+	if err != nil {
+		return Metadata{}, fmt.Errorf("read PDF: %w", err)
+	}
+	if ctx.Info == nil {
+		return Metadata{}, ErrNoMetadata
+	}
+	info, err := ctx.DereferenceDict(*ctx.Info)
+	if err != nil {
+		return Metadata{}, fmt.Errorf("read document information: %w", err)
+	}
+
+	get := func(key string) (string, error) {
+		obj, err := ctx.Dereference(info[key])
+		if err != nil || obj == nil {
+			return "", err
+		}
+		s, err := types.StringOrHexLiteral(obj)
+		if err != nil || s == nil {
+			return "", fmt.Errorf("read %s: %w", key, err)
+		}
+		return *s, nil
+	}
+
+	var m Metadata
+	var taxInfo, replaces string
+	for _, f := range []struct {
+		key string
+		dst *string
+	}{
+		{metadataKeyVersion, &m.Version},
+		{metadataKeyTemplate, &m.Template},
+		{metadataKeyTaxInfo, &taxInfo},
+		{metadataKeyReplaces, &replaces},
+	} {
+		if *f.dst, err = get(f.key); err != nil {
+			return Metadata{}, err
+		}
+	}
+	if m.Version == "" || taxInfo == "" {
+		return Metadata{}, ErrNoMetadata
+	}
+	if err := json.Unmarshal([]byte(taxInfo), &m.TaxInfo); err != nil {
+		return Metadata{}, fmt.Errorf("decode embedded TaxInfo: %w", err)
+	}
+	if replaces != "" {
+		if err := json.Unmarshal([]byte(replaces), &m.Replaces); err != nil {
+			return Metadata{}, fmt.Errorf("decode embedded replaced certificate: %w", err)
+		}
+	}
+	return m, nil
+}
@@ -0,0 +1,59 @@
+package pdf50tawi
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestReadMetadata(t *testing.T) {
+	tax := sampleTaxInfo()
+	enc := Encryption{UserPassword: "secret"}
+	testCases := []struct {
+		name     string
+		opts     []Option
+		password string
+	}{
+		{"Plain", []Option{WithMetadata()}, ""},
+		{"Reproducible", []Option{WithMetadata(), WithReproducibleOutput()}, ""},
+		{"Encrypted", []Option{WithMetadata(), WithEncryption(enc)}, "secret"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := IssueWHTCertificatePDF(&out, tax, nil, nil, tc.opts...); err != nil {
+				t.Fatalf("IssueWHTCertificatePDF error: %v", err)
+			}
+			m, err := ReadMetadata(bytes.NewReader(out.Bytes()), tc.password)
+			if err != nil {
+				t.Fatalf("ReadMetadata error: %v", err)
+			}
+			if m.Version != metadataVersion || m.Template != TemplateVersion() {
+				t.Errorf("got version %q template %q", m.Version, m.Template)
+			}
+			if !reflect.DeepEqual(m.TaxInfo, tax) {
+				t.Errorf("embedded TaxInfo differs:\ngot  %+v\nwant %+v", m.TaxInfo, tax)
+			}
+		})
+	}
+}
+
+func TestReadMetadataWithoutMetadata(t *testing.T) {
+	var out bytes.Buffer
+	if err := IssueWHTCertificatePDF(&out, sampleTaxInfo(), nil, nil); err != nil {
+		t.Fatalf("IssueWHTCertificatePDF error: %v", err)
+	}
+	if _, err := ReadMetadata(bytes.NewReader(out.Bytes()), ""); !errors.Is(err, ErrNoMetadata) {
+		t.Fatalf("expected ErrNoMetadata, got %v", err)
+	}
+}
+
+func TestTemplateVersion(t *testing.T) {
+	v := TemplateVersion()
+	if _, err := hex.DecodeString(v); err != nil || len(v) != 12 {
+		t.Fatalf("unexpected template version %q", v)
+	}
+}
@@ -0,0 +1,169 @@
+package pdf50tawi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SequenceStore hands out the numbers of named sequences for Numbering.
+// Next must be atomic: no two calls return the same number for the same
+// key, also when several servers share the store.
+type SequenceStore interface {
+	// Next advances the sequence key, which starts at 0, and returns its
+	// new value.
+	Next(ctx context.Context, key string) (int64, error)
+}
+
+// MemorySequenceStore is a SequenceStore for a single process; the
+// sequences start over when it restarts.
+type MemorySequenceStore struct {
+	mu   sync.Mutex
+	seqs map[string]int64
+}
+
+// NewMemorySequenceStore returns a store with every sequence at 0.
+func NewMemorySequenceStore() *MemorySequenceStore {
+	return &MemorySequenceStore{seqs: map[string]int64{}}
+}
+
+func (s *MemorySequenceStore) Next(_ context.Context, key string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seqs[key]++
+	return s.seqs[key], nil
+}
+
+// Numbering fills in empty เล่มที่ and เลขที่ (DocumentDetails.BookNumber and
+// DocumentNumber) from formats such as "{yyyy}-{seq:05}":
+//
+//	{yyyy}    the พ.ศ. year, e.g. 2568
+//	{yy}      its last two digits, e.g. 68
+//	{seq}     the next number of the payer's sequence for that year
+//	{seq:05}  the same, zero-padded to 5 digits
+//
+// Each payer (by tax ID) has its own sequence per year, so numbers restart
+// at 1 every year. The year is that of Certification.DateOfIssuance, or the
+// current year in Thailand when it is empty.
+//
+// A certificate takes one number, shared by both formats, and only when an
+// empty field's format uses {seq}. A number is gone once taken, so take it
+// after validating the certificate, to keep gaps to failed issuances.
+type Numbering struct {
+	// BookFormat fills an empty BookNumber; empty leaves it alone.
+	BookFormat string
+	// DocumentFormat fills an empty DocumentNumber; empty leaves it alone.
+	DocumentFormat string
+	// Store holds the sequences.
+	Store SequenceStore
+	// Now returns the current time (default time.Now).
+	Now func() time.Time
+}
+
+// Check reports a format with an unknown placeholder or a malformed {seq}.
+func (n *Numbering) Check() error {
+	for _, f := range []struct{ name, format string }{
+		{"book number", n.BookFormat},
+		{"document number", n.DocumentFormat},
+	} {
+		if _, err := expandNumberFormat(f.format, "2568", 1); err != nil {
+			return fmt.Errorf("%s format %q: %w", f.name, f.format, err)
+		}
+	}
+	return nil
+}
+
+// Assign fills in the empty book and document numbers of t that have a
+// format, taking a number from the payer's sequence if they need one. It
+// reports whether it changed t.
+func (n *Numbering) Assign(ctx context.Context, t *TaxInfo) (bool, error) {
+	book := t.DocumentDetails.BookNumber == "" && n.BookFormat != ""
+	doc := t.DocumentDetails.DocumentNumber == "" && n.DocumentFormat != ""
+	if !book && !doc {
+		return false, nil
+	}
+	year := n.year(t.Certification.DateOfIssuance)
+
+	var seq int64
+	if (book && usesSequence(n.BookFormat)) || (doc && usesSequence(n.DocumentFormat)) {
+		if n.Store == nil {
+			return false, errors.New("numbering: no sequence store")
+		}
+		payer := stripSpaces(t.Payer.TaxID)
+		if payer == "" {
+			payer = stripSpaces(t.Payer.TaxID10Digit)
+		}
+		var err error
+		if seq, err = n.Store.Next(ctx, payer+"/"+year); err != nil {
+			return false, fmt.Errorf("numbering: %w", err)
+		}
+	}
+	if book {
+		s, err := expandNumberFormat(n.BookFormat, year, seq)
+		if err != nil {
+			return false, fmt.Errorf("book number format: %w", err)
+		}
+		t.DocumentDetails.BookNumber = s
+	}
+	if doc {
+		s, err := expandNumberFormat(n.DocumentFormat, year, seq)
+		if err != nil {
+			return false, fmt.Errorf("document number format: %w", err)
+		}
+		t.DocumentDetails.DocumentNumber = s
+	}
+	return true, nil
+}
+
+// year returns the พ.ศ. year of d, or the current one.
+func (n *Numbering) year(d DateOfIssuance) string {
+	now := time.Now
+	if n.Now != nil {
+		now = n.Now
+	}
+	return d.BuddhistYear(now())
+}
+
+func usesSequence(format string) bool {
+	return strings.Contains(format, "{seq}") || strings.Contains(format, "{seq:")
+}
+
+// expandNumberFormat replaces the placeholders of format.
+func expandNumberFormat(format, year string, seq int64) (string, error) {
+	var b strings.Builder
+	for {
+		open := strings.IndexByte(format, '{')
+		if open < 0 {
+			b.WriteString(format)
+			return b.String(), nil
+		}
+		end := strings.IndexByte(format[open:], '}')
+		if end < 0 {
+			return "", errors.New("unclosed {")
+		}
+		b.WriteString(format[:open])
+		name := format[open+1 : open+end]
+		format = format[open+end+1:]
+
+		switch {
+		case name == "yyyy":
+			b.WriteString(year)
+		case name == "yy":
+			b.WriteString(year[len(year)-2:])
+		case name == "seq":
+			b.WriteString(strconv.FormatInt(seq, 10))
+		case strings.HasPrefix(name, "seq:"):
+			width, err := strconv.Atoi(name[len("seq:"):])
+			if err != nil || width < 1 || width > 20 || !strings.HasPrefix(name, "seq:0") {
+				return "", fmt.Errorf("{%s}: the width must be written as in {seq:05}", name)
+			}
+			fmt.Fprintf(&b, "%0*d", width, seq)
+		default:
+			return "", fmt.Errorf("unknown placeholder {%s}", name)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package pdf50tawi
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestNumberingAssign(t *testing.T) {
+	ctx := context.Background()
+	n := &Numbering{
+		BookFormat:     "{yy}",
+		DocumentFormat: "{yyyy}-{seq:05}",
+		Store:          NewMemorySequenceStore(),
+		Now:            func() time.Time { return time.Date(2025, 12, 31, 18, 0, 0, 0, time.UTC) }, // 1 January 2569 in Thailand
+	}
+	issue := func(payer, year, book, doc string) DocumentDetails {
+		t.Helper()
+		ti := TaxInfo{DocumentDetails: DocumentDetails{BookNumber: book, DocumentNumber: doc}, Payer: Payer{TaxID: payer}}
+		ti.Certification.DateOfIssuance.Year = year
+		if _, err := n.Assign(ctx, &ti); err != nil {
+			t.Fatal(err)
+		}
+		return ti.DocumentDetails
+	}
+
+	testCases := []struct {
+		name              string
+		payer, year       string
+		book, doc         string
+		wantBook, wantDoc string
+	}{
+		{"First", "0105551234567", "2568", "", "", "68", "2568-00001"},
+		{"Next", "0105551234567", "2568", "", "", "68", "2568-00002"},
+		{"PayerSpaces", "0 1055 51234 56 7", "2568", "", "", "68", "2568-00003"},
+		{"OtherPayer", "1234567890123", "2568", "", "", "68", "2568-00001"},
+		{"NextYear", "0105551234567", "2569", "", "", "69", "2569-00001"},
+		{"CEYear", "0105551234567", "2025", "", "", "68", "2568-00004"},
+		{"CurrentYear", "0105551234567", "", "", "", "69", "2569-00002"},
+		{"KeptNumbers", "0105551234567", "2568", "7", "0099", "7", "0099"},
+		{"KeptDocument", "0105551234567", "2568", "", "0099", "68", "0099"},
+		{"AfterKept", "0105551234567", "2568", "", "", "68", "2568-00005"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := issue(tc.payer, tc.year, tc.book, tc.doc)
+			if got.BookNumber != tc.wantBook || got.DocumentNumber != tc.wantDoc {
+				t.Fatalf("got %q / %q, want %q / %q", got.BookNumber, got.DocumentNumber, tc.wantBook, tc.wantDoc)
+			}
+		})
+	}
+}
+
+func TestNumberingCheck(t *testing.T) {
+	testCases := []struct {
+		format string
+		ok     bool
+	}{
+		{"{yyyy}-{seq:05}", true},
+		{"INV{seq}", true},
+		{"", true},
+		{"{seq:5}", false},
+		{"{month}", false},
+		{"{yyyy", false},
+	}
+	for _, tc := range testCases {
+		err := (&Numbering{DocumentFormat: tc.format}).Check()
+		if (err == nil) != tc.ok {
+			t.Errorf("Check(%q) = %v, want ok %v", tc.format, err, tc.ok)
+		}
+	}
+}
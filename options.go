@@ -0,0 +1,41 @@
+package pdf50tawi
+
+// Option customises how IssueWHTCertificatePDF produces the certificate.
+type Option func(*issueOptions)
+
+// issueOptions collects the optional settings applied on top of the plain
+// template fill.
+type issueOptions struct {
+	encryption   *Encryption
+	reproducible bool
+	metadata     bool
+	replaces     *Replaces
+	qrCode       *QRCode
+	watermarks   []Watermark
+}
+
+func newIssueOptions(opts []Option) issueOptions {
+	var o issueOptions
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&o)
+		}
+	}
+	return o
+}
+
+// overlays returns the extra page content requested for taxInfo.
+func (o issueOptions) overlays(taxInfo TaxInfo) ([]overlay, error) {
+	var overlays []overlay
+	if o.qrCode != nil {
+		ov, err := o.qrCode.overlay(taxInfo)
+		if err != nil {
+			return nil, err
+		}
+		overlays = append(overlays, ov)
+	}
+	for _, w := range o.watermarks {
+		overlays = append(overlays, w.overlay())
+	}
+	return overlays, nil
+}
@@ -41,9 +41,18 @@ func anchorToXY(anchor Anchor, dx, dy float64) (float64, float64) {
 	}
 }
 
+// overlay draws extra content such as a QR code onto the certificate page.
+// Overlays marked behind are drawn after the template but before the fields;
+// the rest are drawn last. raster draws the same content on image previews.
+type overlay struct {
+	behind bool
+	draw   func(pdf *gopdf.GoPdf) error
+	raster func(p *rasterPage) error
+}
+
 // fillCertificate builds the output PDF by importing the template, then placing all
 // text and image fields. The Thai font is embedded once with subsetting.
-func fillCertificate(textFields []TextField, imageFields []ImageField, out io.Writer) error {
+func fillCertificate(textFields []TextField, imageFields []ImageField, out io.Writer, overlays ...overlay) error {
 	tplPath, err := cachedTemplatePath()
 	if err != nil {
 		return err
@@ -61,6 +70,10 @@ func fillCertificate(textFields []TextField, imageFields []ImageField, out io.Wr
 	pdf.AddPage()
 	pdf.UseImportedTemplate(tplIdx, 0, 0, pageWidth, pageHeight)
 
+	if err := drawOverlays(&pdf, overlays, true); err != nil {
+		return err
+	}
+
 	for _, img := range imageFields {
 		if err := placeImage(&pdf, img); err != nil {
 			return err
@@ -73,10 +86,26 @@ func fillCertificate(textFields []TextField, imageFields []ImageField, out io.Wr
 		}
 	}
 
+	if err := drawOverlays(&pdf, overlays, false); err != nil {
+		return err
+	}
+
 	_, err = pdf.WriteTo(out)
 	return err
 }
 
+func drawOverlays(pdf *gopdf.GoPdf, overlays []overlay, behind bool) error {
+	for _, o := range overlays {
+		if o.behind != behind {
+			continue
+		}
+		if err := o.draw(pdf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func placeText(pdf *gopdf.GoPdf, field TextField) error {
 	x, y := anchorToXY(field.Position, field.Dx, field.Dy)
 
@@ -89,24 +118,28 @@ func placeText(pdf *gopdf.GoPdf, field TextField) error {
 		return fmt.Errorf("set font: %w", err)
 	}
 
-	// pdfcpu anchors the text bounding box corner that matches the anchor name.
-	// gopdf.Text() always starts text at the left edge, so we must shift x to
-	// replicate right-align (BottomRight/TopRight/Right) and center (XCenter).
-	switch field.Position {
-	case TopCenter, BottomCenter, Center:
-		if w, err := pdf.MeasureTextWidth(field.Text); err == nil {
-			x -= w / 2
-		}
-	case TopRight, BottomRight, Right:
-		if w, err := pdf.MeasureTextWidth(field.Text); err == nil {
-			x -= w
-		}
+	if w, err := pdf.MeasureTextWidth(field.Text); err == nil {
+		x = alignX(field.Position, x, w)
 	}
 
 	pdf.SetXY(x, y)
 	return pdf.Text(field.Text)
 }
 
+// alignX returns where text of width w starts for a field anchored at x.
+// pdfcpu anchors the text bounding box corner that matches the anchor name.
+// gopdf.Text() always starts text at the left edge, so we must shift x to
+// replicate right-align (BottomRight/TopRight/Right) and center (XCenter).
+func alignX(pos Anchor, x, w float64) float64 {
+	switch pos {
+	case TopCenter, BottomCenter, Center:
+		return x - w/2
+	case TopRight, BottomRight, Right:
+		return x - w
+	}
+	return x
+}
+
 
 // drawCheckmark draws a bold ✓ matching the reference style:
 // thick uniform stroke, large rounded caps at both tips, smooth rounded valley.
@@ -117,6 +150,14 @@ func placeText(pdf *gopdf.GoPdf, field TextField) error {
 //	right-cap → right-arm-inner → valley-inner-arc →
 //	left-arm-inner → left-cap → (close)
 func drawCheckmark(pdf *gopdf.GoPdf, x, y, size float64) error {
+	pdf.SetFillColor(0, 0, 0)
+	pdf.Polygon(checkmarkOutline(x, y, size), "F")
+	return nil
+}
+
+// checkmarkOutline returns the closed ✓ outline drawn by drawCheckmark, in
+// page coordinates.
+func checkmarkOutline(x, y, size float64) []gopdf.Point {
 	const N = 28  // samples per arm
 	const C = 16  // semicircle cap divisions (180/16 ≈ 11° per step = smooth)
 	h := size * 0.125 // half stroke width
@@ -157,7 +198,7 @@ func drawCheckmark(pdf *gopdf.GoPdf, x, y, size float64) error {
 		tdx := 3 * (u*u*(c1x-p1x) + 2*u*t*(c2x-c1x) + t*t*(p2x-c2x))
 		tdy := 3 * (u*u*(c1y-p1y) + 2*u*t*(c2y-c1y) + t*t*(p2y-c2y))
 		tl := math.Sqrt(tdx*tdx + tdy*tdy); tdx /= tl; tdy /= tl
-		return pt{px - tdy*hh, py + tdx*hh}, pt{px + tdy*hh, py - tdx*hh}
+		return pt{X: px - tdy*hh, Y: py + tdx*hh}, pt{X: px + tdy*hh, Y: py - tdx*hh}
 	}
 
 	// smoothCap: sweep semicircle cos(θ)*a1 + sin(θ)*fwd for θ ∈ [0, π]
@@ -165,7 +206,7 @@ func drawCheckmark(pdf *gopdf.GoPdf, x, y, size float64) error {
 		for i := 0; i <= C; i++ {
 			θ := math.Pi * float64(i) / float64(C)
 			c, s := math.Cos(θ), math.Sin(θ)
-			poly = append(poly, pt{cx + (c*a1x+s*fwdx)*h, cy + (c*a1y+s*fwdy)*h})
+			poly = append(poly, pt{X: cx + (c*a1x+s*fwdx)*h, Y: cy + (c*a1y+s*fwdy)*h})
 		}
 	}
 
@@ -173,18 +214,18 @@ func drawCheckmark(pdf *gopdf.GoPdf, x, y, size float64) error {
 	quadArc := func(ax, ay, cx, cy, bx, by float64) {
 		for i := 0; i <= 8; i++ {
 			t := float64(i) / 8.0; u := 1 - t
-			poly = append(poly, pt{u*u*ax + 2*u*t*cx + t*t*bx, u*u*ay + 2*u*t*cy + t*t*by})
+			poly = append(poly, pt{X: u*u*ax + 2*u*t*cx + t*t*bx, Y: u*u*ay + 2*u*t*cy + t*t*by})
 		}
 	}
 
 	// ── 1. Left arm outer: tip → valley ──────────────────────────────────────
 	for i := 0; i <= N; i++ {
 		t := float64(i) / float64(N)
-		poly = append(poly, pt{p0x + t*(p1x-p0x) + lox*h, p0y + t*(p1y-p0y) + loy*h})
+		poly = append(poly, pt{X: p0x + t*(p1x-p0x) + lox*h, Y: p0y + t*(p1y-p0y) + loy*h})
 	}
 
 	// ── 2. Valley outer: single bottom point below valley center ─────────────
-	poly = append(poly, pt{p1x, p1y + h})
+	poly = append(poly, pt{X: p1x, Y: p1y + h})
 
 	// ── 3. Right arm outer: valley → tip ─────────────────────────────────────
 	for i := 1; i <= N; i++ {
@@ -213,15 +254,13 @@ func drawCheckmark(pdf *gopdf.GoPdf, x, y, size float64) error {
 	// ── 7. Left arm inner: valley → tip ──────────────────────────────────────
 	for i := N - 1; i >= 0; i-- {
 		t := float64(i) / float64(N)
-		poly = append(poly, pt{p0x + t*(p1x-p0x) + lix*h, p0y + t*(p1y-p0y) + liy*h})
+		poly = append(poly, pt{X: p0x + t*(p1x-p0x) + lix*h, Y: p0y + t*(p1y-p0y) + liy*h})
 	}
 
 	// ── 8. Left cap: sweep lix → lbx → lox ───────────────────────────────────
 	smoothCap(p0x, p0y, lix, liy, lbx, lby)
 
-	pdf.SetFillColor(0, 0, 0)
-	pdf.Polygon(poly, "F")
-	return nil
+	return poly
 }
 
 func placeImage(pdf *gopdf.GoPdf, field ImageField) error {
@@ -238,9 +277,7 @@ func placeImage(pdf *gopdf.GoPdf, field ImageField) error {
 		return nil // skip invalid/empty images
 	}
 
-	w := pageWidth * field.Scale
-	h := w * float64(cfg.Height) / float64(cfg.Width)
-	x, y := anchorToXY(field.Pos, field.Dx, field.Dy)
+	x, y, w, h := imageBox(field, cfg.Width, cfg.Height)
 
 	holder, err := gopdf.ImageHolderByBytes(data)
 	if err != nil {
@@ -248,3 +285,12 @@ func placeImage(pdf *gopdf.GoPdf, field ImageField) error {
 	}
 	return pdf.ImageByHolder(holder, x, y, &gopdf.Rect{W: w, H: h})
 }
+
+// imageBox returns the upper-left corner and size of an image field whose
+// source is width×height pixels. Scale is relative to the page width.
+func imageBox(field ImageField, width, height int) (x, y, w, h float64) {
+	w = pageWidth * field.Scale
+	h = w * float64(height) / float64(width)
+	x, y = anchorToXY(field.Pos, field.Dx, field.Dy)
+	return x, y, w, h
+}
@@ -0,0 +1,38 @@
+package pdf50tawi
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+)
+
+var disablePdfcpuConfigDir sync.Once
+
+// pdfcpuConfig returns a fresh pdfcpu configuration. pdfcpu would otherwise
+// create a config directory under the user's home on first use, which a
+// library has no business doing.
+func pdfcpuConfig() *model.Configuration {
+	disablePdfcpuConfigDir.Do(api.DisableConfigDir)
+	return model.NewDefaultConfiguration()
+}
+
+// MergePDFs writes the pages of pdfs, in order, into a single PDF, e.g. to
+// print a batch of certificates in one go.
+func MergePDFs(out io.Writer, pdfs ...[]byte) error {
+	if len(pdfs) == 0 {
+		return errors.New("no PDFs to merge")
+	}
+	rs := make([]io.ReadSeeker, len(pdfs))
+	for i, pdf := range pdfs {
+		rs[i] = bytes.NewReader(pdf)
+	}
+	if err := api.MergeRaw(rs, out, false, pdfcpuConfig()); err != nil {
+		return fmt.Errorf("merge PDFs: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package pdf50tawi
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+)
+
+func TestMergePDFs(t *testing.T) {
+	var a, b bytes.Buffer
+	if err := IssueWHTCertificatePDF(&a, sampleTaxInfo(), nil, nil); err != nil {
+		t.Fatalf("IssueWHTCertificatePDF error: %v", err)
+	}
+	if err := IssueWHTCertificatePDF(&b, sampleTaxInfo(), nil, nil, WithWatermark(CopyWatermark())); err != nil {
+		t.Fatalf("IssueWHTCertificatePDF error: %v", err)
+	}
+
+	var merged bytes.Buffer
+	if err := MergePDFs(&merged, a.Bytes(), b.Bytes()); err != nil {
+		t.Fatalf("MergePDFs error: %v", err)
+	}
+	n, err := api.PageCount(bytes.NewReader(merged.Bytes()), pdfcpuConfig())
+	if err != nil {
+		t.Fatalf("PageCount error: %v", err)
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 pages, got %d", n)
+	}
+
+	if err := MergePDFs(&merged); err == nil {
+		t.Fatal("expected an error when there is nothing to merge")
+	}
+}
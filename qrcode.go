@@ -0,0 +1,179 @@
+package pdf50tawi
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"net/url"
+	"strings"
+
+	"github.com/signintech/gopdf"
+	"rsc.io/qr"
+)
+
+// QRCode places a verification QR code on the certificate so recipients and
+// auditors can scan and cross-check it. The code is drawn as vector
+// rectangles, so it stays sharp at any print size.
+type QRCode struct {
+	// URLTemplate, when set, is encoded instead of VerificationPayload.
+	// The placeholders {bookNumber}, {documentNumber}, {payerTaxId},
+	// {payeeTaxId}, {totalAmountPaid}, {totalTaxWithheld} and {hash} are
+	// replaced with URL-escaped values, e.g.
+	//
+	//	https://verify.example.com/wht/{documentNumber}?h={hash}
+	URLTemplate string
+
+	// Pos, Dx and Dy locate the top-left corner of the code using the same
+	// anchor scheme as ImageField.
+	Pos Anchor
+	Dx  float64
+	Dy  float64
+
+	// Size is the side length in points, including the quiet zone.
+	Size float64
+}
+
+// DefaultQRCode places a 40pt code in the free top-right corner of the form,
+// above เล่มที่ / เลขที่.
+var DefaultQRCode = QRCode{Pos: TopRight, Dx: -44, Dy: -2, Size: 40}
+
+// qrQuietZone is the number of blank modules kept around the code.
+const qrQuietZone = 2
+
+// WithQRCode draws a verification QR code on the certificate.
+// A zero Size falls back to that of DefaultQRCode, and so does the position
+// when Pos, Dx and Dy are all zero.
+func WithQRCode(q QRCode) Option {
+	return func(o *issueOptions) {
+		if q.Size <= 0 {
+			q.Size = DefaultQRCode.Size
+		}
+		if q.Pos == TopLeft && q.Dx == 0 && q.Dy == 0 {
+			q.Pos, q.Dx, q.Dy = DefaultQRCode.Pos, DefaultQRCode.Dx, DefaultQRCode.Dy
+		}
+		o.qrCode = &q
+	}
+}
+
+// VerificationHash returns the hex SHA-256 of the certificate's TaxInfo JSON.
+// It changes whenever any field on the certificate changes; the image sources
+// in Certification are not part of it.
+func VerificationHash(t TaxInfo) string {
+	data, _ := json.Marshal(t.withoutImageSources()) // TaxInfo only holds strings and bools
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// VerificationPayload returns the pipe-separated text encoded in the QR code
+// when no URL template is configured:
+//
+//	50TAWI|1|bookNumber|documentNumber|payerTaxId|payeeTaxId|totalAmountPaid|totalTaxWithheld|hash
+//
+// The hash is the first 32 hex digits of VerificationHash.
+func VerificationPayload(t TaxInfo) string {
+	return strings.Join([]string{
+		"50TAWI", "1",
+		t.DocumentDetails.BookNumber,
+		t.DocumentDetails.DocumentNumber,
+		stripSpaces(t.Payer.TaxID),
+		stripSpaces(t.Payee.TaxID),
+		t.Totals.TotalAmountPaid,
+		t.Totals.TotalTaxWithheld,
+		VerificationHash(t)[:32],
+	}, "|")
+}
+
+// content returns the text to encode for t.
+func (q QRCode) content(t TaxInfo) string {
+	if q.URLTemplate == "" {
+		return VerificationPayload(t)
+	}
+	r := strings.NewReplacer(
+		"{bookNumber}", url.QueryEscape(t.DocumentDetails.BookNumber),
+		"{documentNumber}", url.QueryEscape(t.DocumentDetails.DocumentNumber),
+		"{payerTaxId}", url.QueryEscape(stripSpaces(t.Payer.TaxID)),
+		"{payeeTaxId}", url.QueryEscape(stripSpaces(t.Payee.TaxID)),
+		"{totalAmountPaid}", url.QueryEscape(t.Totals.TotalAmountPaid),
+		"{totalTaxWithheld}", url.QueryEscape(t.Totals.TotalTaxWithheld),
+		"{hash}", VerificationHash(t),
+	)
+	return r.Replace(q.URLTemplate)
+}
+
+// overlay encodes the QR code for t and returns it as a page overlay.
+func (q QRCode) overlay(t TaxInfo) (overlay, error) {
+	code, err := qr.Encode(q.content(t), qr.M)
+	if err != nil {
+		return overlay{}, fmt.Errorf("encode QR code: %w", err)
+	}
+	return overlay{
+		draw: func(pdf *gopdf.GoPdf) error {
+			return drawQRCode(pdf, code, q)
+		},
+		raster: func(p *rasterPage) error {
+			paintQRCode(p, code, q)
+			return nil
+		},
+	}, nil
+}
+
+// drawQRCode paints a white quiet zone and then one filled rectangle per
+// horizontal run of dark modules.
+func drawQRCode(pdf *gopdf.GoPdf, code *qr.Code, q QRCode) error {
+	x, y := anchorToXY(q.Pos, q.Dx, q.Dy)
+	module := q.Size / float64(code.Size+2*qrQuietZone)
+	originX := x + qrQuietZone*module
+	originY := y + qrQuietZone*module
+
+	pdf.SetFillColor(255, 255, 255)
+	pdf.RectFromUpperLeftWithStyle(x, y, q.Size, q.Size, "F")
+
+	pdf.SetFillColor(0, 0, 0)
+	for row := 0; row < code.Size; row++ {
+		for col := 0; col < code.Size; {
+			if !code.Black(col, row) {
+				col++
+				continue
+			}
+			start := col
+			for col < code.Size && code.Black(col, row) {
+				col++
+			}
+			pdf.RectFromUpperLeftWithStyle(
+				originX+float64(start)*module, originY+float64(row)*module,
+				float64(col-start)*module, module, "F")
+		}
+	}
+	return nil
+}
+
+// paintQRCode is the raster counterpart of drawQRCode. All dark modules go
+// into one path so neighbouring modules join without anti-aliasing seams.
+func paintQRCode(p *rasterPage, code *qr.Code, q QRCode) {
+	x, y := anchorToXY(q.Pos, q.Dx, q.Dy)
+	module := q.Size / float64(code.Size+2*qrQuietZone)
+	originX := x + qrQuietZone*module
+	originY := y + qrQuietZone*module
+
+	p.fill(p.rect(nil, x, y, q.Size, q.Size), color.White)
+
+	var path []segment
+	for row := 0; row < code.Size; row++ {
+		for col := 0; col < code.Size; {
+			if !code.Black(col, row) {
+				col++
+				continue
+			}
+			start := col
+			for col < code.Size && code.Black(col, row) {
+				col++
+			}
+			path = p.rect(path,
+				originX+float64(start)*module, originY+float64(row)*module,
+				float64(col-start)*module, module)
+		}
+	}
+	p.fill(path, color.Black)
+}
@@ -0,0 +1,92 @@
+package pdf50tawi
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestVerificationPayload(t *testing.T) {
+	tax := sampleTaxInfo()
+	payload := VerificationPayload(tax)
+
+	parts := strings.Split(payload, "|")
+	want := []string{"50TAWI", "1", "B-001", "D-002", "1234567890123", "9876543210987", "4500.00", "450.00"}
+	if len(parts) != len(want)+1 {
+		t.Fatalf("expected %d parts, got %d: %q", len(want)+1, len(parts), payload)
+	}
+	for i, w := range want {
+		if parts[i] != w {
+			t.Fatalf("part %d: got %q, want %q", i, parts[i], w)
+		}
+	}
+	if hash := parts[len(parts)-1]; hash != VerificationHash(tax)[:32] {
+		t.Fatalf("unexpected hash part %q", hash)
+	}
+}
+
+func TestVerificationHash(t *testing.T) {
+	tax := sampleTaxInfo()
+	if VerificationHash(tax) != VerificationHash(sampleTaxInfo()) {
+		t.Fatal("expected a stable hash for identical input")
+	}
+	tax.Totals.TotalTaxWithheld = "451.00"
+	if VerificationHash(tax) == VerificationHash(sampleTaxInfo()) {
+		t.Fatal("expected the hash to change when a field changes")
+	}
+	tax = sampleTaxInfo()
+	tax.Certification.PayerSignatureImage = &ImageSource{SourceType: ImageSourceAsset, Value: "sign"}
+	if VerificationHash(tax) != VerificationHash(sampleTaxInfo()) {
+		t.Fatal("expected the image sources to be left out of the hash")
+	}
+}
+
+func TestQRCodeContentURLTemplate(t *testing.T) {
+	tax := sampleTaxInfo()
+	tax.DocumentDetails.DocumentNumber = "2568/001"
+	q := QRCode{URLTemplate: "https://verify.example.com/wht/{documentNumber}?payer={payerTaxId}&h={hash}"}
+
+	got := q.content(tax)
+	want := "https://verify.example.com/wht/2568%2F001?payer=1234567890123&h=" + VerificationHash(tax)
+	if got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestIssueWHTCertificatePDFWithQRCode(t *testing.T) {
+	var plain, withQR bytes.Buffer
+	if err := IssueWHTCertificatePDF(&plain, sampleTaxInfo(), nil, nil); err != nil {
+		t.Fatalf("IssueWHTCertificatePDF error: %v", err)
+	}
+	if err := IssueWHTCertificatePDF(&withQR, sampleTaxInfo(), nil, nil, WithQRCode(QRCode{})); err != nil {
+		t.Fatalf("IssueWHTCertificatePDF with QR error: %v", err)
+	}
+	if !bytes.HasPrefix(withQR.Bytes(), []byte("%PDF")) {
+		t.Fatal("output does not look like a PDF")
+	}
+	if withQR.Len() <= plain.Len() {
+		t.Fatalf("expected the QR code to add content: %d <= %d bytes", withQR.Len(), plain.Len())
+	}
+}
+
+func TestWithQRCodeDefaults(t *testing.T) {
+	testCases := []struct {
+		name string
+		in   QRCode
+		want QRCode
+	}{
+		{"Zero", QRCode{}, DefaultQRCode},
+		{"PositionOnly", QRCode{Pos: BottomLeft, Dx: 20, Dy: 30}, QRCode{Pos: BottomLeft, Dx: 20, Dy: 30, Size: DefaultQRCode.Size}},
+		{"OffsetOnly", QRCode{Dx: 20}, QRCode{Dx: 20, Size: DefaultQRCode.Size}},
+		{"SizeOnly", QRCode{Size: 60}, QRCode{Pos: DefaultQRCode.Pos, Dx: DefaultQRCode.Dx, Dy: DefaultQRCode.Dy, Size: 60}},
+		{"Explicit", QRCode{Pos: Center, Dy: 10, Size: 50}, QRCode{Pos: Center, Dy: 10, Size: 50}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			o := newIssueOptions([]Option{WithQRCode(tc.in)})
+			if *o.qrCode != tc.want {
+				t.Fatalf("got %+v, want %+v", *o.qrCode, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,361 @@
+package pdf50tawi
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"sync"
+
+	"github.com/signintech/gopdf"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/f32"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/image/vector"
+)
+
+// The raster renderer draws previews without a PDF engine. The template
+// background is pre-rasterised from the PDF form; regenerate it whenever
+// form/tax50tawiTemplate.pdf changes (requires MuPDF):
+//
+//go:generate go run -C tools/rasterize . ../../form/tax50tawiTemplate.pdf ../../form/tax50tawiTemplate.png 200
+
+// templateDPI is the resolution form/tax50tawiTemplate.png was rendered at.
+const templateDPI = 200
+
+// MaxRenderDPI caps the resolution of raster previews. At 300 DPI the page is
+// 2480×3508 pixels.
+const MaxRenderDPI = 300
+
+var (
+	rasterTplOnce sync.Once
+	rasterTpl     image.Image
+	rasterTplErr  error
+)
+
+// rasterTemplate decodes the embedded template background exactly once.
+func rasterTemplate() (image.Image, error) {
+	rasterTplOnce.Do(func() {
+		b, err := form.ReadFile("form/tax50tawiTemplate.png")
+		if err != nil {
+			rasterTplErr = err
+			return
+		}
+		rasterTpl, rasterTplErr = png.Decode(bytes.NewReader(b))
+		if rasterTplErr != nil {
+			rasterTplErr = fmt.Errorf("decode template background: %w", rasterTplErr)
+		}
+	})
+	return rasterTpl, rasterTplErr
+}
+
+var (
+	rasterFontOnce sync.Once
+	rasterFont     *sfnt.Font
+	rasterFontErr  error
+)
+
+// thaiFont parses the embedded THSarabunNew font exactly once.
+func thaiFont() (*sfnt.Font, error) {
+	rasterFontOnce.Do(func() {
+		rasterFont, rasterFontErr = sfnt.Parse(thSarabunFontData)
+		if rasterFontErr != nil {
+			rasterFontErr = fmt.Errorf("parse Thai font: %w", rasterFontErr)
+		}
+	})
+	return rasterFont, rasterFontErr
+}
+
+// RenderCertificateImage draws the filled certificate at dpi dots per inch,
+// e.g. for a thumbnail before issuance. Text, images, checkmarks and
+// overlays such as WithQRCode and WithWatermark use the same layout as the
+// PDF. Options that only affect the PDF file, such as WithEncryption, are
+// ignored.
+func RenderCertificateImage(taxInfo TaxInfo, sign io.Reader, logo io.Reader, dpi float64, opts ...Option) (*image.RGBA, error) {
+	if dpi <= 0 || dpi > MaxRenderDPI {
+		return nil, fmt.Errorf("dpi must be greater than 0 and at most %d, got %g", MaxRenderDPI, dpi)
+	}
+	overlays, err := newIssueOptions(opts).overlays(taxInfo)
+	if err != nil {
+		return nil, err
+	}
+	return renderCertificate(TextFieldsFromTaxInfo(taxInfo), CertificateImageFields(sign, logo), dpi, overlays...)
+}
+
+// RenderCertificatePNG writes the filled certificate as a PNG image.
+// See RenderCertificateImage.
+func RenderCertificatePNG(out io.Writer, taxInfo TaxInfo, sign io.Reader, logo io.Reader, dpi float64, opts ...Option) error {
+	img, err := RenderCertificateImage(taxInfo, sign, logo, dpi, opts...)
+	if err != nil {
+		return err
+	}
+	return png.Encode(out, img)
+}
+
+// renderCertificate is the raster counterpart of fillCertificate and draws
+// in the same order.
+func renderCertificate(textFields []TextField, imageFields []ImageField, dpi float64, overlays ...overlay) (*image.RGBA, error) {
+	tpl, err := rasterTemplate()
+	if err != nil {
+		return nil, err
+	}
+	f, err := thaiFont()
+	if err != nil {
+		return nil, err
+	}
+
+	p := newRasterPage(f, dpi)
+	p.background(tpl)
+
+	if err := paintOverlays(p, overlays, true); err != nil {
+		return nil, err
+	}
+
+	for _, img := range imageFields {
+		p.image(img)
+	}
+
+	for _, field := range textFields {
+		if err := p.textField(field); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := paintOverlays(p, overlays, false); err != nil {
+		return nil, err
+	}
+	return p.img, nil
+}
+
+func paintOverlays(p *rasterPage, overlays []overlay, behind bool) error {
+	for _, o := range overlays {
+		if o.behind != behind || o.raster == nil {
+			continue
+		}
+		if err := o.raster(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rasterPage is a page-sized canvas addressed in points with gopdf's axes
+// (y down from the top-left corner).
+type rasterPage struct {
+	img   *image.RGBA
+	scale float64 // pixels per point
+	font  *sfnt.Font
+	buf   sfnt.Buffer
+	rz    vector.Rasterizer
+
+	// rotation set by rotate
+	sin, cos float64
+	cx, cy   float64
+}
+
+// segment is one path operation in pixel coordinates.
+type segment struct {
+	op   sfnt.SegmentOp
+	args [3]f32.Vec2
+}
+
+func newRasterPage(f *sfnt.Font, dpi float64) *rasterPage {
+	scale := dpi / 72
+	w := int(math.Round(pageWidth * scale))
+	h := int(math.Round(pageHeight * scale))
+	return &rasterPage{img: image.NewRGBA(image.Rect(0, 0, w, h)), scale: scale, font: f, cos: 1}
+}
+
+// rotate turns everything drawn afterwards counter-clockwise by angle
+// degrees around (cx, cy), like gopdf.Rotate. rotate(0, 0, 0) resets it.
+func (p *rasterPage) rotate(angle, cx, cy float64) {
+	p.sin, p.cos = math.Sincos(angle * math.Pi / 180)
+	p.cx, p.cy = cx, cy
+}
+
+// point maps page coordinates to pixels.
+func (p *rasterPage) point(x, y float64) f32.Vec2 {
+	dx, dy := x-p.cx, y-p.cy
+	x, y = p.cx+dx*p.cos+dy*p.sin, p.cy-dx*p.sin+dy*p.cos
+	return f32.Vec2{float32(x * p.scale), float32(y * p.scale)}
+}
+
+func (p *rasterPage) background(tpl image.Image) {
+	if tpl.Bounds().Size() == p.img.Bounds().Size() {
+		draw.Draw(p.img, p.img.Bounds(), tpl, tpl.Bounds().Min, draw.Src)
+		return
+	}
+	draw.CatmullRom.Scale(p.img, p.img.Bounds(), tpl, tpl.Bounds(), draw.Src, nil)
+}
+
+// rect appends a w×h rectangle with its upper-left corner at (x, y).
+func (p *rasterPage) rect(path []segment, x, y, w, h float64) []segment {
+	return p.polygon(path, []gopdf.Point{{X: x, Y: y}, {X: x + w, Y: y}, {X: x + w, Y: y + h}, {X: x, Y: y + h}})
+}
+
+// polygon appends a closed polygon.
+func (p *rasterPage) polygon(path []segment, pts []gopdf.Point) []segment {
+	for i, pt := range pts {
+		op := sfnt.SegmentOpLineTo
+		if i == 0 {
+			op = sfnt.SegmentOpMoveTo
+		}
+		path = append(path, segment{op: op, args: [3]f32.Vec2{p.point(pt.X, pt.Y)}})
+	}
+	return path
+}
+
+// fill paints path with c, rasterising only the path's bounding box.
+func (p *rasterPage) fill(path []segment, c color.Color) {
+	minX, minY := float32(math.MaxFloat32), float32(math.MaxFloat32)
+	maxX, maxY := float32(-math.MaxFloat32), float32(-math.MaxFloat32)
+	for _, s := range path {
+		for _, a := range s.args[:segmentArgs(s.op)] {
+			if a[0] < minX {
+				minX = a[0]
+			}
+			if a[0] > maxX {
+				maxX = a[0]
+			}
+			if a[1] < minY {
+				minY = a[1]
+			}
+			if a[1] > maxY {
+				maxY = a[1]
+			}
+		}
+	}
+	r := image.Rect(
+		int(math.Floor(float64(minX))), int(math.Floor(float64(minY))),
+		int(math.Ceil(float64(maxX))), int(math.Ceil(float64(maxY))),
+	).Intersect(p.img.Bounds())
+	if r.Empty() {
+		return
+	}
+
+	ox, oy := float32(r.Min.X), float32(r.Min.Y)
+	p.rz.Reset(r.Dx(), r.Dy())
+	p.rz.DrawOp = draw.Over
+	for _, s := range path {
+		a := s.args
+		switch s.op {
+		case sfnt.SegmentOpMoveTo:
+			p.rz.ClosePath()
+			p.rz.MoveTo(a[0][0]-ox, a[0][1]-oy)
+		case sfnt.SegmentOpLineTo:
+			p.rz.LineTo(a[0][0]-ox, a[0][1]-oy)
+		case sfnt.SegmentOpQuadTo:
+			p.rz.QuadTo(a[0][0]-ox, a[0][1]-oy, a[1][0]-ox, a[1][1]-oy)
+		case sfnt.SegmentOpCubeTo:
+			p.rz.CubeTo(a[0][0]-ox, a[0][1]-oy, a[1][0]-ox, a[1][1]-oy, a[2][0]-ox, a[2][1]-oy)
+		}
+	}
+	p.rz.ClosePath()
+	p.rz.Draw(p.img, r, image.NewUniform(c), image.Point{})
+}
+
+func segmentArgs(op sfnt.SegmentOp) int {
+	switch op {
+	case sfnt.SegmentOpQuadTo:
+		return 2
+	case sfnt.SegmentOpCubeTo:
+		return 3
+	}
+	return 1
+}
+
+func (p *rasterPage) fillRect(x, y, w, h float64, c color.Color) {
+	p.fill(p.rect(nil, x, y, w, h), c)
+}
+
+// measure returns the advance width of s in points, like
+// gopdf.MeasureTextWidth.
+func (p *rasterPage) measure(s string, size float64) (float64, error) {
+	ppem := fixed.Int26_6(math.Round(size * 64))
+	var w fixed.Int26_6
+	for _, r := range s {
+		idx, err := p.font.GlyphIndex(&p.buf, r)
+		if err != nil {
+			return 0, fmt.Errorf("glyph %q: %w", r, err)
+		}
+		adv, err := p.font.GlyphAdvance(&p.buf, idx, ppem, font.HintingNone)
+		if err != nil {
+			return 0, fmt.Errorf("glyph %q: %w", r, err)
+		}
+		w += adv
+	}
+	return float64(w) / 64, nil
+}
+
+// text draws s starting at x with its baseline at y. Glyphs are placed by
+// advance width without kerning, as gopdf does.
+func (p *rasterPage) text(s string, size, x, y float64, c color.Color) error {
+	ppem := fixed.Int26_6(math.Round(size * 64))
+	var path []segment
+	for _, r := range s {
+		idx, err := p.font.GlyphIndex(&p.buf, r)
+		if err != nil {
+			return fmt.Errorf("glyph %q: %w", r, err)
+		}
+		segs, err := p.font.LoadGlyph(&p.buf, idx, ppem, nil)
+		if err != nil {
+			return fmt.Errorf("glyph %q: %w", r, err)
+		}
+		for _, seg := range segs {
+			s := segment{op: seg.Op}
+			for i := range segmentArgs(seg.Op) {
+				s.args[i] = p.point(x+float64(seg.Args[i].X)/64, y+float64(seg.Args[i].Y)/64)
+			}
+			path = append(path, s)
+		}
+		adv, err := p.font.GlyphAdvance(&p.buf, idx, ppem, font.HintingNone)
+		if err != nil {
+			return fmt.Errorf("glyph %q: %w", r, err)
+		}
+		x += float64(adv) / 64
+	}
+	p.fill(path, c)
+	return nil
+}
+
+// textField is the raster counterpart of placeText.
+func (p *rasterPage) textField(field TextField) error {
+	x, y := anchorToXY(field.Position, field.Dx, field.Dy)
+	size := float64(field.FontSize)
+
+	if field.Text == "✓" {
+		p.fill(p.polygon(nil, checkmarkOutline(x, y, size)), color.Black)
+		return nil
+	}
+
+	w, err := p.measure(field.Text, size)
+	if err != nil {
+		return err
+	}
+	return p.text(field.Text, size, alignX(field.Position, x, w), y, color.Black)
+}
+
+// image is the raster counterpart of placeImage. Invalid or empty images are
+// skipped.
+func (p *rasterPage) image(field ImageField) {
+	if field.Reader == nil {
+		return
+	}
+	src, _, err := image.Decode(field.Reader)
+	if err != nil || src.Bounds().Empty() {
+		return
+	}
+
+	x, y, w, h := imageBox(field, src.Bounds().Dx(), src.Bounds().Dy())
+	tl, br := p.point(x, y), p.point(x+w, y+h)
+	r := image.Rect(
+		int(math.Round(float64(tl[0]))), int(math.Round(float64(tl[1]))),
+		int(math.Round(float64(br[0]))), int(math.Round(float64(br[1]))),
+	)
+	draw.CatmullRom.Scale(p.img, r, src, src.Bounds(), draw.Over, nil)
+}
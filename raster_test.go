@@ -0,0 +1,75 @@
+package pdf50tawi
+
+import (
+	"bytes"
+	"image/png"
+	"testing"
+
+	"rsc.io/qr"
+)
+
+func TestRenderCertificateImageSize(t *testing.T) {
+	for _, tc := range []struct {
+		dpi  float64
+		w, h int
+	}{
+		{dpi: 72, w: 595, h: 842},
+		{dpi: templateDPI, w: 1654, h: 2339},
+	} {
+		img, err := RenderCertificateImage(sampleTaxInfo(), nil, nil, tc.dpi)
+		if err != nil {
+			t.Fatalf("dpi %v: RenderCertificateImage error: %v", tc.dpi, err)
+		}
+		if b := img.Bounds(); b.Dx() != tc.w || b.Dy() != tc.h {
+			t.Fatalf("dpi %v: got %dx%d, want %dx%d", tc.dpi, b.Dx(), b.Dy(), tc.w, tc.h)
+		}
+	}
+}
+
+func TestRenderCertificateImageInvalidDPI(t *testing.T) {
+	for _, dpi := range []float64{0, -10, MaxRenderDPI + 1} {
+		if _, err := RenderCertificateImage(sampleTaxInfo(), nil, nil, dpi); err == nil {
+			t.Fatalf("dpi %v: expected an error", dpi)
+		}
+	}
+}
+
+func TestRenderCertificateImageDrawsFields(t *testing.T) {
+	blank, err := RenderCertificateImage(TaxInfo{}, nil, nil, 72)
+	if err != nil {
+		t.Fatalf("RenderCertificateImage error: %v", err)
+	}
+	filled, err := RenderCertificateImage(sampleTaxInfo(), nil, nil, 72, WithQRCode(QRCode{}))
+	if err != nil {
+		t.Fatalf("RenderCertificateImage error: %v", err)
+	}
+	if bytes.Equal(blank.Pix, filled.Pix) {
+		t.Fatal("expected the filled certificate to differ from the blank form")
+	}
+
+	// The QR code's finder pattern starts two modules in from its corner.
+	x, y := anchorToXY(DefaultQRCode.Pos, DefaultQRCode.Dx, DefaultQRCode.Dy)
+	code, err := qr.Encode(DefaultQRCode.content(sampleTaxInfo()), qr.M)
+	if err != nil {
+		t.Fatalf("encode QR code: %v", err)
+	}
+	module := DefaultQRCode.Size / float64(code.Size+2*qrQuietZone)
+	px, py := int(x+2.5*module), int(y+2.5*module)
+	if r, _, _, _ := filled.At(px, py).RGBA(); r > 0x4000 {
+		t.Fatalf("expected a dark QR module at (%d, %d)", px, py)
+	}
+}
+
+func TestRenderCertificatePNG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := RenderCertificatePNG(&buf, sampleTaxInfo(), nil, nil, 50, WithWatermark(DraftWatermark())); err != nil {
+		t.Fatalf("RenderCertificatePNG error: %v", err)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatalf("decode PNG: %v", err)
+	}
+	if img.Bounds().Dx() != 413 {
+		t.Fatalf("unexpected width %d", img.Bounds().Dx())
+	}
+}
@@ -0,0 +1,67 @@
+package pdf50tawi
+
+import (
+	"errors"
+	"strings"
+)
+
+// A certificate with a mistake is not corrected in place: it is cancelled
+// (ยกเลิก), and a corrected certificate is issued under a new เลขที่ that
+// refers back to it. The cancelled copy is the original stamped with
+// VoidWatermark; the replacement records the link with WithReplaces.
+
+// Replaces identifies the cancelled certificate that a replacement is issued
+// in place of.
+type Replaces struct {
+	// ID is the cancelled certificate's id in the issuer's records, if any.
+	ID string `json:"id,omitempty"`
+
+	BookNumber     string `json:"bookNumber,omitempty"`
+	DocumentNumber string `json:"documentNumber,omitempty"`
+
+	// Reason the original was cancelled.
+	Reason string `json:"reason,omitempty"`
+}
+
+// ReplacesCertificate returns the reference to original, cancelled for
+// reason, for WithReplaces.
+func ReplacesCertificate(original TaxInfo, reason string) Replaces {
+	return Replaces{
+		BookNumber:     original.DocumentDetails.BookNumber,
+		DocumentNumber: original.DocumentDetails.DocumentNumber,
+		Reason:         reason,
+	}
+}
+
+// WithReplaces records in the embedded metadata that the certificate
+// replaces the cancelled one r, so ReadMetadata returns it in
+// Metadata.Replaces. It implies WithMetadata.
+func WithReplaces(r Replaces) Option {
+	return func(o *issueOptions) {
+		o.metadata = true
+		o.replaces = &r
+	}
+}
+
+// ErrSameDocumentNumber is returned by CheckReplacement for a replacement
+// that keeps the เล่มที่ and เลขที่ of the certificate it replaces.
+var ErrSameDocumentNumber = errors.New("a replacement certificate needs a new document number")
+
+// CheckReplacement reports whether replacement may be issued in place of
+// original: it must be for the same payer and have a document number of its
+// own. With automatic numbering, call it before Numbering.Assign too, so a
+// replacement for another payer takes no number: until Assign fills in an
+// empty document number, that check returns ErrSameDocumentNumber.
+func CheckReplacement(original, replacement TaxInfo) error {
+	if stripSpaces(original.Payer.TaxID) != stripSpaces(replacement.Payer.TaxID) ||
+		stripSpaces(original.Payer.TaxID10Digit) != stripSpaces(replacement.Payer.TaxID10Digit) {
+		return errors.New("a replacement certificate must be for the same payer")
+	}
+	o, r := original.DocumentDetails, replacement.DocumentDetails
+	if strings.TrimSpace(r.DocumentNumber) == "" ||
+		(strings.TrimSpace(o.BookNumber) == strings.TrimSpace(r.BookNumber) &&
+			strings.TrimSpace(o.DocumentNumber) == strings.TrimSpace(r.DocumentNumber)) {
+		return ErrSameDocumentNumber
+	}
+	return nil
+}
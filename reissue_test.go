@@ -0,0 +1,68 @@
+package pdf50tawi
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestWithReplaces(t *testing.T) {
+	original := sampleTaxInfo()
+	corrected := sampleTaxInfo()
+	corrected.DocumentDetails.DocumentNumber = "D-003"
+	corrected.Payee.Name = "Jane Doe"
+	if err := CheckReplacement(original, corrected); err != nil {
+		t.Fatalf("CheckReplacement: %v", err)
+	}
+
+	r := ReplacesCertificate(original, "ชื่อผู้ถูกหักภาษีผิด")
+	r.ID = "a1b2"
+	var out bytes.Buffer
+	if err := IssueWHTCertificatePDF(&out, corrected, nil, nil, WithReplaces(r)); err != nil {
+		t.Fatalf("IssueWHTCertificatePDF error: %v", err)
+	}
+	m, err := ReadMetadata(bytes.NewReader(out.Bytes()), "")
+	if err != nil {
+		t.Fatalf("ReadMetadata error: %v", err)
+	}
+	if m.Replaces == nil || *m.Replaces != r {
+		t.Fatalf("Replaces = %+v, want %+v", m.Replaces, r)
+	}
+	if m.TaxInfo.DocumentDetails.DocumentNumber != "D-003" {
+		t.Fatalf("embedded document number %q", m.TaxInfo.DocumentDetails.DocumentNumber)
+	}
+}
+
+func TestCheckReplacement(t *testing.T) {
+	original := sampleTaxInfo()
+	testCases := []struct {
+		name string
+		edit func(*TaxInfo)
+		same bool // want ErrSameDocumentNumber
+	}{
+		{"SameNumber", func(*TaxInfo) {}, true},
+		{"SameNumberSpaces", func(t *TaxInfo) { t.DocumentDetails.DocumentNumber = " D-002 " }, true},
+		{"NoNumber", func(t *TaxInfo) { t.DocumentDetails.DocumentNumber = "" }, true},
+		{"OtherPayer", func(t *TaxInfo) {
+			t.Payer.TaxID = "0105551234567"
+			t.DocumentDetails.DocumentNumber = "D-003"
+		}, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			replacement := sampleTaxInfo()
+			tc.edit(&replacement)
+			err := CheckReplacement(original, replacement)
+			if err == nil || errors.Is(err, ErrSameDocumentNumber) != tc.same {
+				t.Fatalf("got %v", err)
+			}
+		})
+	}
+
+	// A new book with the same document number is a new number.
+	replacement := sampleTaxInfo()
+	replacement.DocumentDetails.BookNumber = "B-002"
+	if err := CheckReplacement(original, replacement); err != nil {
+		t.Fatalf("new book: %v", err)
+	}
+}
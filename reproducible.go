@@ -0,0 +1,168 @@
+package pdf50tawi
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// producer is written to the document information dictionary.
+const producer = "pdf50tawi"
+
+// WithReproducibleOutput makes identical input produce byte-identical PDFs,
+// so the output can be used for golden-file tests and content-addressed
+// storage.
+//
+// Objects are renumbered in a canonical order, the document ID is derived
+// from the content hash and the creation date is taken from
+// Certification.DateOfIssuance (the Unix epoch when it cannot be parsed).
+// It cannot be combined with WithEncryption, which uses random IVs.
+func WithReproducibleOutput() Option {
+	return func(o *issueOptions) { o.reproducible = true }
+}
+
+// reproducibleDate returns the document date used in reproducible mode.
+func reproducibleDate(t TaxInfo) time.Time {
+	if d, err := t.Certification.DateOfIssuance.Time(); err == nil {
+		return d
+	}
+	return time.Unix(0, 0).UTC()
+}
+
+// writeReproducible rewrites pdf into canonical form: objects are numbered in
+// depth-first order from the catalog with dictionary keys sorted, unreachable
+// objects are dropped and the trailer ID is the SHA-256 of the body. props are
+// added to the rebuilt document information dictionary.
+//
+// gopdf imports the template through gofpdi, which walks resource dictionaries
+// in Go map order, so the raw output differs from run to run.
+func writeReproducible(pdf []byte, out io.Writer, date time.Time, props map[string]string) error {
+	ctx, err := api.ReadContext(bytes.NewReader(pdf), pdfcpuConfig())
+	if err != nil {
+		return fmt.Errorf("read certificate: %w", err)
+	}
+	if ctx.Root == nil {
+		return fmt.Errorf("read certificate: missing catalog")
+	}
+
+	c := canonicalizer{table: ctx.XRefTable, numbers: map[int]int{}}
+	root := c.visit(*ctx.Root)
+
+	info := types.NewDict()
+	info.InsertString("Producer", producer)
+	info.InsertString("CreationDate", types.DateString(date))
+	info.InsertString("ModDate", types.DateString(date))
+	if err := insertProperties(info, props); err != nil {
+		return err
+	}
+	c.objects = append(c.objects, info)
+	infoRef := len(c.objects)
+
+	var body bytes.Buffer
+	body.WriteString("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(c.objects))
+	for i, obj := range c.objects {
+		offsets[i] = body.Len()
+		fmt.Fprintf(&body, "%d 0 obj\n", i+1)
+		if sd, ok := obj.(types.StreamDict); ok {
+			body.WriteString(sd.Dict.PDFString())
+			body.WriteString("\nstream\n")
+			body.Write(sd.Raw)
+			body.WriteString("\nendstream")
+		} else {
+			body.WriteString(obj.PDFString())
+		}
+		body.WriteString("\nendobj\n")
+	}
+
+	sum := sha256.Sum256(body.Bytes())
+	id := hex.EncodeToString(sum[:16])
+
+	xref := body.Len()
+	fmt.Fprintf(&body, "xref\n0 %d\n0000000000 65535 f \n", len(c.objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&body, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&body, "trailer\n<</ID [<%s> <%s>] /Info %d 0 R /Root %s /Size %d>>\n",
+		id, id, infoRef, root.PDFString(), len(c.objects)+1)
+	fmt.Fprintf(&body, "startxref\n%d\n%%%%EOF\n", xref)
+
+	_, err = out.Write(body.Bytes())
+	return err
+}
+
+// canonicalizer assigns new object numbers in visiting order and collects the
+// renumbered objects.
+type canonicalizer struct {
+	table   *model.XRefTable
+	numbers map[int]int // old object number → new object number
+	objects []types.Object
+}
+
+func (c *canonicalizer) visit(obj types.Object) types.Object {
+	switch v := obj.(type) {
+	case types.IndirectRef:
+		old := v.ObjectNumber.Value()
+		if n, ok := c.numbers[old]; ok {
+			return *types.NewIndirectRef(n, 0)
+		}
+		n := len(c.objects) + 1
+		c.numbers[old] = n
+		c.objects = append(c.objects, nil) // reserve the slot before descending
+		var target types.Object
+		if entry, ok := c.table.Table[old]; ok && !entry.Free {
+			target = entry.Object
+		}
+		c.objects[n-1] = c.visitObject(target)
+		return *types.NewIndirectRef(n, 0)
+	case types.Dict:
+		return c.visitDict(v)
+	case types.Array:
+		a := make(types.Array, len(v))
+		for i, e := range v {
+			a[i] = c.visit(e)
+		}
+		return a
+	default:
+		return obj
+	}
+}
+
+// visitObject handles the direct object stored under an object number.
+func (c *canonicalizer) visitObject(obj types.Object) types.Object {
+	switch v := obj.(type) {
+	case nil:
+		return types.Dict{} // dangling reference; keep the number valid
+	case types.StreamDict:
+		d := v.Dict.Clone().(types.Dict)
+		delete(d, "Length") // may be an indirect reference; rewritten below
+		sd := v
+		sd.Dict = c.visitDict(d)
+		sd.Dict["Length"] = types.Integer(len(v.Raw))
+		return sd
+	default:
+		return c.visit(obj)
+	}
+}
+
+func (c *canonicalizer) visitDict(d types.Dict) types.Dict {
+	keys := make([]string, 0, len(d))
+	for k := range d {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	out := types.NewDict()
+	for _, k := range keys {
+		out[k] = c.visit(d[k])
+	}
+	return out
+}
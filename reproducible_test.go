@@ -0,0 +1,64 @@
+package pdf50tawi
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"testing"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+)
+
+func TestIssueWHTCertificatePDFReproducible(t *testing.T) {
+	issue := func(tax TaxInfo) []byte {
+		t.Helper()
+		var out bytes.Buffer
+		png := tinyEmptyPNG()
+		err := IssueWHTCertificatePDF(&out, tax, bytes.NewReader(png), bytes.NewReader(png), WithReproducibleOutput())
+		if err != nil {
+			t.Fatalf("IssueWHTCertificatePDF error: %v", err)
+		}
+		return out.Bytes()
+	}
+
+	first := issue(sampleTaxInfo())
+	for range 5 {
+		if next := issue(sampleTaxInfo()); sha256.Sum256(next) != sha256.Sum256(first) {
+			t.Fatal("expected identical output for identical input")
+		}
+	}
+
+	changed := sampleTaxInfo()
+	changed.Payee.Name = "Jane Doe"
+	if bytes.Equal(issue(changed), first) {
+		t.Fatal("expected different output for different input")
+	}
+
+	if _, err := api.ReadContext(bytes.NewReader(first), pdfcpuConfig()); err != nil {
+		t.Fatalf("reproducible output is not a readable PDF: %v", err)
+	}
+	if err := api.Validate(bytes.NewReader(first), pdfcpuConfig()); err != nil {
+		t.Fatalf("reproducible output does not validate: %v", err)
+	}
+}
+
+func TestIssueWHTCertificatePDFReproducibleRejectsEncryption(t *testing.T) {
+	err := IssueWHTCertificatePDF(io.Discard, sampleTaxInfo(), nil, nil,
+		WithReproducibleOutput(), WithEncryption(Encryption{UserPassword: "1234"}))
+	if err == nil {
+		t.Fatal("expected an error when combining reproducible output with encryption")
+	}
+}
+
+func TestReproducibleDate(t *testing.T) {
+	tax := sampleTaxInfo()
+	tax.Certification.DateOfIssuance = DateOfIssuance{Day: "22", Month: "ธันวาคม", Year: "2568"}
+	if got := reproducibleDate(tax).Format("2006-01-02"); got != "2025-12-22" {
+		t.Fatalf("got %s, want 2025-12-22", got)
+	}
+
+	tax.Certification.DateOfIssuance = DateOfIssuance{}
+	if got := reproducibleDate(tax); got.Unix() != 0 {
+		t.Fatalf("expected Unix epoch fallback, got %v", got)
+	}
+}
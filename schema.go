@@ -0,0 +1,15 @@
+package pdf50tawi
+
+import _ "embed"
+
+//go:generate go run ./tools/schemagen tax_info.go schema/taxinfo.schema.json
+
+//go:embed schema/taxinfo.schema.json
+var taxInfoSchema []byte
+
+// TaxInfoSchema returns the JSON Schema (draft 2020-12) of the TaxInfo JSON
+// accepted by the CLI and the REST API, with Thai/English descriptions of
+// every key. Its constraints match ValidateTaxInfo.
+func TaxInfoSchema() []byte {
+	return append([]byte(nil), taxInfoSchema...)
+}
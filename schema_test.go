@@ -0,0 +1,59 @@
+package pdf50tawi
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTaxInfoSchema(t *testing.T) {
+	var schema struct {
+		Schema     string                     `json:"$schema"`
+		Properties map[string]json.RawMessage `json:"properties"`
+		Defs       map[string]struct {
+			Properties map[string]json.RawMessage `json:"properties"`
+		} `json:"$defs"`
+	}
+	if err := json.Unmarshal(TaxInfoSchema(), &schema); err != nil {
+		t.Fatalf("schema is not valid JSON: %v", err)
+	}
+	if schema.Schema != "https://json-schema.org/draft/2020-12/schema" {
+		t.Errorf("unexpected $schema %q", schema.Schema)
+	}
+
+	type property struct {
+		Description string `json:"description"`
+		Ref         string `json:"$ref"`
+	}
+	// lookup resolves a JSON path such as "payee.pnd_3" through $ref.
+	lookup := func(path string) (property, bool) {
+		props := schema.Properties
+		var p property
+		for _, key := range strings.Split(path, ".") {
+			raw, ok := props[key]
+			if !ok {
+				return property{}, false
+			}
+			p = property{}
+			if err := json.Unmarshal(raw, &p); err != nil {
+				t.Fatalf("%s: %v", path, err)
+			}
+			if p.Ref != "" {
+				props = schema.Defs[strings.TrimPrefix(p.Ref, "#/$defs/")].Properties
+			}
+		}
+		return p, true
+	}
+
+	// Every TaxInfo key must be described; run `go generate` when this fails.
+	forEachLeaf(reflect.TypeOf(TaxInfo{}), "", nil, func(path string, _ []int) {
+		p, ok := lookup(path)
+		switch {
+		case !ok:
+			t.Errorf("schema is missing %s", path)
+		case p.Description == "":
+			t.Errorf("schema has no description for %s", path)
+		}
+	})
+}
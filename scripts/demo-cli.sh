@@ -21,7 +21,7 @@ echo " output    : $OUTPUT"
 echo "━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━"
 echo ""
 
-go run ./cmd/cli \
+go run ./cmd/cli render --demo \
   --signature "$SIGN" \
   --seal      "$SEAL" \
   --output    "$OUTPUT"
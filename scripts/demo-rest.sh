@@ -1,7 +1,7 @@
 #!/usr/bin/env bash
-# Demo: REST API — all three image-supply strategies.
+# Demo: REST API — the unified endpoint and all three image-supply strategies.
 #
-# Starts the server, runs all three strategies, then shuts down.
+# Starts the server, issues a certificate through each route, then shuts down.
 #
 # Usage (from repo root):
 #   ./scripts/demo-rest.sh
@@ -81,7 +81,9 @@ echo "━━━━━━━━━━━━━━━━━━━━━━━━
 echo " Starting REST server on port $PORT ..."
 echo "━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━"
 
-go run ./cmd/rest &>/tmp/pdf50tawi-rest.log &
+# Strategy C fetches from a local file server, which the URL fetcher refuses
+# unless private addresses are allowed.
+IMAGE_ALLOW_PRIVATE=true go run ./cmd/rest &>/tmp/pdf50tawi-rest.log &
 SERVER_PID=$!
 trap 'echo ""; echo "Stopping server (PID $SERVER_PID)..."; kill "$SERVER_PID" 2>/dev/null; wait "$SERVER_PID" 2>/dev/null; exit' EXIT
 
@@ -97,6 +99,31 @@ sleep 0.5
 echo " Server ready."
 echo ""
 
+# ── Unified endpoint: image sources described in certification ───────────────
+echo "━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━"
+echo " Unified — image sources in certification"
+echo " POST $HOST/api/v1/taxes"
+echo "━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━"
+
+TAX_INFO_UPLOAD=$(python3 - <<PYEOF
+import json
+tax_info = json.loads("""$TAX_INFO_JSON""")
+tax_info["certification"]["payerSignatureImage"] = {"sourceType": "upload", "value": "signatureImage"}
+tax_info["certification"]["companySealImage"] = {"sourceType": "upload", "value": "companySeal"}
+print(json.dumps(tax_info, ensure_ascii=False))
+PYEOF
+)
+
+curl -s -X POST "$HOST/api/v1/taxes" \
+  -F "taxInfo=$TAX_INFO_UPLOAD" \
+  -F "signatureImage=@$SIGN;type=image/png" \
+  -F "companySeal=@$SEAL;type=image/png" \
+  -o certificate-unified.pdf \
+  -w "HTTP %{http_code} — %{size_download} bytes\n"
+
+echo " Output: certificate-unified.pdf"
+echo ""
+
 # ── Strategy A: multipart/form-data ──────────────────────────────────────────
 echo "━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━"
 echo " Strategy A — multipart/form-data"
@@ -196,5 +223,5 @@ echo " Output: certificate-url.pdf"
 echo ""
 
 echo "━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━"
-echo " All three strategies completed successfully."
+echo " All routes completed successfully."
 echo "━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━"
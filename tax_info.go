@@ -1,99 +1,120 @@
 package pdf50tawi
 
+// The field comments below are the descriptions in schema/taxinfo.schema.json;
+// run `go generate -run schemagen` after changing them.
+
+// TaxInfo holds everything printed on หนังสือรับรองการหักภาษี ณ ที่จ่าย (50 ทวิ) / The data printed on the withholding tax certificate.
 type TaxInfo struct {
-	DocumentDetails DocumentDetails `json:"documentDetails"`
-	Payer           Payer           `json:"payer"`
-	Payee           Payee           `json:"payee"`
+	DocumentDetails DocumentDetails `json:"documentDetails"` // เล่มที่ / เลขที่ / Book and document number
+	Payer           Payer           `json:"payer"`           // ผู้มีหน้าที่หักภาษี ณ ที่จ่าย / The payer who withholds the tax
+	Payee           Payee           `json:"payee"`           // ผู้ถูกหักภาษี ณ ที่จ่าย / The payee whose income is withheld
 
-	Income40_1  IncomeDetail `json:"income40_1"`  // 1. เงินเดือน ค่าจาง เบี้ยเลี้ยง โบนัส ฯลฯ ตามมาตรา 40 (1)
-	Income40_2  IncomeDetail `json:"income40_2"`  // 2. ค่าธรรมเนียม ค่านายหน้า ฯลฯ ตามมาตรา 40 (2)
-	Income40_3  IncomeDetail `json:"income40_3"`  // 3. ค่าแห่งลิขสิทธิ์ ฯลฯ ตามมาตรา 40 (3)
-	Income40_4A IncomeDetail `json:"income40_4A"` // 4. (ก) ดอกเบี้ย ฯลฯ ตามมาตรา 40 (4) (ก)
+	Income40_1  IncomeDetail `json:"income40_1"`  // 1. เงินเดือน ค่าจาง เบี้ยเลี้ยง โบนัส ฯลฯ ตามมาตรา 40 (1) / Salaries, wages, allowances, bonuses, etc. under section 40 (1)
+	Income40_2  IncomeDetail `json:"income40_2"`  // 2. ค่าธรรมเนียม ค่านายหน้า ฯลฯ ตามมาตรา 40 (2) / Fees, commissions, etc. under section 40 (2)
+	Income40_3  IncomeDetail `json:"income40_3"`  // 3. ค่าแห่งลิขสิทธิ์ ฯลฯ ตามมาตรา 40 (3) / Copyright royalties, etc. under section 40 (3)
+	Income40_4A IncomeDetail `json:"income40_4A"` // 4. (ก) ดอกเบี้ย ฯลฯ ตามมาตรา 40 (4) (ก) / Interest, etc. under section 40 (4) (a)
 
 	// 4. (ข) เงินปันผล เงินส่วนแบ่งกำไร ฯลฯ ตามมาตรา 40 (4) (ข)
 	// 4. (ข) (1) (1) กรณีผู้ได้รับเงินปันผลได้รับเครดิตภาษี โดยจ่ายจาก
 	// กำไรสุทธิของกิจการที่ต้องเสียภาษีเงินได้นิติบุคคลในอัตราดังนี้
-	Income40_4B_1_1      IncomeDetail `json:"income40_4B_1_1"`      // 4. (ข) (1) (1.1) อัตราร้อยละ 30 ของกำไรสุทธิ
-	Income40_4B_1_2      IncomeDetail `json:"income40_4B_1_2"`      // 4. (ข) (1) (1.2) อัตราร้อยละ 25 ของกำไรสุทธิ
-	Income40_4B_1_3      IncomeDetail `json:"income40_4B_1_3"`      // 4. (ข) (1) (1.3) อัตราร้อยละ 20 ของกำไรสุทธิ
-	Income40_4B_1_4_Rate string       `json:"income40_4B_1_4_rate"` // 4. (ข) (1) (1.4) อัตราอื่น ๆ (ระบุ)... ของกำไรสุทธิ
-	Income40_4B_1_4      IncomeDetail `json:"income40_4B_1_4"`      // 4. (ข) (1) (1.4)
-	Income40_4B_2_1      IncomeDetail `json:"income40_4B_2_1"`      // 4. (ข) (2) (2.1) กำไรสุทธิของกิจการที่ได้รับยกเว้นภาษีเงินได้นิติบุคคล
-	Income40_4B_2_2      IncomeDetail `json:"income40_4B_2_2"`      // 4. (ข) (2) (2.2) เงินปันผลหรือเงินส่วนแบ่งของกำไรที่ได้รับยกเว้นไม่ต้องนำมารวม คำนวณเป็นรายได้เพื่อเสียภาษีเงินได้นิติบุคคล
-	Income40_4B_2_3      IncomeDetail `json:"income40_4B_2_3"`      // 4. (ข) (2) (2.3) กำไรสุทธิส่วนที่ได้หักผลขาดทุนสุทธิยกมาไม่เกิน 5 ปี ก่อนรอบระยะเวลาบัญชีปีปัจจุบัน
-	Income40_4B_2_4      IncomeDetail `json:"income40_4B_2_4"`      // 4. (ข) (2) (2.4)  กำไรที่รับรู้ทางบัญชีโดยวิธีส่วนได้เสีย (equity method)
-	Income40_4B_2_5_Note string       `json:"income40_4B_2_5_note"` // 4. (ข) (2) (2.5) อื่น ๆ (ระบุ)... ของกำไรสุทธิ
-	Income40_4B_2_5      IncomeDetail `json:"income40_4B_2_5"`      // 4. (ข) (2) (2.5)
-
-	Income5      IncomeDetail `json:"income5"`      // 5. การจ่ายเงินได้ที่ต้องหักภาษี ณ ที่จ่าย
-	Income6      IncomeDetail `json:"income6"`      // 6. อื่น ๆ (ระบุ)
-	Income6_Note string       `json:"income6_note"` // 6. อื่น ๆ (ระบุ)
-
-	Totals          Totals          `json:"totals"`          // รวมเงิน
-	OtherPayments   OtherPayments   `json:"otherPayments"`   // จ่ายภาษี
-	WithholdingType WithholdingType `json:"withholdingType"` // ประเภทการหักภาษี
-	Certification   Certification   `json:"certification"`   // การยืนยัน
+	Income40_4B_1_1      IncomeDetail `json:"income40_4B_1_1"`      // 4. (ข) (1) (1.1) อัตราร้อยละ 30 ของกำไรสุทธิ / Dividends with tax credit, from net profit taxed at 30%
+	Income40_4B_1_2      IncomeDetail `json:"income40_4B_1_2"`      // 4. (ข) (1) (1.2) อัตราร้อยละ 25 ของกำไรสุทธิ / Dividends with tax credit, from net profit taxed at 25%
+	Income40_4B_1_3      IncomeDetail `json:"income40_4B_1_3"`      // 4. (ข) (1) (1.3) อัตราร้อยละ 20 ของกำไรสุทธิ / Dividends with tax credit, from net profit taxed at 20%
+	Income40_4B_1_4_Rate string       `json:"income40_4B_1_4_rate"` // 4. (ข) (1) (1.4) อัตราอื่น ๆ (ระบุ)... ของกำไรสุทธิ / The other rate of 4. (b) (1) (1.4), e.g. "ร้อยละ 10"
+	Income40_4B_1_4      IncomeDetail `json:"income40_4B_1_4"`      // 4. (ข) (1) (1.4) / Dividends with tax credit, from net profit taxed at another rate
+	Income40_4B_2_1      IncomeDetail `json:"income40_4B_2_1"`      // 4. (ข) (2) (2.1) กำไรสุทธิของกิจการที่ได้รับยกเว้นภาษีเงินได้นิติบุคคล / Net profit of a business exempt from corporate income tax
+	Income40_4B_2_2      IncomeDetail `json:"income40_4B_2_2"`      // 4. (ข) (2) (2.2) เงินปันผลหรือเงินส่วนแบ่งของกำไรที่ได้รับยกเว้นไม่ต้องนำมารวม คำนวณเป็นรายได้เพื่อเสียภาษีเงินได้นิติบุคคล / Exempt dividends or profit shares not included in taxable corporate income
+	Income40_4B_2_3      IncomeDetail `json:"income40_4B_2_3"`      // 4. (ข) (2) (2.3) กำไรสุทธิส่วนที่ได้หักผลขาดทุนสุทธิยกมาไม่เกิน 5 ปี ก่อนรอบระยะเวลาบัญชีปีปัจจุบัน / Net profit after deducting losses carried forward from up to 5 prior years
+	Income40_4B_2_4      IncomeDetail `json:"income40_4B_2_4"`      // 4. (ข) (2) (2.4)  กำไรที่รับรู้ทางบัญชีโดยวิธีส่วนได้เสีย (equity method) / Profit recognised under the equity method
+	Income40_4B_2_5_Note string       `json:"income40_4B_2_5_note"` // 4. (ข) (2) (2.5) อื่น ๆ (ระบุ)... ของกำไรสุทธิ / Description of the other dividends in 4. (b) (2) (2.5)
+	Income40_4B_2_5      IncomeDetail `json:"income40_4B_2_5"`      // 4. (ข) (2) (2.5) / Other dividends without tax credit
+
+	Income5      IncomeDetail `json:"income5"`      // 5. การจ่ายเงินได้ที่ต้องหักภาษี ณ ที่จ่าย / Payments subject to withholding under section 3 tredecies orders (prizes, services, rent, etc.)
+	Income6      IncomeDetail `json:"income6"`      // 6. อื่น ๆ (ระบุ) / Other income
+	Income6_Note string       `json:"income6_note"` // 6. อื่น ๆ (ระบุ) / Description of the other income
+
+	Totals          Totals          `json:"totals"`          // รวมเงิน / Totals
+	OtherPayments   OtherPayments   `json:"otherPayments"`   // จ่ายภาษี / Contributions to funds
+	WithholdingType WithholdingType `json:"withholdingType"` // ประเภทการหักภาษี / How the tax was withheld
+	Certification   Certification   `json:"certification"`   // การยืนยัน / Certification by the payer
 }
 
+// DocumentDetails is the book and document number in the top-right corner.
 type DocumentDetails struct {
-	BookNumber     string `json:"bookNumber"`
-	DocumentNumber string `json:"documentNumber"`
+	BookNumber     string `json:"bookNumber"`     // เล่มที่ / Book number
+	DocumentNumber string `json:"documentNumber"` // เลขที่ / Document number
 }
 
+// Payer is ผู้มีหน้าที่หักภาษี ณ ที่จ่าย, the person or company paying the income.
 type Payer struct {
-	TaxID        string `json:"taxId"`
-	TaxID10Digit string `json:"taxId10Digit"`
-	Name         string `json:"name"`
-	Address      string `json:"address"`
+	TaxID        string `json:"taxId"`        // เลขประจำตัวผู้เสียภาษีอากร 13 หลัก / 13-digit tax ID; spaces are ignored
+	TaxID10Digit string `json:"taxId10Digit"` // เลขประจำตัวผู้เสียภาษีอากร 10 หลัก / Legacy 10-digit tax ID; spaces are ignored
+	Name         string `json:"name"`         // ชื่อ / Name
+	Address      string `json:"address"`      // ที่อยู่ / Address
 }
 
+// Payee is ผู้ถูกหักภาษี ณ ที่จ่าย, the person or company receiving the income.
 type Payee struct {
-	TaxID          string `json:"taxId"`
-	TaxID10Digit   string `json:"taxId10Digit"`
-	Name           string `json:"name"`
-	Address        string `json:"address"`
-	SequenceNumber string `json:"sequenceNumber"`
-	Pnd_1a         bool   `json:"pnd_1a"`        // ภ.ง.ด. 1ก
-	Pnd_1aSpecial  bool   `json:"pnd_1aSpecial"` // ภ.ง.ด. 1ก พิเศษ
-	Pnd_2          bool   `json:"pnd_2"`         // ภ.ง.ด. 2
-	Pnd_3          bool   `json:"pnd_3"`         // ภ.ง.ด. 3
-	Pnd_2a         bool   `json:"pnd_2a"`        // ภ.ง.ด. 2ก
-	Pnd_3a         bool   `json:"pnd_3a"`        // ภ.ง.ด. 3ก
-	Pnd_53         bool   `json:"pnd_53"`        // ภ.ง.ด. 53
+	TaxID          string `json:"taxId"`          // เลขประจำตัวผู้เสียภาษีอากร 13 หลัก / 13-digit tax ID; spaces are ignored
+	TaxID10Digit   string `json:"taxId10Digit"`   // เลขประจำตัวผู้เสียภาษีอากร 10 หลัก / Legacy 10-digit tax ID; spaces are ignored
+	Name           string `json:"name"`           // ชื่อ / Name
+	Address        string `json:"address"`        // ที่อยู่ / Address
+	SequenceNumber string `json:"sequenceNumber"` // ลำดับที่ในแบบ / Sequence number in the ภ.ง.ด. return
+	Pnd_1a         bool   `json:"pnd_1a"`         // ภ.ง.ด. 1ก / Filed with ภ.ง.ด. 1ก (PND 1A)
+	Pnd_1aSpecial  bool   `json:"pnd_1aSpecial"`  // ภ.ง.ด. 1ก พิเศษ / Filed with ภ.ง.ด. 1ก พิเศษ (PND 1A special)
+	Pnd_2          bool   `json:"pnd_2"`          // ภ.ง.ด. 2 / Filed with ภ.ง.ด. 2 (PND 2)
+	Pnd_3          bool   `json:"pnd_3"`          // ภ.ง.ด. 3 / Filed with ภ.ง.ด. 3 (PND 3)
+	Pnd_2a         bool   `json:"pnd_2a"`         // ภ.ง.ด. 2ก / Filed with ภ.ง.ด. 2ก (PND 2A)
+	Pnd_3a         bool   `json:"pnd_3a"`         // ภ.ง.ด. 3ก / Filed with ภ.ง.ด. 3ก (PND 3A)
+	Pnd_53         bool   `json:"pnd_53"`         // ภ.ง.ด. 53 / Filed with ภ.ง.ด. 53 (PND 53)
 }
 
+// IncomeDetail is one row of the income table.
 type IncomeDetail struct {
-	DatePaid    string `json:"datePaid"`
-	AmountPaid  string `json:"amountPaid"`
-	TaxWithheld string `json:"taxWithheld"`
+	DatePaid    string `json:"datePaid"`    // วัน เดือน หรือปีภาษี ที่จ่าย / Date or tax year paid, e.g. "01 มกราคม 2568"
+	AmountPaid  string `json:"amountPaid"`  // จำนวนเงินที่จ่าย / Amount paid, e.g. "1,234.50"
+	TaxWithheld string `json:"taxWithheld"` // ภาษีที่หักและนำส่งไว้ / Tax withheld, e.g. "37.04"
 }
 
+// Totals is the รวม row below the income table.
 type Totals struct {
-	TotalAmountPaid         string `json:"totalAmountPaid"`
-	TotalTaxWithheld        string `json:"totalTaxWithheld"`
-	TotalTaxWithheldInWords string `json:"totalTaxWithheldInWords"`
+	TotalAmountPaid         string `json:"totalAmountPaid"`         // รวมเงินที่จ่าย / Total amount paid
+	TotalTaxWithheld        string `json:"totalTaxWithheld"`        // รวมภาษีที่หักนำส่ง / Total tax withheld
+	TotalTaxWithheldInWords string `json:"totalTaxWithheldInWords"` // รวมเงินภาษีที่หักนำส่ง (ตัวอักษร) / Total tax withheld in Thai words, e.g. "สี่ร้อยห้าสิบบาทถ้วน"
 }
 
+// OtherPayments is the เงินที่จ่ายเข้า line for fund contributions.
 type OtherPayments struct {
-	GovernmentPensionFund string `json:"governmentPensionFund"`
-	SocialSecurityFund    string `json:"socialSecurityFund"`
-	ProvidentFund         string `json:"providentFund"`
+	GovernmentPensionFund string `json:"governmentPensionFund"` // กบข./กสจ./กองทุนสงเคราะห์ครูโรงเรียนเอกชน / Government pension or teachers' welfare fund
+	SocialSecurityFund    string `json:"socialSecurityFund"`    // กองทุนประกันสังคม / Social security fund
+	ProvidentFund         string `json:"providentFund"`         // กองทุนสำรองเลี้ยงชีพ / Provident fund
 }
 
+// WithholdingType is the ผู้จ่ายเงิน row: how the tax was withheld.
 type WithholdingType struct {
-	WithholdingTax bool   `json:"withholdingTax"` // หัก ณ ที่จ่าย
-	Forever        bool   `json:"forever"`        // ออกให้ตลอดไป
-	OneTime        bool   `json:"oneTime"`        // ออกให้ครั้งเดียว
-	Other          bool   `json:"other"`          // อื่น ๆ
-	OtherDetails   string `json:"otherDetails"`   // อื่น ๆ (ระบุ)
+	WithholdingTax bool   `json:"withholdingTax"` // หัก ณ ที่จ่าย / Withheld at source
+	Forever        bool   `json:"forever"`        // ออกให้ตลอดไป / Tax always paid by the payer
+	OneTime        bool   `json:"oneTime"`        // ออกให้ครั้งเดียว / Tax paid by the payer this once
+	Other          bool   `json:"other"`          // อื่น ๆ / Other
+	OtherDetails   string `json:"otherDetails"`   // อื่น ๆ (ระบุ) / Description of the other type
 }
 
+// DateOfIssuance is the date the certificate is signed, in the Thai format.
 type DateOfIssuance struct {
-	Day   string `json:"day"`
-	Month string `json:"month"`
-	Year  string `json:"year"`
+	Day   string `json:"day"`   // วันที่ / Day, e.g. "15"
+	Month string `json:"month"` // เดือน / Month, e.g. "มกราคม"
+	Year  string `json:"year"`  // ปี พ.ศ. / Buddhist Era year, e.g. "2568"
 }
 
+// Certification is the payer's signature block.
 type Certification struct {
-	DateOfIssuance DateOfIssuance `json:"dateOfIssuance"`
+	DateOfIssuance      DateOfIssuance `json:"dateOfIssuance"`                // วัน เดือน ปี ที่ออกหนังสือรับรอง / Date of issuance
+	PayerSignatureImage *ImageSource   `json:"payerSignatureImage,omitempty"` // รูปลายเซ็นผู้จ่ายเงิน / Where the REST API finds the payer's signature image
+	CompanySealImage    *ImageSource   `json:"companySealImage,omitempty"`    // รูปตราประทับนิติบุคคล / Where the REST API finds the company seal image
+}
+
+// ImageSource tells the REST API where to find an image for the certificate.
+type ImageSource struct {
+	SourceType string `json:"sourceType"` // upload, base64, url, asset หรือ payer / One of upload, base64, url, asset or payer
+	Value      string `json:"value"`      // ชื่อ part ที่อัปโหลด, ข้อมูล base64, URL, asset id หรือ signature/seal ของผู้จ่ายเงิน / Name of the uploaded multipart part, base64 data, URL, stored asset id, or signature or seal stored for the payer
 }
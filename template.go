@@ -2,7 +2,9 @@ package pdf50tawi
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"embed"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"os"
@@ -37,6 +39,54 @@ func certificateTemplate() (io.ReadSeeker, error) {
 	return bytes.NewReader(tplBytes), nil
 }
 
+// TemplatePDF returns a copy of the embedded blank ฟอร์ม 50 ทวิ the
+// certificate is filled on.
+func TemplatePDF() ([]byte, error) {
+	r, err := certificateTemplate()
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+// TemplateVersion identifies the embedded form: the first 12 hex digits of
+// its SHA-256. It changes whenever the form is replaced, so a certificate
+// issued with WithMetadata can be traced to the form it was filled on.
+func TemplateVersion() string {
+	return templateVersion()
+}
+
+var templateVersion = sync.OnceValue(func() string {
+	data, err := TemplatePDF()
+	if err != nil {
+		return "unknown"
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:6])
+})
+
+// CheckResources loads the embedded template and Thai font, which are
+// otherwise loaded on first use, and reports whether certificates can be
+// filled with them. A server can call it at start-up and from its readiness
+// check: it also notices when the cached copy of the template has been
+// removed from the temp directory.
+func CheckResources() error {
+	path, err := cachedTemplatePath()
+	if err != nil {
+		return fmt.Errorf("template: %w", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("template: %w", err)
+	}
+	if _, err := rasterTemplate(); err != nil {
+		return fmt.Errorf("template: %w", err)
+	}
+	if _, err := thaiFont(); err != nil {
+		return err
+	}
+	return nil
+}
+
 // tplFileOnce caches a temp file that gopdf.ImportPage can read from.
 // The file is written once and reused for the process lifetime — it is never
 // removed so concurrent calls to fillCertificate are safe.
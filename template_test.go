@@ -13,3 +13,9 @@ func TestCertificateTemplate(t *testing.T) {
 		t.Fatalf("unable to read template: %v", err)
 	}
 }
+
+func TestCheckResources(t *testing.T) {
+	if err := CheckResources(); err != nil {
+		t.Fatalf("CheckResources error: %v", err)
+	}
+}
@@ -0,0 +1,62 @@
+// Command rasterize renders page 1 of the certificate template PDF to a
+// grayscale PNG used as the background of raster previews. It needs MuPDF
+// through go-fitz, so it lives in its own module and only runs when the
+// template changes:
+//
+//	go generate ./...
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"os"
+	"strconv"
+
+	"github.com/gen2brain/go-fitz"
+)
+
+func main() {
+	if len(os.Args) != 4 {
+		fmt.Fprintln(os.Stderr, "usage: rasterize <template.pdf> <out.png> <dpi>")
+		os.Exit(2)
+	}
+	if err := run(os.Args[1], os.Args[2], os.Args[3]); err != nil {
+		fmt.Fprintln(os.Stderr, "rasterize:", err)
+		os.Exit(1)
+	}
+}
+
+func run(in, out, dpiArg string) error {
+	dpi, err := strconv.ParseFloat(dpiArg, 64)
+	if err != nil || dpi <= 0 {
+		return fmt.Errorf("invalid dpi %q", dpiArg)
+	}
+
+	doc, err := fitz.New(in)
+	if err != nil {
+		return err
+	}
+	defer doc.Close()
+
+	page, err := doc.ImageDPI(0, dpi)
+	if err != nil {
+		return err
+	}
+
+	// The form is black on white; grayscale keeps the embedded PNG small.
+	gray := image.NewGray(page.Bounds())
+	draw.Draw(gray, gray.Bounds(), page, page.Bounds().Min, draw.Src)
+
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	enc := png.Encoder{CompressionLevel: png.BestCompression}
+	if err := enc.Encode(f, gray); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
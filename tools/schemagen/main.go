@@ -0,0 +1,250 @@
+// Command schemagen writes the JSON Schema (draft 2020-12) of
+// pdf50tawi.TaxInfo. Descriptions come from the field comments in
+// tax_info.go; the constraints mirror ValidateTaxInfo.
+//
+//	go generate ./...
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const schemaID = "https://github.com/AnuchitO/pdf50tawi/schema/taxinfo.schema.json"
+
+func main() {
+	if len(os.Args) != 3 {
+		fmt.Fprintln(os.Stderr, "usage: schemagen <tax_info.go> <out.schema.json>")
+		os.Exit(2)
+	}
+	if err := run(os.Args[1], os.Args[2]); err != nil {
+		fmt.Fprintln(os.Stderr, "schemagen:", err)
+		os.Exit(1)
+	}
+}
+
+func run(src, out string) error {
+	types, order, err := parseStructs(src)
+	if err != nil {
+		return err
+	}
+	root, ok := types["TaxInfo"]
+	if !ok {
+		return fmt.Errorf("%s: TaxInfo not found", src)
+	}
+
+	defs := object{}
+	for _, name := range order {
+		if name != "TaxInfo" {
+			defs = append(defs, field{name, structSchema(name, types[name])})
+		}
+	}
+	schema := object{
+		{"$schema", "https://json-schema.org/draft/2020-12/schema"},
+		{"$id", schemaID},
+		{"title", "TaxInfo"},
+	}
+	schema = append(schema, structSchema("TaxInfo", root)...)
+	schema = append(schema, field{"$defs", defs})
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(schema); err != nil {
+		return err
+	}
+	return os.WriteFile(out, buf.Bytes(), 0o644)
+}
+
+// structInfo is a struct type declared in tax_info.go.
+type structInfo struct {
+	doc    string
+	fields []fieldInfo
+}
+
+type fieldInfo struct {
+	json string
+	typ  string // "string", "bool" or the name of a struct type
+	doc  string
+}
+
+// parseStructs returns the struct types of src in declaration order.
+func parseStructs(src string) (map[string]structInfo, []string, error) {
+	f, err := parser.ParseFile(token.NewFileSet(), src, nil, parser.ParseComments)
+	if err != nil {
+		return nil, nil, err
+	}
+	types := map[string]structInfo{}
+	var order []string
+	for _, decl := range f.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gd.Specs {
+			ts := spec.(*ast.TypeSpec)
+			st, ok := ts.Type.(*ast.StructType)
+			if !ok {
+				continue
+			}
+			info := structInfo{doc: docText(gd.Doc)}
+			for _, fd := range st.Fields.List {
+				typ := fd.Type
+				if star, ok := typ.(*ast.StarExpr); ok {
+					typ = star.X // optional struct, left out when nil
+				}
+				ident, ok := typ.(*ast.Ident)
+				if !ok || fd.Tag == nil {
+					return nil, nil, fmt.Errorf("%s: unsupported field type", ts.Name.Name)
+				}
+				tag, _ := strconv.Unquote(fd.Tag.Value)
+				name, _, _ := strings.Cut(reflect.StructTag(tag).Get("json"), ",")
+				// A trailing comment describes the field; a comment above
+				// it introduces a group of fields and is not used.
+				info.fields = append(info.fields, fieldInfo{json: name, typ: ident.Name, doc: docText(fd.Comment)})
+			}
+			types[ts.Name.Name] = info
+			order = append(order, ts.Name.Name)
+		}
+	}
+	return types, order, nil
+}
+
+// docText joins the lines of a comment into one line.
+func docText(cg *ast.CommentGroup) string {
+	if cg == nil {
+		return ""
+	}
+	return strings.Join(strings.Fields(cg.Text()), " ")
+}
+
+// structSchema returns the schema keywords of one struct type, including the
+// constraints ValidateTaxInfo enforces on it.
+func structSchema(name string, s structInfo) object {
+	props := object{}
+	for _, f := range s.fields {
+		var p object
+		switch f.typ {
+		case "string", "bool":
+			typ := f.typ
+			if typ == "bool" {
+				typ = "boolean"
+			}
+			p = object{{"type", typ}}
+		default:
+			p = object{{"$ref", "#/$defs/" + f.typ}}
+		}
+		if f.doc != "" {
+			p = append(object{{"description", f.doc}}, p...)
+		}
+		p = append(p, fieldConstraints(name, f.json)...)
+		props = append(props, field{f.json, p})
+	}
+
+	o := object{}
+	if s.doc != "" {
+		o = append(o, field{"description", s.doc})
+	}
+	o = append(o, field{"type", "object"}, field{"properties", props})
+	o = append(o, structConstraints(name, s)...)
+	o = append(o, field{"additionalProperties", false})
+	return o
+}
+
+// fieldConstraints mirrors the per-field rules of ValidateTaxInfo.
+func fieldConstraints(typeName, jsonName string) object {
+	if typeName == "ImageSource" {
+		switch jsonName {
+		case "sourceType":
+			return object{{"enum", []string{"upload", "base64", "url", "asset", "payer"}}}
+		case "value":
+			return object{{"pattern", `\S`}}
+		}
+		return nil
+	}
+	if typeName != "Payer" && typeName != "Payee" {
+		return nil
+	}
+	switch jsonName {
+	case "name":
+		return object{{"pattern", `\S`}}
+	case "taxId":
+		return object{{"pattern", `^ *$|^( *[0-9]){13} *$`}}
+	case "taxId10Digit":
+		return object{{"pattern", `^ *$|^( *[0-9]){10} *$`}}
+	}
+	return nil
+}
+
+// structConstraints mirrors the required fields and "tick at least one box"
+// rules of ValidateTaxInfo.
+func structConstraints(name string, s structInfo) object {
+	switch name {
+	case "TaxInfo":
+		return object{{"required", []string{"payer", "payee", "withholdingType"}}}
+	case "Payer":
+		return object{{"required", []string{"name"}}}
+	case "Payee":
+		return object{{"required", []string{"name"}}, {"anyOf", anyTrue(s)}}
+	case "WithholdingType":
+		return object{{"anyOf", anyTrue(s)}}
+	case "ImageSource":
+		return object{{"required", []string{"sourceType", "value"}}}
+	}
+	return nil
+}
+
+// anyTrue returns one subschema per bool field requiring it to be true.
+func anyTrue(s structInfo) []object {
+	var alts []object
+	for _, f := range s.fields {
+		if f.typ == "bool" {
+			alts = append(alts, object{
+				{"properties", object{{f.json, object{{"const", true}}}}},
+				{"required", []string{f.json}},
+			})
+		}
+	}
+	return alts
+}
+
+// object is a JSON object that keeps its keys in insertion order.
+type object []field
+
+type field struct {
+	key   string
+	value any
+}
+
+func (o object) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, f := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, err := json.Marshal(f.key)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(f.value); err != nil {
+			return nil, err
+		}
+		buf.Truncate(buf.Len() - 1) // Encode appends a newline
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
@@ -5,14 +5,44 @@ import (
 	"strings"
 )
 
+// ValidationError lists every problem ValidateTaxInfo found. Errors holds the
+// messages; Issues holds the same problems with the field they belong to.
 type ValidationError struct {
 	Errors []string
+	Issues []ValidationIssue
 }
 
-func (v *ValidationError) Add(msg string)  { v.Errors = append(v.Errors, msg) }
+// ValidationIssue is a single validation problem. Field is the JSON path of
+// the offending value, e.g. "payee.taxId", and Code names the rule it
+// breaks, one of the Issue* constants.
+type ValidationIssue struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Codes of the rules ValidateTaxInfo checks. Unlike the messages they do not
+// change between releases, so clients and metrics can tell problems apart.
+const (
+	IssueRequired        = "required"         // a required value is empty
+	IssueTaxIDFormat     = "tax_id_format"    // a tax ID is not 13, or 10, digits
+	IssueIncomeType      = "income_type"      // no ภ.ง.ด. form is ticked for the payee
+	IssueCertificateType = "certificate_type" // no withholding type is ticked
+	IssueImageSource     = "image_source"     // an unknown sourceType or payer image
+	IssueOther           = "other"            // a problem added with Add, of no one field
+)
+
+// Add records msg as an issue of no particular field, with code IssueOther.
+func (v *ValidationError) Add(msg string)  { v.addIssue("", IssueOther, msg) }
 func (v *ValidationError) HasErrors() bool { return len(v.Errors) > 0 }
 func (v *ValidationError) Error() string   { return strings.Join(v.Errors, "; ") }
 
+// addIssue records msg against field, breaking the rule code.
+func (v *ValidationError) addIssue(field, code, msg string) {
+	v.Issues = append(v.Issues, ValidationIssue{Field: field, Code: code, Message: msg})
+	v.Errors = append(v.Errors, msg)
+}
+
 // ValidateTaxInfo validates all fields in TaxInfo and returns a comprehensive error if any.
 func ValidateTaxInfo(t TaxInfo) error {
 	var ve ValidationError
@@ -21,6 +51,8 @@ func ValidateTaxInfo(t TaxInfo) error {
 	ve.validateParty("payee", t.Payee.Name, t.Payee.TaxID, t.Payee.TaxID10Digit)
 	ve.validatePayeePND(t.Payee)
 	ve.validateWithholdingType(t.WithholdingType)
+	ve.validateImageSource("certification.payerSignatureImage", t.Certification.PayerSignatureImage, t.Payer.TaxID)
+	ve.validateImageSource("certification.companySealImage", t.Certification.CompanySealImage, t.Payer.TaxID)
 
 	if ve.HasErrors() {
 		return &ve
@@ -30,27 +62,49 @@ func ValidateTaxInfo(t TaxInfo) error {
 
 func (ve *ValidationError) validatePayeePND(p Payee) {
 	if !p.Pnd_1a && !p.Pnd_1aSpecial && !p.Pnd_2 && !p.Pnd_3 && !p.Pnd_2a && !p.Pnd_3a && !p.Pnd_53 {
-		ve.Add("ผู้ถูกหักภาษี: ต้องเลือกประเภทเงินได้อย่างน้อยหนึ่งประเภท ภ.ง.ด. 1ก: pnd_1a, ภ.ง.ด. 1ก พิเศษ: pnd_1aSpecial, ภ.ง.ด. 2: pnd_2, ภ.ง.ด. 3: pnd_3, ภ.ง.ด. 2ก: pnd_2a, ภ.ง.ด. 3ก: pnd_3a หรือ ภ.ง.ด. 53: pnd_53")
+		ve.addIssue("payee", IssueIncomeType, "ผู้ถูกหักภาษี: ต้องเลือกประเภทเงินได้อย่างน้อยหนึ่งประเภท ภ.ง.ด. 1ก: pnd_1a, ภ.ง.ด. 1ก พิเศษ: pnd_1aSpecial, ภ.ง.ด. 2: pnd_2, ภ.ง.ด. 3: pnd_3, ภ.ง.ด. 2ก: pnd_2a, ภ.ง.ด. 3ก: pnd_3a หรือ ภ.ง.ด. 53: pnd_53")
 	}
 }
 
 func (ve *ValidationError) validateWithholdingType(w WithholdingType) {
 	if !w.WithholdingTax && !w.Forever && !w.OneTime && !w.Other {
-		ve.Add("ต้องเลือกประเภทหนังสือรับรองอย่างน้อยหนึ่งประเภท (หัก ณ ที่จ่าย: withholdingTax, ออกให้ตลอดไป: forever, ออกให้ครั้งเดียว: oneTime หรือ อื่น ๆ: other)")
+		ve.addIssue("withholdingType", IssueCertificateType, "ต้องเลือกประเภทหนังสือรับรองอย่างน้อยหนึ่งประเภท (หัก ณ ที่จ่าย: withholdingTax, ออกให้ตลอดไป: forever, ออกให้ครั้งเดียว: oneTime หรือ อื่น ๆ: other)")
+	}
+}
+
+func (ve *ValidationError) validateImageSource(prefix string, src *ImageSource, payerTaxID string) {
+	if src == nil {
+		return
+	}
+	switch src.SourceType {
+	case ImageSourceUpload, ImageSourceBase64, ImageSourceURL, ImageSourceAsset:
+	case ImageSourcePayer:
+		if src.Value != PayerAssetSignature && src.Value != PayerAssetSeal {
+			ve.addIssue(prefix+".value", IssueImageSource, fmt.Sprintf("%s.value must be signature or seal", prefix))
+		}
+		if stripSpaces(payerTaxID) == "" {
+			ve.addIssue("payer.taxId", IssueRequired, fmt.Sprintf("payer.taxId is required when %s comes from the payer", prefix))
+		}
+		return
+	default:
+		ve.addIssue(prefix+".sourceType", IssueImageSource, fmt.Sprintf("%s.sourceType must be one of upload, base64, url, asset or payer", prefix))
+	}
+	if strings.TrimSpace(src.Value) == "" {
+		ve.addIssue(prefix+".value", IssueRequired, fmt.Sprintf("%s.value is required", prefix))
 	}
 }
 
 func (ve *ValidationError) validateParty(prefix, name, tax13, tax10 string) {
 	if strings.TrimSpace(name) == "" {
-		ve.Add(fmt.Sprintf("%s.name is required", prefix))
+		ve.addIssue(prefix+".name", IssueRequired, fmt.Sprintf("%s.name is required", prefix))
 	}
 	strippedTax13 := stripSpaces(tax13)
 	strippedTax10 := stripSpaces(tax10)
 	if strippedTax13 != "" && !isDigitsLen(strippedTax13, 13) {
-		ve.Add(fmt.Sprintf("%s.taxId must be 13 digits", prefix))
+		ve.addIssue(prefix+".taxId", IssueTaxIDFormat, fmt.Sprintf("%s.taxId must be 13 digits", prefix))
 	}
 	if strippedTax10 != "" && !isDigitsLen(strippedTax10, 10) {
-		ve.Add(fmt.Sprintf("%s.taxId10Digit must be 10 digits", prefix))
+		ve.addIssue(prefix+".taxId10Digit", IssueTaxIDFormat, fmt.Sprintf("%s.taxId10Digit must be 10 digits", prefix))
 	}
 }
 
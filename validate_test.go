@@ -1,6 +1,7 @@
 package pdf50tawi
 
 import (
+	"errors"
 	"strings"
 	"testing"
 )
@@ -245,3 +246,90 @@ func TestValidateTaxInfo_AllErrors(t *testing.T) {
 	}
 }
 
+func TestValidateTaxInfo_Issues(t *testing.T) {
+	v := TaxInfo{
+		Payer:           Payer{Name: "Payer", TaxID: "123"},
+		Payee:           Payee{TaxID: "1234567890123", Pnd_53: true},
+		WithholdingType: WithholdingType{OneTime: true},
+	}
+
+	err := ValidateTaxInfo(v)
+	var ve *ValidationError
+	if !errors.As(err, &ve) {
+		t.Fatalf("expected *ValidationError, got %v", err)
+	}
+	want := []ValidationIssue{
+		{Field: "payer.taxId", Code: IssueTaxIDFormat, Message: "payer.taxId must be 13 digits"},
+		{Field: "payee.name", Code: IssueRequired, Message: "payee.name is required"},
+	}
+	if len(ve.Issues) != len(want) {
+		t.Fatalf("expected %d issues, got %+v", len(want), ve.Issues)
+	}
+	for i := range want {
+		if ve.Issues[i] != want[i] {
+			t.Fatalf("issue %d: got %+v, want %+v", i, ve.Issues[i], want[i])
+		}
+	}
+	if len(ve.Errors) != len(ve.Issues) {
+		t.Fatalf("expected Errors to mirror Issues, got %q", ve.Errors)
+	}
+
+	// A problem added by hand is an issue too, of no one field.
+	ve.Add("payee.address does not fit")
+	if got := ve.Issues[len(ve.Issues)-1]; got != (ValidationIssue{Code: IssueOther, Message: "payee.address does not fit"}) || len(ve.Errors) != len(ve.Issues) {
+		t.Fatalf("Add: issue %+v, errors %q", got, ve.Errors)
+	}
+}
+
+func TestValidateImageSource(t *testing.T) {
+	testCases := []struct {
+		name   string
+		source *ImageSource
+		want   []ValidationIssue
+	}{
+		{"None", nil, nil},
+		{"Upload", &ImageSource{SourceType: ImageSourceUpload, Value: "signatureImage"}, nil},
+		{"Asset", &ImageSource{SourceType: ImageSourceAsset, Value: "seal-2568"}, nil},
+		{"Payer", &ImageSource{SourceType: ImageSourcePayer, Value: PayerAssetSeal}, nil},
+		{"PayerUnknownKind", &ImageSource{SourceType: ImageSourcePayer, Value: "logo"}, []ValidationIssue{
+			{Field: "certification.companySealImage.value", Code: IssueImageSource, Message: "certification.companySealImage.value must be signature or seal"},
+		}},
+		{"UnknownType", &ImageSource{SourceType: "ftp", Value: "x"}, []ValidationIssue{
+			{Field: "certification.companySealImage.sourceType", Code: IssueImageSource, Message: "certification.companySealImage.sourceType must be one of upload, base64, url, asset or payer"},
+		}},
+		{"EmptyValue", &ImageSource{SourceType: ImageSourceURL, Value: " "}, []ValidationIssue{
+			{Field: "certification.companySealImage.value", Code: IssueRequired, Message: "certification.companySealImage.value is required"},
+		}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			v := validTaxInfo()
+			v.Certification.CompanySealImage = tc.source
+			err := ValidateTaxInfo(v)
+			if tc.want == nil {
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				return
+			}
+			var ve *ValidationError
+			if !errors.As(err, &ve) {
+				t.Fatalf("expected *ValidationError, got %v", err)
+			}
+			if len(ve.Issues) != len(tc.want) || ve.Issues[0] != tc.want[0] {
+				t.Fatalf("got %+v, want %+v", ve.Issues, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidateImageSource_PayerNeedsTaxID(t *testing.T) {
+	v := validTaxInfo()
+	v.Payer.TaxID = ""
+	v.Certification.PayerSignatureImage = &ImageSource{SourceType: ImageSourcePayer, Value: PayerAssetSignature}
+	var ve *ValidationError
+	if !errors.As(ValidateTaxInfo(v), &ve) || len(ve.Issues) != 1 || ve.Issues[0].Field != "payer.taxId" {
+		t.Fatalf("expected a payer.taxId issue, got %+v", ve)
+	}
+}
@@ -0,0 +1,176 @@
+package pdf50tawi
+
+import (
+	"fmt"
+	"image/color"
+	"sync"
+
+	"github.com/signintech/gopdf"
+	"github.com/signintech/gopdf/fontmaker/core"
+)
+
+// Watermark stamps large rotated text across the certificate, e.g. สำเนา on
+// copies, ยกเลิก on voided certificates or ตัวอย่าง on draft previews.
+// The text is drawn with the embedded Thai font.
+type Watermark struct {
+	// Text is the main stamp text.
+	Text string
+
+	// Lines are printed in a smaller size under Text, e.g. the cancellation
+	// reason and date.
+	Lines []string
+
+	// FontSize of Text in points. Lines use a third of it. Defaults to 96.
+	FontSize float64
+
+	// Angle rotates the stamp counter-clockwise, in degrees, around the
+	// page centre.
+	Angle float64
+
+	// Color of the text. The alpha channel is ignored; use Opacity.
+	Color color.RGBA
+
+	// Opacity between 0 and 1. Defaults to 0.25.
+	Opacity float64
+
+	// Above draws the stamp over the filled-in fields and images instead of
+	// behind them. The template itself is always underneath.
+	Above bool
+}
+
+// Default watermark appearance.
+const (
+	defaultWatermarkFontSize = 96
+	defaultWatermarkOpacity  = 0.25
+)
+
+var (
+	watermarkGray = color.RGBA{R: 90, G: 90, B: 90, A: 255}
+	watermarkRed  = color.RGBA{R: 200, G: 0, B: 0, A: 255}
+)
+
+// CopyWatermark marks a certificate as a copy (สำเนา).
+func CopyWatermark() Watermark {
+	return Watermark{Text: "สำเนา", Angle: 45, Color: watermarkGray}
+}
+
+// DraftWatermark marks a certificate as a draft preview (ตัวอย่าง / DRAFT).
+func DraftWatermark() Watermark {
+	return Watermark{Text: "ตัวอย่าง / DRAFT", FontSize: 80, Angle: 45, Color: watermarkGray}
+}
+
+// VoidWatermark marks a certificate as cancelled (ยกเลิก) with the reason and
+// cancellation date printed underneath. It is drawn above the content so the
+// void stamp cannot be hidden by images.
+func VoidWatermark(reason, date string) Watermark {
+	w := Watermark{Text: "ยกเลิก", FontSize: 120, Angle: 45, Color: watermarkRed, Opacity: 0.35, Above: true}
+	if reason != "" {
+		w.Lines = append(w.Lines, "เหตุผล: "+reason)
+	}
+	if date != "" {
+		w.Lines = append(w.Lines, "วันที่ยกเลิก: "+date)
+	}
+	return w
+}
+
+// WithWatermark stamps w across the certificate.
+func WithWatermark(w Watermark) Option {
+	return func(o *issueOptions) {
+		if w.FontSize <= 0 {
+			w.FontSize = defaultWatermarkFontSize
+		}
+		if w.Opacity <= 0 || w.Opacity > 1 {
+			w.Opacity = defaultWatermarkOpacity
+		}
+		o.watermarks = append(o.watermarks, w)
+	}
+}
+
+func (w Watermark) overlay() overlay {
+	return overlay{behind: !w.Above, draw: w.draw, raster: w.paint}
+}
+
+// stampAscent is the baseline offset from the top of a stamp line as a
+// fraction of its font size.
+const stampAscent = 0.8
+
+// stampLine is one line of a watermark. baseline is relative to the page
+// centre before rotation.
+type stampLine struct {
+	text     string
+	size     float64
+	baseline float64
+}
+
+// layout stacks Text and Lines into a block centred on the page.
+func (w Watermark) layout() []stampLine {
+	lineSize := w.FontSize / 3
+	top := -(w.FontSize + float64(len(w.Lines))*lineSize) / 2
+
+	lines := []stampLine{{text: w.Text, size: w.FontSize, baseline: top + w.FontSize*stampAscent}}
+	top += w.FontSize
+	for _, line := range w.Lines {
+		lines = append(lines, stampLine{text: line, size: lineSize, baseline: top + lineSize*stampAscent})
+		top += lineSize
+	}
+	return lines
+}
+
+// draw centres the text block on the page, rotates it and restores the
+// graphics state so later fields render normally.
+func (w Watermark) draw(pdf *gopdf.GoPdf) error {
+	alpha := gopdf.Transparency{Alpha: w.Opacity, BlendModeType: gopdf.NormalBlendMode}
+	pdf.SetTextColor(w.Color.R, w.Color.G, w.Color.B)
+	defer pdf.SetTextColor(0, 0, 0)
+
+	cx, cy := pageWidth/2, pageHeight/2
+	pdf.Rotate(w.Angle, cx, cy)
+	defer pdf.RotateReset()
+
+	for _, line := range w.layout() {
+		if err := pdf.SetFont("THSarabunNew", "", line.size); err != nil {
+			return fmt.Errorf("set font: %w", err)
+		}
+		width, err := pdf.MeasureTextWidth(line.text)
+		if err != nil {
+			return fmt.Errorf("measure watermark: %w", err)
+		}
+		// Only cells take an explicit transparency; a top-aligned cell puts
+		// its baseline one typographic ascent below y.
+		pdf.SetXY(cx-width/2, cy+line.baseline-thaiTypoAscent()*line.size)
+		opt := gopdf.CellOption{Align: gopdf.Left | gopdf.Top, Transparency: &alpha}
+		if err := pdf.CellWithOption(nil, line.text, opt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// thaiTypoAscent is THSarabunNew's typographic ascender as a fraction of
+// the font size.
+var thaiTypoAscent = sync.OnceValue(func() float64 {
+	var ttf core.TTFParser
+	if err := ttf.ParseFontData(thSarabunFontData); err != nil || ttf.UnitsPerEm() == 0 {
+		return stampAscent
+	}
+	return float64(ttf.TypoAscender()) / float64(ttf.UnitsPerEm())
+})
+
+// paint is the raster counterpart of draw.
+func (w Watermark) paint(p *rasterPage) error {
+	cx, cy := pageWidth/2, pageHeight/2
+	p.rotate(w.Angle, cx, cy)
+	defer p.rotate(0, 0, 0)
+
+	c := color.NRGBA{R: w.Color.R, G: w.Color.G, B: w.Color.B, A: uint8(w.Opacity*255 + 0.5)}
+	for _, line := range w.layout() {
+		width, err := p.measure(line.text, line.size)
+		if err != nil {
+			return err
+		}
+		if err := p.text(line.text, line.size, cx-width/2, cy+line.baseline, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package pdf50tawi
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWithWatermarkDefaults(t *testing.T) {
+	o := newIssueOptions([]Option{WithWatermark(Watermark{Text: "ต้นฉบับ", Opacity: 2})})
+	if len(o.watermarks) != 1 {
+		t.Fatalf("expected 1 watermark, got %d", len(o.watermarks))
+	}
+	w := o.watermarks[0]
+	if w.FontSize != defaultWatermarkFontSize {
+		t.Fatalf("FontSize: got %v, want %v", w.FontSize, defaultWatermarkFontSize)
+	}
+	if w.Opacity != defaultWatermarkOpacity {
+		t.Fatalf("Opacity: got %v, want %v", w.Opacity, defaultWatermarkOpacity)
+	}
+}
+
+func TestVoidWatermark(t *testing.T) {
+	w := VoidWatermark("ออกเลขที่ซ้ำ", "15 มีนาคม 2568")
+	if w.Text != "ยกเลิก" || !w.Above {
+		t.Fatalf("unexpected void stamp: %+v", w)
+	}
+	want := []string{"เหตุผล: ออกเลขที่ซ้ำ", "วันที่ยกเลิก: 15 มีนาคม 2568"}
+	if len(w.Lines) != len(want) {
+		t.Fatalf("expected %d lines, got %q", len(want), w.Lines)
+	}
+	for i := range want {
+		if w.Lines[i] != want[i] {
+			t.Fatalf("line %d: got %q, want %q", i, w.Lines[i], want[i])
+		}
+	}
+	if lines := VoidWatermark("", "").Lines; len(lines) != 0 {
+		t.Fatalf("expected no lines, got %q", lines)
+	}
+}
+
+func TestIssueWHTCertificatePDFWithWatermark(t *testing.T) {
+	var plain bytes.Buffer
+	if err := IssueWHTCertificatePDF(&plain, sampleTaxInfo(), nil, nil); err != nil {
+		t.Fatalf("IssueWHTCertificatePDF error: %v", err)
+	}
+	for name, w := range map[string]Watermark{
+		"copy":  CopyWatermark(),
+		"draft": DraftWatermark(),
+		"void":  VoidWatermark("ออกเลขที่ซ้ำ", "15 มีนาคม 2568"),
+	} {
+		var buf bytes.Buffer
+		if err := IssueWHTCertificatePDF(&buf, sampleTaxInfo(), nil, nil, WithWatermark(w)); err != nil {
+			t.Fatalf("%s: IssueWHTCertificatePDF error: %v", name, err)
+		}
+		if !bytes.HasPrefix(buf.Bytes(), []byte("%PDF")) {
+			t.Fatalf("%s: output does not look like a PDF", name)
+		}
+		if buf.Len() <= plain.Len() {
+			t.Fatalf("%s: expected the watermark to add content: %d <= %d bytes", name, buf.Len(), plain.Len())
+		}
+	}
+}